@@ -5,12 +5,22 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strings"
 
+	"github.com/Zachacious/presto/internal/classify"
 	"github.com/Zachacious/presto/internal/commands"
 	"github.com/Zachacious/presto/internal/config"
+	"github.com/Zachacious/presto/internal/extract"
+	"github.com/Zachacious/presto/internal/notebook"
 	"github.com/Zachacious/presto/internal/processor"
+	"github.com/Zachacious/presto/internal/records"
+	"github.com/Zachacious/presto/internal/region"
+	"github.com/Zachacious/presto/internal/repomap"
+	"github.com/Zachacious/presto/internal/review"
+	"github.com/Zachacious/presto/internal/structured"
 	"github.com/Zachacious/presto/internal/ui"
+	"github.com/Zachacious/presto/internal/utils"
 	"github.com/Zachacious/presto/pkg/types"
 )
 
@@ -43,12 +53,39 @@ func main() {
 		recursive      = flag.Bool("recursive", false, "Process directories recursively")
 		filePattern    = flag.String("pattern", "", "File pattern regex to match")
 		excludePattern = flag.String("exclude", "", "File pattern regex to exclude")
+		changedSince   = flag.String("changed-since", "", "Only process files changed since this git ref (e.g. main)")
+		reportFormat   = flag.String("format", "", "Report format: terminal|sarif|github for review, json|jsonl|csv for extract, table|json|csv for classify")
+		schemaFile     = flag.String("schema", "", "JSON Schema file every extracted object must match (extract)")
+		labels         = flag.String("labels", "", "Comma-separated labels to classify files with, each name or name:description (classify)")
+		minConfidence  = flag.Float64("min-confidence", 0, "Drop labels scored below this confidence, 0 to 1 (classify)")
+		recordFields   = flag.String("field", "", "Comma-separated fields of each record to send (records; default all)")
+		outputField    = flag.String("output-field", "", "Column or field each record's result is written to (records)")
+		batchSize      = flag.Int("batch", 20, "Records sent per request (records)")
+		recordFormat   = flag.String("record-format", "", "Record format: csv|jsonl|log (records; default from the file extension)")
+		tagged         = flag.String("tagged", "", "Only process files tagged with any of these comma-separated labels (needs --tags)")
+		tagsFile       = flag.String("tags", "", "Classify report (json or csv) that --tagged reads")
 		generateMode   = flag.Bool("generate", false, "Generate new content instead of transforming")
+		multiFile      = flag.Bool("multi", false, "Let the AI create, replace and delete several files in one response")
+		outputTemplate = flag.String("output-template", "", "With --generate, write one file per input at this path (e.g. {{dir}}/{{stem}}_test{{ext}})")
+		onExists       = flag.String("on-exists", "", "When a per-file generate output exists: skip|overwrite|merge")
+		mapPrompt      = flag.String("map-prompt", "", "With --generate, run this prompt on every file first and generate from the results (map-reduce)")
+		noCache        = flag.Bool("no-cache", false, "Don't reuse or store cached map-reduce results")
 		removeComments = flag.Bool("remove-comments", false, "Remove comments from input before processing")
 
 		// Context options
-		contextFiles    = flag.String("context", "", "Comma-separated context file paths")
-		contextPatterns = flag.String("context-pattern", "", "Comma-separated context file patterns")
+		contextFiles     = flag.String("context", "", "Comma-separated context file paths (label:path to name one)")
+		contextPatterns  = flag.String("context-pattern", "", "Comma-separated context file patterns")
+		contextBudget    = flag.Int("context-budget", 0, "Maximum context tokens per request (default: what the model window allows)")
+		contextCommands  stringList
+		selectors        stringList
+		sections         stringList
+		symbols          stringList
+		lineRanges       stringList
+		contextTemplates stringList
+		contextRepoMap   = flag.Bool("context-repomap", false, "Send a file tree and symbol outline of the whole project as context")
+		autoContext      = flag.Bool("auto-context", false, "Attach each file's local imports (Go module, relative JS/TS/Python) as context")
+		autoDepth        = flag.Int("auto-context-depth", 1, "Import levels to follow with --auto-context")
+		autoFull         = flag.Bool("auto-context-full", false, "Attach full dependency source instead of signatures")
 
 		systemPrompt     = flag.String("system-prompt", "", "Override system prompt")
 		systemPromptFile = flag.String("system-prompt-file", "", "Load system prompt from text file")
@@ -64,7 +101,19 @@ func main() {
 		maxConcurrent  = flag.Int("concurrent", 3, "Maximum concurrent file processing")
 		backupOriginal = flag.Bool("backup", false, "Create backup of original files")
 		preview        = flag.Bool("preview", false, "Preview changes before saving")
+		onConflict     = flag.String("on-conflict", "", "When a file changes during processing: abort|sibling|merge")
 		saveCommandAs  = flag.String("save-command", "", "Save current options as a named command")
+		estimate       = flag.Bool("estimate", false, "Estimate tokens and cost without calling the API")
+
+		// Budget options
+		maxFiles       = flag.Int("max-files", 0, "Maximum number of files to send to the AI in one run")
+		maxTotalTokens = flag.Int("max-total-tokens", 0, "Stop dispatching files once this many tokens would be used")
+		maxCost        = flag.Float64("max-cost", 0, "Stop dispatching files once this cost in USD would be exceeded")
+
+		// Privacy options
+		noRedact    = flag.Bool("no-redact", false, "Send content without masking secrets and personal data")
+		skipSecrets = flag.Bool("skip-secrets", false, "Skip files that contain secrets instead of masking them")
+		noFileCtx   = flag.Bool("no-file-context", false, "Don't describe the current file (path, package, ...) in prompts")
 
 		// Shorthand flags
 		inplace = flag.Bool("inplace", false, "Modify files in place (shorthand for --output inplace)")
@@ -81,8 +130,71 @@ func main() {
 		return
 	}
 
+	// "presto repomap [dir]" prints the map --context-repomap would send
+	if len(os.Args) > 1 && os.Args[1] == "repomap" {
+		handleRepoMap(os.Args[2:])
+		return
+	}
+
+	// "presto estimate [options]" is the subcommand form of --estimate
+	estimateCommand := false
+	if len(os.Args) > 1 && os.Args[1] == "estimate" {
+		estimateCommand = true
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	// "presto ask QUESTION [options]" answers on stdout instead of editing files
+	askCommand := false
+	var question string
+	if len(os.Args) > 1 && os.Args[1] == "ask" {
+		askCommand = true
+		args := os.Args[2:]
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			question, args = args[0], args[1:]
+		}
+		os.Args = append(os.Args[:1], args...)
+	}
+
+	// "presto review [options]" reports findings instead of editing files
+	reviewCommand := false
+	if len(os.Args) > 1 && os.Args[1] == "review" {
+		reviewCommand = true
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	// "presto extract --schema FILE [options]" collects one object per file
+	extractCommand := false
+	if len(os.Args) > 1 && os.Args[1] == "extract" {
+		extractCommand = true
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	// "presto classify --labels a,b [options]" tags files with labels
+	classifyCommand := false
+	if len(os.Args) > 1 && os.Args[1] == "classify" {
+		classifyCommand = true
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	// "presto records --output-field NAME [options]" runs the prompt per record
+	recordsCommand := false
+	if len(os.Args) > 1 && os.Args[1] == "records" {
+		recordsCommand = true
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	flag.BoolVar(recursive, "r", false, "Shorthand for --recursive")
+	flag.Var(&selectors, "select", "In transform mode, rewrite only the JSON/YAML string values this JSONPath matches, e.g. $..description (repeatable)")
+	flag.Var(&sections, "section", "In transform mode, rewrite only the Markdown sections whose heading line matches this regex, e.g. '^## Troubleshooting' (repeatable)")
+	flag.Var(&symbols, "symbol", "In transform mode, rewrite only this Go declaration, e.g. Processor.processFile (repeatable)")
+	flag.Var(&lineRanges, "lines", "In transform mode, rewrite only these lines, e.g. 120-180 (repeatable)")
+	cells := flag.String("cells", "", "Notebook cells a transform rewrites: code, markdown or all (default all)")
+	flag.Var(&contextCommands, "context-cmd", "Shell command whose output is sent as context (repeatable)")
+	flag.Var(&contextTemplates, "context-for", "Per-file context path template, e.g. {{dir}}/{{stem}}_test.go (repeatable)")
 	flag.Parse()
 
+	estimateOnly := *estimate || estimateCommand
+
 	// Handle utility commands first
 	if *showVersion {
 		fmt.Printf("Presto v%s (commit %s, built %s)\n", version, commit, date)
@@ -126,8 +238,8 @@ func main() {
 		log.Fatalf("❌ Failed to load configuration: %v", err)
 	}
 
-	// Validate configuration
-	if err := config.ValidateConfig(cfg); err != nil {
+	// Validate configuration (estimates never contact the provider)
+	if err := config.ValidateConfig(cfg); err != nil && !estimateOnly {
 		fmt.Printf("❌ Configuration error: %v\n\n", err)
 		fmt.Println("To fix this, you can:")
 		fmt.Println("1. Run: presto configure")
@@ -154,6 +266,27 @@ func main() {
 		}
 	}
 
+	var labelList, taggedList, recordFieldList []string
+	if *recordFields != "" {
+		for _, field := range strings.Split(*recordFields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				recordFieldList = append(recordFieldList, field)
+			}
+		}
+	}
+	if *labels != "" {
+		for _, label := range strings.Split(*labels, ",") {
+			labelList = append(labelList, strings.TrimSpace(label))
+		}
+	}
+	if *tagged != "" {
+		for _, label := range strings.Split(*tagged, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				taggedList = append(taggedList, label)
+			}
+		}
+	}
+
 	// Parse variables
 	varMap := make(map[string]string)
 	if *variables != "" {
@@ -209,8 +342,33 @@ func main() {
 		OutputDir:        *outputDir,
 		OutputSuffix:     *outputSuffix,
 		SmartSuffix:      *smartSuffix,
+		OutputTemplate:   *outputTemplate,
+		OnExists:         types.ExistsPolicy(*onExists),
+		MapPrompt:        *mapPrompt,
+		ChangedSince:     *changedSince,
+		SchemaFile:       *schemaFile,
+		Labels:           labelList,
+		MinConfidence:    *minConfidence,
+		Selectors:        selectors,
+		Sections:         sections,
+		Cells:            *cells,
+		Symbols:          symbols,
+		LineRanges:       lineRanges,
+		RecordFormat:     *recordFormat,
+		RecordFields:     recordFieldList,
+		OutputField:      *outputField,
+		BatchSize:        *batchSize,
+		Tagged:           taggedList,
+		TagsFile:         *tagsFile,
 		ContextFiles:     contextFileList,
 		ContextPatterns:  contextPatternList,
+		ContextBudget:    *contextBudget,
+		ContextRepoMap:   *contextRepoMap,
+		ContextCommands:  contextCommands,
+		ContextTemplates: contextTemplates,
+		AutoContext:      *autoContext,
+		AutoContextDepth: *autoDepth,
+		AutoContextFull:  *autoFull,
 		Recursive:        *recursive,
 		FilePattern:      *filePattern,
 		ExcludePattern:   *excludePattern,
@@ -220,6 +378,10 @@ func main() {
 		MaxConcurrent:    *maxConcurrent,
 		BackupOriginal:   finalBackup,
 		Preview:          *preview,
+		OnConflict:       types.ConflictStrategy(*onConflict),
+		MaxFiles:         *maxFiles,
+		MaxTotalTokens:   *maxTotalTokens,
+		MaxCost:          *maxCost,
 		Model:            *model,
 		Temperature:      *temperature,
 		MaxTokens:        *maxTokens,
@@ -230,6 +392,50 @@ func main() {
 	if *generateMode {
 		opts.Mode = types.ModeGenerate
 	}
+	if *multiFile {
+		if *generateMode {
+			log.Fatal("❌ --multi and --generate cannot be combined")
+		}
+		opts.Mode = types.ModeMultiFile
+	}
+	if reviewCommand {
+		if *generateMode || *multiFile || askCommand {
+			log.Fatal("❌ review cannot be combined with --generate, --multi or ask")
+		}
+		opts.Mode = types.ModeReview
+	}
+	if extractCommand {
+		if *generateMode || *multiFile || askCommand || reviewCommand {
+			log.Fatal("❌ extract cannot be combined with --generate, --multi, ask or review")
+		}
+		opts.Mode = types.ModeExtract
+	}
+	if classifyCommand {
+		if *generateMode || *multiFile || askCommand || reviewCommand || extractCommand {
+			log.Fatal("❌ classify cannot be combined with --generate, --multi, ask, review or extract")
+		}
+		opts.Mode = types.ModeClassify
+	}
+	if recordsCommand {
+		if *generateMode || *multiFile || askCommand || reviewCommand || extractCommand || classifyCommand {
+			log.Fatal("❌ records cannot be combined with --generate, --multi, ask, review, extract or classify")
+		}
+		opts.Mode = types.ModeRecords
+	}
+	if askCommand {
+		if *generateMode || *multiFile {
+			log.Fatal("❌ ask cannot be combined with --generate or --multi")
+		}
+		opts.Mode = types.ModeAsk
+
+		// The question may also follow the options
+		if question == "" {
+			question = strings.Join(flag.Args(), " ")
+		}
+		if question != "" {
+			opts.AIPrompt = question
+		}
+	}
 
 	// Apply command if specified
 	if *commandName != "" {
@@ -244,18 +450,186 @@ func main() {
 			opts.PromptFile = cmd.PromptFile
 		}
 	}
+	if askCommand {
+		opts.Mode = types.ModeAsk // A command's mode doesn't turn a question into edits
+	}
+	if reviewCommand {
+		opts.Mode = types.ModeReview
+	}
+	if extractCommand {
+		opts.Mode = types.ModeExtract
+	}
+	if classifyCommand {
+		opts.Mode = types.ModeClassify
+	}
+	if recordsCommand {
+		opts.Mode = types.ModeRecords
+	}
 
-	// Validate required options
-	if opts.AIPrompt == "" && opts.PromptFile == "" {
+	// Validate required options; review, extract and classify have default prompts
+	promptOptional := opts.Mode == types.ModeReview || opts.Mode == types.ModeExtract || opts.Mode == types.ModeClassify
+	if opts.AIPrompt == "" && opts.PromptFile == "" && !promptOptional {
+		if opts.Mode == types.ModeAsk {
+			log.Fatal("❌ Usage: presto ask \"QUESTION\" --input PATH [options]")
+		}
 		log.Fatal("❌ Either --prompt or --prompt-file is required")
 	}
 
-	if opts.InputPath == "" && opts.Mode == types.ModeTransform {
-		log.Fatal("❌ --input is required for transform mode")
+	if opts.Mode == types.ModeAsk && (opts.OutputTemplate != "" || opts.MapPrompt != "") {
+		log.Fatal("❌ ask never writes files; --output-template and --map-prompt don't apply")
+	}
+
+	if opts.InputPath == "" && opts.ChangedSince == "" {
+		switch opts.Mode {
+		case types.ModeTransform:
+			log.Fatal("❌ --input or --changed-since is required for transform mode")
+		case types.ModeReview:
+			log.Fatal("❌ --input or --changed-since is required for review")
+		case types.ModeExtract:
+			log.Fatal("❌ --input or --changed-since is required for extract")
+		case types.ModeClassify:
+			log.Fatal("❌ --input or --changed-since is required for classify")
+		case types.ModeRecords:
+			log.Fatal("❌ --input or --changed-since is required for records")
+		}
+	}
+
+	if (len(opts.Tagged) > 0) != (opts.TagsFile != "") {
+		log.Fatal("❌ --tagged and --tags must be used together")
+	}
+
+	if opts.Mode == types.ModeReview {
+		if *reportFormat == "" {
+			*reportFormat = review.FormatTerminal
+		}
+		switch *reportFormat {
+		case review.FormatTerminal, review.FormatGitHub:
+		case review.FormatSARIF:
+			if opts.OutputPath == "" {
+				log.Fatal("❌ --format sarif writes to --output-file")
+			}
+		default:
+			log.Fatalf("❌ Invalid report format: %s (use terminal, sarif or github)", *reportFormat)
+		}
+		if opts.OutputTemplate != "" || opts.MapPrompt != "" {
+			log.Fatal("❌ review never writes files; --output-template and --map-prompt don't apply")
+		}
+	}
+
+	if opts.Mode == types.ModeExtract {
+		if opts.SchemaFile == "" {
+			log.Fatal("❌ --schema is required for extract")
+		}
+		if opts.OutputPath == "" {
+			log.Fatal("❌ --output-file is required for extract")
+		}
+		if opts.OutputTemplate != "" || opts.MapPrompt != "" {
+			log.Fatal("❌ extract writes one data file; --output-template and --map-prompt don't apply")
+		}
+		if opts.ExtractFormat, err = extract.FormatFor(*reportFormat, opts.OutputPath); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+
+	if opts.Mode == types.ModeClassify {
+		if _, err := classify.New(opts.Labels); err != nil {
+			log.Fatalf("❌ Invalid --labels: %v", err)
+		}
+		if opts.MinConfidence < 0 || opts.MinConfidence > 1 {
+			log.Fatal("❌ --min-confidence must be between 0 and 1")
+		}
+		if *reportFormat == "" {
+			*reportFormat = classify.FormatTable
+		}
+		switch *reportFormat {
+		case classify.FormatTable, classify.FormatJSON, classify.FormatCSV:
+		default:
+			log.Fatalf("❌ Invalid report format: %s (use table, json or csv)", *reportFormat)
+		}
+		if opts.OutputTemplate != "" || opts.MapPrompt != "" {
+			log.Fatal("❌ classify never writes files; --output-template and --map-prompt don't apply")
+		}
+	}
+
+	if len(opts.Selectors) > 0 {
+		if opts.Mode != types.ModeTransform {
+			log.Fatal("❌ --select only applies to transform mode")
+		}
+		for _, expr := range opts.Selectors {
+			if _, err := structured.ParseSelector(expr); err != nil {
+				log.Fatalf("❌ Invalid --select: %v", err)
+			}
+		}
+	}
+
+	if len(opts.Sections) > 0 {
+		if opts.Mode != types.ModeTransform {
+			log.Fatal("❌ --section only applies to transform mode")
+		}
+		if len(opts.Selectors) > 0 {
+			log.Fatal("❌ --section and --select cannot be combined")
+		}
+		for _, expr := range opts.Sections {
+			if _, err := regexp.Compile(expr); err != nil {
+				log.Fatalf("❌ Invalid --section %q: %v", expr, err)
+			}
+		}
+	}
+
+	if len(opts.Symbols) > 0 || len(opts.LineRanges) > 0 {
+		if opts.Mode != types.ModeTransform {
+			log.Fatal("❌ --symbol and --lines only apply to transform mode")
+		}
+		if len(opts.Selectors) > 0 || len(opts.Sections) > 0 {
+			log.Fatal("❌ --symbol and --lines cannot be combined with --select or --section")
+		}
+		for _, spec := range opts.LineRanges {
+			if _, err := region.ParseLines(spec); err != nil {
+				log.Fatalf("❌ Invalid --lines: %v", err)
+			}
+		}
+	}
+
+	if !notebook.ValidTarget(opts.Cells) {
+		log.Fatalf("❌ Invalid --cells %q: use code, markdown or all", opts.Cells)
 	}
 
-	if opts.OutputPath == "" && opts.Mode == types.ModeGenerate {
-		log.Fatal("❌ --output-file is required for generate mode")
+	if opts.Mode == types.ModeRecords {
+		if opts.OutputField == "" {
+			log.Fatal("❌ --output-field is required for records")
+		}
+		if opts.BatchSize < 1 {
+			log.Fatal("❌ --batch must be at least 1")
+		}
+		if _, err := records.Detect("", opts.RecordFormat); err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+		if opts.OutputTemplate != "" || opts.MapPrompt != "" {
+			log.Fatal("❌ records writes one file per input; --output-template and --map-prompt don't apply")
+		}
+	}
+
+	if opts.OutputTemplate != "" {
+		if opts.Mode != types.ModeGenerate {
+			log.Fatal("❌ --output-template requires --generate")
+		}
+		if opts.InputPath == "" {
+			log.Fatal("❌ --input is required with --output-template")
+		}
+		if err := utils.ValidatePathTemplate(opts.OutputTemplate); err != nil {
+			log.Fatalf("❌ Invalid output template: %v", err)
+		}
+	}
+	if opts.MapPrompt != "" {
+		if opts.Mode != types.ModeGenerate {
+			log.Fatal("❌ --map-prompt requires --generate")
+		}
+		if opts.OutputTemplate != "" {
+			log.Fatal("❌ --map-prompt cannot be combined with --output-template")
+		}
+	}
+	if opts.OutputTemplate == "" && opts.OutputPath == "" && opts.Mode == types.ModeGenerate {
+		log.Fatal("❌ --output-file or --output-template is required for generate mode")
 	}
 
 	// Handle save command option
@@ -265,7 +639,7 @@ func main() {
 	}
 
 	// Handle missing API key gracefully
-	if cfg.AI.APIKey == "" {
+	if cfg.AI.APIKey == "" && !estimateOnly {
 		fmt.Println("⚠️  No API key found.")
 		fmt.Println("You can:")
 		fmt.Println("1. Set environment variable: export OPENAI_API_KEY=\"your-key\"")
@@ -307,6 +681,57 @@ func main() {
 	if opts.MaxTokens == 0 {
 		opts.MaxTokens = cfg.AI.MaxTokens
 	}
+	if opts.MaxFiles == 0 {
+		opts.MaxFiles = cfg.Budget.MaxFiles
+	}
+	if opts.MaxTotalTokens == 0 {
+		opts.MaxTotalTokens = cfg.Budget.MaxTotalTokens
+	}
+	if opts.MaxCost == 0 {
+		opts.MaxCost = cfg.Budget.MaxCost
+	}
+	if opts.OnConflict == "" {
+		opts.OnConflict = types.ConflictStrategy(cfg.Defaults.OnConflict)
+	}
+	switch opts.OnConflict {
+	case types.ConflictAbort, types.ConflictSibling, types.ConflictMerge:
+	default:
+		log.Fatalf("❌ Invalid conflict strategy: %s (use abort, sibling or merge)", opts.OnConflict)
+	}
+	if opts.OnExists == "" {
+		opts.OnExists = types.ExistsPolicy(cfg.Defaults.OnExists)
+	}
+	switch opts.OnExists {
+	case types.ExistsSkip, types.ExistsOverwrite, types.ExistsMerge:
+	default:
+		log.Fatalf("❌ Invalid on-exists policy: %s (use skip, overwrite or merge)", opts.OnExists)
+	}
+
+	if *noRedact {
+		cfg.Redaction.Enabled = false
+	}
+	if *skipSecrets {
+		cfg.Redaction.SkipFilesWithSecrets = true
+	}
+	if *noFileCtx {
+		cfg.FileContext.Enabled = false
+	}
+	if *noCache {
+		cfg.MapReduce.Cache = false
+	}
+
+	if estimateOnly {
+		offline, err := processor.NewOffline(cfg)
+		if err != nil {
+			log.Fatalf("❌ Failed to initialize processor: %v", err)
+		}
+		est, err := offline.Estimate(opts)
+		if err != nil {
+			log.Fatalf("❌ Estimate failed: %v", err)
+		}
+		ui.New(opts.Verbose).Estimate(est)
+		return
+	}
 
 	// Initialize processor
 	proc, err := processor.New(cfg)
@@ -314,6 +739,18 @@ func main() {
 		log.Fatalf("❌ Failed to initialize processor: %v", err)
 	}
 
+	// Answers stream to stdout; there are no files to summarize
+	if opts.Mode == types.ModeAsk {
+		result, err := proc.Ask(opts, os.Stdout)
+		if err != nil {
+			log.Fatalf("❌ Ask failed: %v", err)
+		}
+		if opts.Verbose {
+			fmt.Fprintf(os.Stderr, "🤖 %d AI tokens used, $%.3f\n", result.AITokensUsed, result.Cost)
+		}
+		return
+	}
+
 	// Process files
 	results, err := proc.ProcessPath(opts)
 	if err != nil {
@@ -322,6 +759,17 @@ func main() {
 
 	// Show results
 	showSummary(results, opts.Verbose)
+
+	if opts.Mode == types.ModeReview && !opts.DryRun {
+		if err := writeReviewReport(results, *reportFormat, opts.OutputPath, opts.Verbose); err != nil {
+			log.Fatalf("❌ Failed to write review report: %v", err)
+		}
+	}
+	if opts.Mode == types.ModeClassify && !opts.DryRun {
+		if err := writeClassifyReport(results, *reportFormat, opts.OutputPath, opts.Verbose); err != nil {
+			log.Fatalf("❌ Failed to write classify report: %v", err)
+		}
+	}
 }
 
 // // showSummary displays processing results
@@ -390,6 +838,68 @@ func showSummary(results []*types.ProcessingResult, verbose bool) {
 	ui.Summary(results)
 }
 
+// writeReviewReport renders the findings of a review run. Terminal reports
+// are printed; SARIF and GitHub reports go to outputPath, or stdout if empty.
+func writeReviewReport(results []*types.ProcessingResult, format, outputPath string, verbose bool) error {
+	findings := review.Collect(results)
+
+	var report []byte
+	switch format {
+	case review.FormatSARIF:
+		data, err := review.SARIF(findings, version)
+		if err != nil {
+			return err
+		}
+		report = append(data, '\n')
+	case review.FormatGitHub:
+		report = []byte(review.GitHub(findings))
+	default:
+		ui.New(verbose).ReviewReport(findings)
+		return nil
+	}
+
+	if outputPath == "" {
+		_, err := os.Stdout.Write(report)
+		return err
+	}
+	if err := os.WriteFile(outputPath, report, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("📝 %d findings written to %s\n", len(findings), outputPath)
+	return nil
+}
+
+// writeClassifyReport renders the labels of a classify run. Tables are
+// printed; JSON and CSV reports go to outputPath, or stdout if empty.
+func writeClassifyReport(results []*types.ProcessingResult, format, outputPath string, verbose bool) error {
+	entries := classify.Collect(results)
+
+	var report []byte
+	var err error
+	switch format {
+	case classify.FormatJSON:
+		report, err = classify.JSON(entries)
+	case classify.FormatCSV:
+		report, err = classify.CSV(entries)
+	default:
+		ui.New(verbose).ClassifyReport(results)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if outputPath == "" {
+		_, err := os.Stdout.Write(report)
+		return err
+	}
+	if err := os.WriteFile(outputPath, report, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("📝 %d classified files written to %s\n", len(entries), outputPath)
+	return nil
+}
+
 // handleSaveCommand saves current options as a command
 func handleSaveCommand(cmdManager *commands.Manager, name string, opts *types.ProcessingOptions) {
 	cmd := &types.Command{
@@ -399,18 +909,27 @@ func handleSaveCommand(cmdManager *commands.Manager, name string, opts *types.Pr
 		Prompt:      opts.AIPrompt,
 		PromptFile:  opts.PromptFile,
 		Options: types.CommandOptions{
-			OutputMode:      string(opts.OutputMode),
-			OutputSuffix:    opts.OutputSuffix,
-			FilePattern:     opts.FilePattern,
-			ExcludePattern:  opts.ExcludePattern,
-			ContextPatterns: opts.ContextPatterns,
-			ContextFiles:    opts.ContextFiles,
-			Recursive:       opts.Recursive,
-			RemoveComments:  opts.RemoveComments,
-			BackupOriginal:  opts.BackupOriginal,
-			Model:           opts.Model,
-			Temperature:     opts.Temperature,
-			MaxTokens:       opts.MaxTokens,
+			OutputMode:       string(opts.OutputMode),
+			OutputTemplate:   opts.OutputTemplate,
+			OnExists:         string(opts.OnExists),
+			MapPrompt:        opts.MapPrompt,
+			OutputSuffix:     opts.OutputSuffix,
+			FilePattern:      opts.FilePattern,
+			ExcludePattern:   opts.ExcludePattern,
+			ContextPatterns:  opts.ContextPatterns,
+			ContextFiles:     opts.ContextFiles,
+			AutoContext:      opts.AutoContext,
+			AutoContextDepth: opts.AutoContextDepth,
+			AutoContextFull:  opts.AutoContextFull,
+			ContextRepoMap:   opts.ContextRepoMap,
+			ContextCommands:  opts.ContextCommands,
+			ContextTemplates: opts.ContextTemplates,
+			Recursive:        opts.Recursive,
+			RemoveComments:   opts.RemoveComments,
+			BackupOriginal:   opts.BackupOriginal,
+			Model:            opts.Model,
+			Temperature:      opts.Temperature,
+			MaxTokens:        opts.MaxTokens,
 		},
 	}
 
@@ -488,19 +1007,181 @@ func handleEditCommand(cmdManager *commands.Manager, name string) {
 	fmt.Printf("Template: %+v\n", cmd)
 }
 
+// stringList is a flag that may be given several times
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ", ") }
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// handleRepoMap prints the repository map for a directory (default: the current project)
+func handleRepoMap(args []string) {
+	cfg, err := config.LoadConfig("")
+	if err != nil {
+		log.Fatalf("❌ Failed to load configuration: %v", err)
+	}
+
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	generator := repomap.New(repomap.Options{
+		ExcludeDirs: cfg.Filters.ExcludeDirs,
+		ExcludeExts: cfg.Filters.ExcludeExts,
+	})
+	content, err := generator.Build(utils.ProjectRoot(dir))
+	if err != nil {
+		log.Fatalf("❌ Failed to build repo map: %v", err)
+	}
+	fmt.Print(content)
+}
+
 func showHelpText() {
 	fmt.Printf(`Presto v%s - AI File Processor
 
 USAGE:
   presto [options]
+  presto ask "QUESTION" [options]
+  presto review [options]
+  presto classify --labels LIST [options]
+  presto records --prompt TEXT --output-field NAME [options]
 
 BASIC OPTIONS:
   --prompt TEXT           AI instruction text
   --cmd NAME             Use predefined command
   --input PATH           File or directory to process
-  --recursive            Process directories recursively
+  --recursive, -r        Process directories recursively
   --output MODE          Output mode: inplace|directory|separate|file|stdout|preview
   --dry-run              Preview without making changes
+  --on-conflict MODE     If a file changes mid-run: abort|sibling|merge
+  --estimate             Show projected tokens and cost without calling the API
+                         (also available as 'presto estimate [options]')
+
+CONTEXT:
+  --context FILES        Comma-separated files always sent as context; prefix
+                         a label with 'label:path' (e.g. docs:README.md)
+  --context-pattern PAT  Comma-separated globs ('**' spans directories) or
+                         regexes; matches are ranked by relevance to each
+                         input file and packed into the model window
+                         (overflow is outlined or truncated)
+  --context-cmd CMD      Run CMD and send its output as context; repeatable
+                         (e.g. --context-cmd "go test ./..." for failures).
+                         --dry-run and estimate list CMD without running it
+  --context-for TMPL     Attach a companion of each input file when it exists;
+                         repeatable. Variables: {{path}} {{relpath}} {{dir}}
+                         {{name}} {{stem}} {{ext}} {{parent}}
+                         (e.g. --context-for "{{dir}}/{{stem}}_test.go")
+  --context-budget N     Cap context at N tokens per request
+  --context-repomap      Send a file tree with exported symbols of the whole
+                         project (preview it with 'presto repomap [dir]')
+  --auto-context         Attach each file's local dependencies as context:
+                         same-module Go packages, relative JS/TS and Python
+                         imports (signatures only unless --auto-context-full)
+  --auto-context-depth N Import levels to follow (default 1)
+
+GENERATE:
+  --generate             Generate new content instead of transforming files
+  --output-file PATH     Write one output built from the context
+  --output-template TMPL Write one output per --input file instead, at TMPL
+                         (same variables as --context-for, e.g.
+                         "{{dir}}/{{stem}}_test{{ext}}" or "docs/{{relpath}}.md")
+  --on-exists POLICY     When a per-file output exists: skip (default),
+                         overwrite, or merge (send it along to be updated)
+  --map-prompt PROMPT    Run PROMPT on every --input and context file first
+                         (large files in chunks), then generate --output-file
+                         from the results; results are cached
+  --no-cache             Don't reuse or store cached map results
+
+STRUCTURED:
+  --select PATH          Rewrite only the JSON/YAML string values PATH matches;
+                         repeatable. JSONPath subset: $.a.b, [0], [*], *,
+                         ['key'] and .. for any depth (e.g. '$..description').
+                         Everything else, including YAML comments and key
+                         order, is kept
+  --section REGEX        Rewrite only the Markdown sections whose heading line
+                         matches REGEX (e.g. '^## Troubleshooting'), each in its
+                         own request; repeatable. Front matter, code blocks and
+                         all other text are kept byte for byte
+  --symbol NAME          Rewrite only this Go function, method (Type.Method),
+                         type, var or const, with its doc comment; repeatable
+  --lines START-END      Rewrite only these lines; repeatable. Each part is sent
+                         on its own with the rest of the file as read-only
+                         context and spliced back in place
+  --cells KIND           For Jupyter notebooks: code, markdown or all (default).
+                         Only cell sources are sent and rewritten; outputs and
+                         metadata are kept
+
+MULTI-FILE:
+  --multi                Let the AI create, replace and delete several files
+                         in one response. --input files are sent in full;
+                         paths must stay inside the project (git root or
+                         current directory). The changes are listed before
+                         they are applied; add --preview to confirm first
+
+ASK:
+  presto ask "QUESTION"  Stream a Markdown answer to stdout, citing files as
+                         path:line. --input files and --context are ranked by
+                         relevance to the question; nothing is written
+
+RECORDS:
+  presto records         Run --prompt on every CSV row, JSONL line or log entry
+                         of each --input file and write the results to a new
+                         column or field, in <name>.presto<ext> or --output-file.
+                         Logs are written as JSONL
+  --field LIST           Fields of each record to send (default all)
+  --output-field NAME    Column or field for the results
+  --batch N              Records per request (default: 20)
+  --record-format F      csv, jsonl or log (default: from the file extension)
+                         Finished records are saved to <output>.progress, so
+                         an interrupted or failed run picks up where it stopped
+
+CLASSIFY:
+  presto classify        Tag each --input file with one or more --labels and a
+                         confidence; nothing is written. --prompt adds guidance
+  --labels LIST          Comma-separated labels, each name or name:description
+                         (e.g. "glue,dead-code:unused or unreachable code")
+  --min-confidence N     Drop labels scored below N (0 to 1)
+  --format FORMAT        table (default), json or csv (to --output-file or stdout)
+  --tagged LIST          In any per-file mode, only process files that a saved
+                         classify report tags with one of these labels
+  --tags FILE            The json or csv classify report --tagged reads
+
+EXTRACT:
+  presto extract         Extract one JSON object per --input file, matching
+                         --schema, into --output-file; nothing else is written.
+                         --prompt says what to look for
+  --schema FILE          JSON Schema whose root is an object. Invalid responses
+                         are retried with the validation errors
+  --format FORMAT        json (default), jsonl or csv; taken from the
+                         --output-file extension when not given
+
+REVIEW:
+  presto review          Report findings (line range, severity, category,
+                         message) for each --input file; nothing is written.
+                         --prompt narrows the focus
+  --changed-since REF    Only process files changed since REF, including
+                         uncommitted and untracked files (any mode)
+  --format FORMAT        terminal (default), sarif (to --output-file) or
+                         github (Actions annotations)
+
+BUDGET:
+  --max-files N          Send at most N files to the AI
+  --max-total-tokens N   Stop once N tokens would be used
+  --max-cost USD         Stop once the projected cost would exceed USD
+
+PRIVACY:
+  Secrets (API keys, private keys, JWTs, values in .env and config files) and
+  personal data are replaced with placeholders before sending and restored in
+  the output.
+  --no-redact            Send content unmodified
+  --skip-secrets         Skip files that contain secrets entirely
+  --no-file-context      Leave out the current-file description block. Pick its
+                         fields under 'file_context' in ~/.presto/config.yaml
+                         or a project's .presto.yaml
 
 OUTPUT MODES:
   inplace                Modify original files (with --backup for safety)
@@ -526,6 +1207,39 @@ EXAMPLES:
   # Generate new content
   presto --generate --prompt "Create README" --context *.go --output-file README.md
 
+  # Reword every description in a config, keeping its comments and layout
+  presto --prompt "Rewrite for end users" --input config.yaml --select '$..description'
+
+  # Rewrite every Troubleshooting section of the docs
+  presto --prompt "Make the steps numbered and concise" --input docs -r --section '^## Troubleshooting'
+
+  # Document one method without touching the rest of the file
+  presto --prompt "Write a thorough doc comment" --input processor.go --symbol Processor.processFile
+
+  # Add docstrings to the code cells of a notebook
+  presto --prompt "Add docstrings and type hints" --input analysis.ipynb --cells code
+
+  # Ask about a codebase
+  presto ask "Where is the retry logic?" --input ./src -r
+
+  # Review your branch before opening a PR
+  presto review --changed-since main
+
+  # Categorize support tickets, 50 per request
+  presto records --input tickets.csv --field subject,body --output-field category \
+    --prompt "Categorize as billing, bug, feature-request or other" --batch 50
+
+  # Tag files, then document only those that need it
+  presto classify --labels "needs-docs,documented" --input ./src -r --format json --output-file tags.json
+  presto --cmd add-docs --input ./src -r --tagged needs-docs --tags tags.json
+
+  # Split a large file into a package
+  presto --multi --prompt "Split this into handlers.go, models.go and store.go" --input server.go --preview
+
+  # Generate a test file for each service
+  presto --generate --prompt "Write unit tests" --input ./services --exclude "_test\.go$" \
+    --output-template "{{dir}}/{{stem}}_test{{ext}}"
+
 Run 'presto --help-full' for complete options list.
 `, version)
 }
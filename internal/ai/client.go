@@ -5,20 +5,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"os/user"
-	"path/filepath"
-	"runtime"
 	"strings"
 	"time"
 
+	"github.com/Zachacious/presto/internal/redact"
 	"github.com/Zachacious/presto/pkg/types"
 )
 
+// responseToolName names the schema or tool used for structured output
+const responseToolName = "extraction"
+
 // Client handles AI API requests
 type Client struct {
 	config     *types.APIConfig
 	httpClient *http.Client
+	redactor   *redact.Redactor
 }
 
 // New creates a new AI client
@@ -31,6 +32,12 @@ func New(cfg *types.APIConfig) *Client {
 	}
 }
 
+// SetRedactor masks sensitive values in every prompt and restores them in
+// responses; nil disables redaction
+func (c *Client) SetRedactor(r *redact.Redactor) {
+	c.redactor = r
+}
+
 // ValidateConfig checks if the AI configuration is valid
 func (c *Client) ValidateConfig() error {
 	if c.config.APIKey == "" && c.config.Provider != types.ProviderLocal {
@@ -51,33 +58,43 @@ func (c *Client) ProcessContent(req types.AIRequest, contextFiles []*types.Conte
 
 	var fullContent strings.Builder
 	var totalTokens int
+	var inputTokens, outputTokens, cachedTokens int
 	var lastFinishReason string
+	req, contextFiles, redactions := c.redactSources(req, contextFiles)
 	currentPrompt := c.buildPrompt(req, contextFiles)
+	scope := "" // The file whose content the prompt quotes, once sources are redacted
 
 	for attempt := 0; attempt < MAX_CONTINUATIONS; attempt++ {
 		// Create API request based on provider
 		var apiResp APIResponse
 		var err error
 
+		outgoing, n := c.redactPrompt(currentPrompt, scope, redactions > 0)
+		redactions += n
+
 		switch c.config.Provider {
 		case types.ProviderOpenAI, types.ProviderLocal, types.ProviderCustom:
-			apiResp, err = c.sendOpenAIRequest(currentPrompt, req)
+			apiResp, err = c.sendOpenAIRequest(outgoing, req)
 		case types.ProviderAnthropic:
-			apiResp, err = c.sendAnthropicRequest(currentPrompt, req)
+			apiResp, err = c.sendAnthropicRequest(outgoing, req)
 		default:
-			apiResp, err = c.sendOpenAIRequest(currentPrompt, req)
+			apiResp, err = c.sendOpenAIRequest(outgoing, req)
 		}
 
 		if err != nil {
 			return nil, err
 		}
 
-		content := apiResp.GetContent()
+		content := c.restoreContent(apiResp.GetContent())
 		totalTokens += apiResp.GetTokensUsed()
+		in, out, cached := apiResp.GetUsage()
+		inputTokens += in
+		outputTokens += out
+		cachedTokens += cached
 		lastFinishReason = apiResp.GetFinishReason()
 
 		// Post-process the content to remove unwanted markdown formatting
-		if req.Mode == types.ModeTransform {
+		if wholeFile(req) {
 			content = c.postProcessContent(content, req.Language)
 		}
 
@@ -96,8 +113,8 @@ func (c *Client) ProcessContent(req types.AIRequest, contextFiles []*types.Conte
 			break
 		}
 
-		// For generate mode, don't continue (it's not a file completion)
-		if req.Mode == types.ModeGenerate {
+		// Only transforms continue; other responses aren't a single file
+		if !wholeFile(req) {
 			break
 		}
 
@@ -108,18 +125,85 @@ func (c *Client) ProcessContent(req types.AIRequest, contextFiles []*types.Conte
 
 		// Prepare continuation prompt
 		currentPrompt = c.BuildContinuationPrompt(fullContent.String(), req.Content, req)
+		scope = req.FileName
 	}
 
 	// Convert to standard response
 	return &types.AIResponse{
 		Content:      fullContent.String(),
 		TokensUsed:   totalTokens,
-		Model:        c.config.Model,
+		Model:        c.getModel(req.Model),
 		FinishReason: lastFinishReason,
 		Truncated:    !c.wasResponseComplete(lastFinishReason),
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		CachedTokens: cachedTokens,
+		Redactions:   redactions,
 	}, nil
 }
 
+// redactSources masks what the config-only detectors find in the .env and
+// config files of a request before its prompt is built. It returns the
+// request and context files to build it from and the number of values masked.
+func (c *Client) redactSources(req types.AIRequest, contextFiles []*types.ContextFile) (types.AIRequest, []*types.ContextFile, int) {
+	if c.redactor == nil {
+		return req, contextFiles, 0
+	}
+
+	total := 0
+	if redact.ConfigFile(req.FileName) {
+		var n int
+		req.Content, n = c.redactor.RedactFile(req.Content, req.FileName)
+		total += n
+	}
+	// The caller's context files are shared across requests; masked ones
+	// are copies
+	files := contextFiles
+	copied := false
+	for i, file := range contextFiles {
+		if !redact.ConfigFile(file.Path) {
+			continue
+		}
+		content, n := c.redactor.RedactFile(file.Content, file.Path)
+		if n == 0 {
+			continue
+		}
+		if !copied {
+			files = append([]*types.ContextFile{}, contextFiles...)
+			copied = true
+		}
+		masked := *file
+		masked.Content = content
+		files[i] = &masked
+		total += n
+	}
+	return req, files, total
+}
+
+// redactPrompt masks sensitive values in a prompt and tells the model to keep
+// the placeholders intact. scope names the file the prompt quotes, if it is
+// made of one file's content; masked is set when its sources were already
+// partly masked. It returns the prompt and the number of values masked.
+func (c *Client) redactPrompt(prompt, scope string, masked bool) (string, int) {
+	if c.redactor == nil {
+		return prompt, 0
+	}
+
+	redacted, n := c.redactor.RedactFile(prompt, scope)
+	if n == 0 && !masked {
+		return prompt, 0
+	}
+	return redacted + "\n\n" + redact.Instructions(), n
+}
+
+// restoreContent puts original values back in place of placeholders
+func (c *Client) restoreContent(content string) string {
+	if c.redactor == nil {
+		return content
+	}
+	return c.redactor.Restore(content)
+}
+
 // postProcessContent removes unwanted markdown formatting from AI responses
 func (c *Client) postProcessContent(content string, language types.Language) string {
 	// Don't process markdown files - they should keep their code blocks
@@ -131,6 +215,12 @@ func (c *Client) postProcessContent(content string, language types.Language) str
 	return c.removeOuterCodeBlock(content, language)
 }
 
+// CleanOutput strips a markdown code block wrapped around a whole response,
+// for generated files that are written as-is
+func (c *Client) CleanOutput(content string, language types.Language) string {
+	return c.postProcessContent(content, language)
+}
+
 // removeOuterCodeBlock safely removes outer markdown code block wrapping
 func (c *Client) removeOuterCodeBlock(content string, language types.Language) string {
 	content = strings.TrimSpace(content)
@@ -275,9 +365,9 @@ func (c *Client) buildPrompt(req types.AIRequest, contextFiles []*types.ContextF
 	var prompt bytes.Buffer
 
 	// Add current file context first (if we're transforming a specific file)
-	if req.Mode == types.ModeTransform && req.FileName != "" {
+	if wholeFile(req) && req.FileContext != "" {
 		prompt.WriteString("Current file being processed:\n")
-		prompt.WriteString(c.gatherFileContext(req.FileName))
+		prompt.WriteString(req.FileContext)
 		prompt.WriteString("\n")
 	}
 
@@ -296,19 +386,25 @@ func (c *Client) buildPrompt(req types.AIRequest, contextFiles []*types.ContextF
 	prompt.WriteString(req.Prompt)
 
 	// Add target content if transforming
-	if req.Mode == types.ModeTransform && req.Content != "" {
+	if wholeFile(req) && req.Content != "" {
 		prompt.WriteString("\n\nContent to transform:\n\n")
 		prompt.WriteString(req.Content)
 	}
 
 	// Add explicit instructions to prevent markdown formatting
-	if req.Mode == types.ModeTransform {
+	if wholeFile(req) {
 		prompt.WriteString("\n\n" + c.getOutputInstructions(req.Language))
 	}
 
 	return prompt.String()
 }
 
+// wholeFile reports whether a request is answered with the full new content
+// of one file, which is cleaned up, continued and framed as such
+func wholeFile(req types.AIRequest) bool {
+	return req.Mode == types.ModeTransform && !req.PerItem
+}
+
 // getOutputInstructions returns language-specific output instructions
 func (c *Client) getOutputInstructions(language types.Language) string {
 	var instructions bytes.Buffer
@@ -332,126 +428,11 @@ func (c *Client) getOutputInstructions(language types.Language) string {
 	return instructions.String()
 }
 
-// gatherFileContext collects useful context about the current file and environment
-func (c *Client) gatherFileContext(fileName string) string {
-	var context bytes.Buffer
-
-	// Current file info
-	context.WriteString(fmt.Sprintf("File: %s\n", fileName))
-
-	// File stats
-	if info, err := os.Stat(fileName); err == nil {
-		context.WriteString(fmt.Sprintf("Size: %d bytes\n", info.Size()))
-		context.WriteString(fmt.Sprintf("Last modified: %s\n", info.ModTime().Format("2006-01-02 15:04:05")))
-		context.WriteString(fmt.Sprintf("File mode: %s\n", info.Mode().String()))
-	}
-
-	// Current timestamp and timezone
-	now := time.Now()
-	context.WriteString(fmt.Sprintf("Processing time: %s\n", now.Format("2006-01-02 15:04:05 MST")))
-	context.WriteString(fmt.Sprintf("Timestamp: %d\n", now.Unix()))
-
-	// File path context
-	absPath, _ := filepath.Abs(fileName)
-	context.WriteString(fmt.Sprintf("Absolute path: %s\n", absPath))
-	context.WriteString(fmt.Sprintf("Directory: %s\n", filepath.Dir(absPath)))
-	context.WriteString(fmt.Sprintf("Base name: %s\n", filepath.Base(fileName)))
-	context.WriteString(fmt.Sprintf("Extension: %s\n", filepath.Ext(fileName)))
-
-	// Working directory
-	if wd, err := os.Getwd(); err == nil {
-		context.WriteString(fmt.Sprintf("Working directory: %s\n", wd))
-
-		// Check if we're in a git repository
-		if gitRoot := findGitRoot(wd); gitRoot != "" {
-			context.WriteString(fmt.Sprintf("Git repository: %s\n", gitRoot))
-			relPath, _ := filepath.Rel(gitRoot, absPath)
-			context.WriteString(fmt.Sprintf("Path from git root: %s\n", relPath))
-		}
-
-		// Check for common project files
-		projectContext := detectProjectContext(wd)
-		if projectContext != "" {
-			context.WriteString(fmt.Sprintf("Project type: %s\n", projectContext))
-		}
-	}
-
-	// System context
-	context.WriteString(fmt.Sprintf("OS: %s\n", runtime.GOOS))
-	context.WriteString(fmt.Sprintf("Architecture: %s\n", runtime.GOARCH))
-
-	// User context (if available)
-	if currentUser, err := user.Current(); err == nil {
-		context.WriteString(fmt.Sprintf("User: %s\n", currentUser.Username))
-	}
-
-	// Environment variables that might be relevant
-	if gopath := os.Getenv("GOPATH"); gopath != "" {
-		context.WriteString(fmt.Sprintf("GOPATH: %s\n", gopath))
-	}
-	if goroot := os.Getenv("GOROOT"); goroot != "" {
-		context.WriteString(fmt.Sprintf("GOROOT: %s\n", goroot))
-	}
-	if nodeEnv := os.Getenv("NODE_ENV"); nodeEnv != "" {
-		context.WriteString(fmt.Sprintf("NODE_ENV: %s\n", nodeEnv))
-	}
-
-	return context.String()
-}
-
-// findGitRoot walks up the directory tree to find the git repository root
-func findGitRoot(startPath string) string {
-	path := startPath
-	for {
-		gitDir := filepath.Join(path, ".git")
-		if info, err := os.Stat(gitDir); err == nil && info.IsDir() {
-			return path
-		}
-
-		parent := filepath.Dir(path)
-		if parent == path {
-			break // reached filesystem root
-		}
-		path = parent
-	}
-	return ""
-}
-
-// detectProjectContext tries to detect what kind of project this is
-func detectProjectContext(dir string) string {
-	var projectTypes []string
-
-	// Check for common project files
-	projectFiles := map[string]string{
-		"package.json":       "Node.js",
-		"go.mod":             "Go module",
-		"Cargo.toml":         "Rust",
-		"pom.xml":            "Maven/Java",
-		"build.gradle":       "Gradle/Java",
-		"requirements.txt":   "Python",
-		"Pipfile":            "Python/Pipenv",
-		"composer.json":      "PHP/Composer",
-		"Gemfile":            "Ruby/Bundler",
-		"Dockerfile":         "Docker",
-		"docker-compose.yml": "Docker Compose",
-		"Makefile":           "Make",
-		"CMakeLists.txt":     "CMake",
-	}
-
-	for file, projectType := range projectFiles {
-		if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
-			projectTypes = append(projectTypes, projectType)
-		}
-	}
-
-	return strings.Join(projectTypes, ", ")
-}
-
 // sendOpenAIRequest sends request to OpenAI-compatible API
 func (c *Client) sendOpenAIRequest(prompt string, req types.AIRequest) (APIResponse, error) {
 	// Build request
 	openAIReq := OpenAIRequest{
-		Model: c.config.Model,
+		Model: c.getModel(req.Model),
 		Messages: []OpenAIMessage{
 			{
 				Role:    "user",
@@ -462,24 +443,22 @@ func (c *Client) sendOpenAIRequest(prompt string, req types.AIRequest) (APIRespo
 		Temperature: c.getTemperature(req.Temperature),
 	}
 
-	// Marshal request
-	jsonData, err := json.Marshal(openAIReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	// Compatible servers differ in what they accept, so only OpenAI itself
+	// is sent the schema; the prompt and local validation cover the rest
+	if len(req.ResponseSchema) > 0 && c.config.Provider == types.ProviderOpenAI {
+		openAIReq.ResponseFormat = &OpenAIResponseFormat{
+			Type: "json_schema",
+			JSONSchema: &OpenAIJSONSchema{
+				Name:   responseToolName,
+				Schema: req.ResponseSchema,
+			},
+		}
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequest("POST", c.config.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	httpReq, err := c.newOpenAIHTTPRequest(openAIReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set headers
-	httpReq.Header.Set("Content-Type", "application/json")
-	if c.config.APIKey != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+		return nil, err
 	}
-	httpReq.Header.Set("User-Agent", "Presto/1.0")
 
 	// Send request
 	resp, err := c.httpClient.Do(httpReq)
@@ -506,7 +485,7 @@ func (c *Client) sendOpenAIRequest(prompt string, req types.AIRequest) (APIRespo
 func (c *Client) sendAnthropicRequest(prompt string, req types.AIRequest) (APIResponse, error) {
 	// Build request
 	anthropicReq := AnthropicRequest{
-		Model:       c.config.Model,
+		Model:       c.getModel(req.Model),
 		MaxTokens:   c.getMaxTokens(req.MaxTokens),
 		Temperature: c.getTemperature(req.Temperature),
 		Messages: []AnthropicMessage{
@@ -517,23 +496,21 @@ func (c *Client) sendAnthropicRequest(prompt string, req types.AIRequest) (APIRe
 		},
 	}
 
-	// Marshal request
-	jsonData, err := json.Marshal(anthropicReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	// Structured output comes back as the input of a forced tool call
+	if len(req.ResponseSchema) > 0 {
+		anthropicReq.Tools = []AnthropicTool{{
+			Name:        responseToolName,
+			Description: "Record the data extracted from the input.",
+			InputSchema: req.ResponseSchema,
+		}}
+		anthropicReq.ToolChoice = &AnthropicToolChoice{Type: "tool", Name: responseToolName}
 	}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequest("POST", c.config.BaseURL+"/messages", bytes.NewBuffer(jsonData))
+	httpReq, err := c.newAnthropicHTTPRequest(anthropicReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	// Set headers
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-API-Key", c.config.APIKey)
-	httpReq.Header.Set("anthropic-version", "2023-06-01")
-
 	// Send request
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -555,6 +532,44 @@ func (c *Client) sendAnthropicRequest(prompt string, req types.AIRequest) (APIRe
 	return &apiResp, nil
 }
 
+// newOpenAIHTTPRequest builds the HTTP request for an OpenAI-compatible chat completion
+func (c *Client) newOpenAIHTTPRequest(body OpenAIRequest) (*http.Request, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", c.config.BaseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.config.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
+	}
+	httpReq.Header.Set("User-Agent", "Presto/1.0")
+	return httpReq, nil
+}
+
+// newAnthropicHTTPRequest builds the HTTP request for an Anthropic message
+func (c *Client) newAnthropicHTTPRequest(body AnthropicRequest) (*http.Request, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", c.config.BaseURL+"/messages", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", c.config.APIKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+	return httpReq, nil
+}
+
 // NEW: Build continuation prompt
 func (c *Client) BuildContinuationPrompt(partialContent, originalContent string, req types.AIRequest) string {
 	var prompt bytes.Buffer
@@ -971,6 +986,13 @@ func min(a, b, c int) int {
 }
 
 // Helper methods
+func (c *Client) getModel(requestModel string) string {
+	if requestModel != "" {
+		return requestModel
+	}
+	return c.config.Model
+}
+
 func (c *Client) getMaxTokens(requestTokens int) int {
 	if requestTokens > 0 {
 		return requestTokens
@@ -993,14 +1015,37 @@ type APIResponse interface {
 	GetTokensUsed() int
 	GetFinishReason() string // ADD THIS
 	IsComplete() bool        // ADD THIS
+
+	// GetUsage returns uncached input, output and cached input tokens
+	GetUsage() (input, output, cached int)
 }
 
 // OpenAI API types
 type OpenAIRequest struct {
-	Model       string          `json:"model"`
-	Messages    []OpenAIMessage `json:"messages"`
-	MaxTokens   int             `json:"max_tokens,omitempty"`
-	Temperature float64         `json:"temperature,omitempty"`
+	Model          string                `json:"model"`
+	Messages       []OpenAIMessage       `json:"messages"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	Temperature    float64               `json:"temperature,omitempty"`
+	Stream         bool                  `json:"stream,omitempty"`
+	StreamOptions  *OpenAIStreamOptions  `json:"stream_options,omitempty"`
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// OpenAIResponseFormat constrains the response to a JSON Schema
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type OpenAIJSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict"` // Strict mode rejects most hand-written schemas
+}
+
+// OpenAIStreamOptions asks for token usage at the end of a stream
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type OpenAIMessage struct {
@@ -1019,7 +1064,14 @@ type OpenAIChoice struct {
 }
 
 type OpenAIUsage struct {
-	TotalTokens int `json:"total_tokens"`
+	PromptTokens        int                       `json:"prompt_tokens"`
+	CompletionTokens    int                       `json:"completion_tokens"`
+	TotalTokens         int                       `json:"total_tokens"`
+	PromptTokensDetails OpenAIPromptTokensDetails `json:"prompt_tokens_details"`
+}
+
+type OpenAIPromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
 }
 
 func (r *OpenAIResponse) GetContent() string {
@@ -1033,12 +1085,33 @@ func (r *OpenAIResponse) GetTokensUsed() int {
 	return r.Usage.TotalTokens
 }
 
+func (r *OpenAIResponse) GetUsage() (int, int, int) {
+	// OpenAI reports cached tokens as a subset of prompt tokens
+	cached := r.Usage.PromptTokensDetails.CachedTokens
+	return r.Usage.PromptTokens - cached, r.Usage.CompletionTokens, cached
+}
+
 // Anthropic API types
 type AnthropicRequest struct {
-	Model       string             `json:"model"`
-	MaxTokens   int                `json:"max_tokens"`
-	Temperature float64            `json:"temperature,omitempty"`
-	Messages    []AnthropicMessage `json:"messages"`
+	Model       string               `json:"model"`
+	MaxTokens   int                  `json:"max_tokens"`
+	Temperature float64              `json:"temperature,omitempty"`
+	Messages    []AnthropicMessage   `json:"messages"`
+	Stream      bool                 `json:"stream,omitempty"`
+	Tools       []AnthropicTool      `json:"tools,omitempty"`
+	ToolChoice  *AnthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+// AnthropicTool declares a tool; its input schema shapes structured output
+type AnthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type AnthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 type AnthropicMessage struct {
@@ -1053,16 +1126,24 @@ type AnthropicResponse struct {
 }
 
 type AnthropicContent struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type  string          `json:"type"`
+	Text  string          `json:"text"`
+	Input json.RawMessage `json:"input,omitempty"` // tool_use blocks
 }
 
 type AnthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens          int `json:"input_tokens"`
+	OutputTokens         int `json:"output_tokens"`
+	CacheReadInputTokens int `json:"cache_read_input_tokens"`
 }
 
 func (r *AnthropicResponse) GetContent() string {
+	// A tool call carries structured output, which wins over any text
+	for _, block := range r.Content {
+		if block.Type == "tool_use" {
+			return string(block.Input)
+		}
+	}
 	if len(r.Content) > 0 && r.Content[0].Type == "text" {
 		return r.Content[0].Text
 	}
@@ -1073,6 +1154,10 @@ func (r *AnthropicResponse) GetTokensUsed() int {
 	return r.Usage.InputTokens + r.Usage.OutputTokens
 }
 
+func (r *AnthropicResponse) GetUsage() (int, int, int) {
+	return r.Usage.InputTokens, r.Usage.OutputTokens, r.Usage.CacheReadInputTokens
+}
+
 func (r *OpenAIResponse) GetFinishReason() string {
 	if len(r.Choices) > 0 {
 		return r.Choices[0].FinishReason
@@ -1091,5 +1176,5 @@ func (r *AnthropicResponse) GetFinishReason() string {
 
 func (r *AnthropicResponse) IsComplete() bool {
 	reason := r.GetFinishReason()
-	return reason == "end_turn" || reason == "stop_sequence" || reason == ""
+	return reason == "end_turn" || reason == "stop_sequence" || reason == "tool_use" || reason == ""
 }
@@ -0,0 +1,242 @@
+package ai
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/redact"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// StreamContent sends a request and writes the answer to w as it arrives.
+// Placeholders of redacted values are restored before they are written. The
+// returned response holds the full answer and its token usage.
+func (c *Client) StreamContent(req types.AIRequest, contextFiles []*types.ContextFile, w io.Writer) (*types.AIResponse, error) {
+	req, contextFiles, masked := c.redactSources(req, contextFiles)
+	outgoing, redactions := c.redactPrompt(c.buildPrompt(req, contextFiles), "", masked > 0)
+	redactions += masked
+	out := &restoringWriter{w: w, restore: c.restoreContent}
+
+	var resp *streamResult
+	var err error
+	switch c.config.Provider {
+	case types.ProviderAnthropic:
+		resp, err = c.streamAnthropic(outgoing, req, out)
+	default:
+		resp, err = c.streamOpenAI(outgoing, req, out)
+	}
+	if err == nil {
+		err = out.flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.AIResponse{
+		Content:      out.written.String(),
+		TokensUsed:   resp.input + resp.cached + resp.output,
+		Model:        c.getModel(req.Model),
+		FinishReason: resp.finishReason,
+		Truncated:    !c.wasResponseComplete(resp.finishReason),
+		InputTokens:  resp.input,
+		OutputTokens: resp.output,
+		CachedTokens: resp.cached,
+		Redactions:   redactions,
+	}, nil
+}
+
+// streamResult is what a stream reports besides its text
+type streamResult struct {
+	finishReason          string
+	input, output, cached int
+}
+
+// streamOpenAI reads an OpenAI-compatible chat completion stream
+func (c *Client) streamOpenAI(prompt string, req types.AIRequest, out *restoringWriter) (*streamResult, error) {
+	body := OpenAIRequest{
+		Model:       c.getModel(req.Model),
+		Messages:    []OpenAIMessage{{Role: "user", Content: prompt}},
+		MaxTokens:   c.getMaxTokens(req.MaxTokens),
+		Temperature: c.getTemperature(req.Temperature),
+		Stream:      true,
+	}
+	// Compatible servers don't all accept stream options
+	if c.config.Provider == types.ProviderOpenAI {
+		body.StreamOptions = &OpenAIStreamOptions{IncludeUsage: true}
+	}
+
+	httpReq, err := c.newOpenAIHTTPRequest(body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &streamResult{}
+	err = c.readEvents(httpReq, func(data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to decode stream: %w", err)
+		}
+		if chunk.Usage != nil {
+			cached := chunk.Usage.PromptTokensDetails.CachedTokens
+			result.input = chunk.Usage.PromptTokens - cached
+			result.output = chunk.Usage.CompletionTokens
+			result.cached = cached
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		if reason := chunk.Choices[0].FinishReason; reason != "" {
+			result.finishReason = reason
+		}
+		return out.write(chunk.Choices[0].Delta.Content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// streamAnthropic reads an Anthropic message stream
+func (c *Client) streamAnthropic(prompt string, req types.AIRequest, out *restoringWriter) (*streamResult, error) {
+	httpReq, err := c.newAnthropicHTTPRequest(AnthropicRequest{
+		Model:       c.getModel(req.Model),
+		MaxTokens:   c.getMaxTokens(req.MaxTokens),
+		Temperature: c.getTemperature(req.Temperature),
+		Messages:    []AnthropicMessage{{Role: "user", Content: prompt}},
+		Stream:      true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &streamResult{}
+	err = c.readEvents(httpReq, func(data string) error {
+		var event AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to decode stream: %w", err)
+		}
+		switch event.Type {
+		case "message_start":
+			result.input = event.Message.Usage.InputTokens
+			result.cached = event.Message.Usage.CacheReadInputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" {
+				return out.write(event.Delta.Text)
+			}
+		case "message_delta":
+			result.finishReason = event.Delta.StopReason
+			result.output = event.Usage.OutputTokens
+		case "error":
+			return fmt.Errorf("stream failed: %s", event.Error.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readEvents sends a streaming request and passes the data of every
+// server-sent event to handle
+func (c *Client) readEvents(httpReq *http.Request, handle func(data string) error) error {
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API request failed with status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue // Event names, comments and blank separators
+		}
+		if err := handle(strings.TrimSpace(data)); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
+
+// restoringWriter restores placeholders in streamed text. A placeholder can
+// be split across chunks, so a possible start of one is held back until the
+// rest arrives.
+type restoringWriter struct {
+	w       io.Writer
+	restore func(string) string
+	pending string
+	written strings.Builder
+}
+
+func (rw *restoringWriter) write(text string) error {
+	rw.pending += text
+	cut := redact.Pending(rw.pending)
+	ready := rw.pending[:cut]
+	rw.pending = rw.pending[cut:]
+	return rw.emit(ready)
+}
+
+// flush writes whatever is still held back
+func (rw *restoringWriter) flush() error {
+	ready := rw.pending
+	rw.pending = ""
+	return rw.emit(ready)
+}
+
+func (rw *restoringWriter) emit(text string) error {
+	if text == "" {
+		return nil
+	}
+	text = rw.restore(text)
+	rw.written.WriteString(text)
+	if _, err := io.WriteString(rw.w, text); err != nil {
+		return fmt.Errorf("failed to write answer: %w", err)
+	}
+	return nil
+}
+
+// Streaming API types
+
+type OpenAIStreamChunk struct {
+	Choices []OpenAIStreamChoice `json:"choices"`
+	Usage   *OpenAIUsage         `json:"usage"`
+}
+
+type OpenAIStreamChoice struct {
+	Delta        OpenAIMessage `json:"delta"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+type AnthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage AnthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage AnthropicUsage `json:"usage"`
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
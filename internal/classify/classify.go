@@ -0,0 +1,144 @@
+package classify
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/schema"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// DefaultPrompt is used when a classification has no prompt of its own
+const DefaultPrompt = "Classify this file with the labels below."
+
+// labelName is what a label may be called; labels end up in file names,
+// CSV cells and --tagged lists, so they stay simple
+var labelName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Label is one label a file may be tagged with
+type Label struct {
+	Name        string
+	Description string
+}
+
+// Spec is the label set of a classify run
+type Spec struct {
+	Labels []Label
+	schema *schema.Schema
+}
+
+// New reads a label set. Each entry is a name, optionally followed by a
+// colon and a description of when the label applies.
+func New(entries []string) (*Spec, error) {
+	spec := &Spec{}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name, description, _ := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !labelName.MatchString(name) {
+			return nil, fmt.Errorf("invalid label %q: use letters, digits, '-', '_' and '.'", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate label %q", name)
+		}
+		seen[name] = true
+		spec.Labels = append(spec.Labels, Label{Name: name, Description: strings.TrimSpace(description)})
+	}
+	if len(spec.Labels) == 0 {
+		return nil, fmt.Errorf("no labels given")
+	}
+
+	names := make([]string, len(spec.Labels))
+	for i, label := range spec.Labels {
+		names[i] = label.Name
+	}
+	enum, _ := json.Marshal(names)
+	spec.schema = schema.MustParse(`{
+		"type": "object",
+		"required": ["labels"],
+		"additionalProperties": false,
+		"properties": {
+			"labels": {
+				"type": "array",
+				"minItems": 1,
+				"items": {
+					"type": "object",
+					"required": ["label", "confidence"],
+					"additionalProperties": false,
+					"properties": {
+						"label": {"type": "string", "enum": ` + string(enum) + `},
+						"confidence": {"type": "number", "minimum": 0, "maximum": 1}
+					}
+				}
+			}
+		}
+	}`)
+	return spec, nil
+}
+
+// Instructions describes the labels and the response format to the model
+func (s *Spec) Instructions() string {
+	var out strings.Builder
+	out.WriteString("=== LABELS ===\n")
+	for _, label := range s.Labels {
+		if label.Description != "" {
+			fmt.Fprintf(&out, "- %s: %s\n", label.Name, label.Description)
+		} else {
+			fmt.Fprintf(&out, "- %s\n", label.Name)
+		}
+	}
+	out.WriteString(`
+=== OUTPUT FORMAT ===
+Respond with a single JSON object and nothing else:
+
+{"labels": [{"label": "` + s.Labels[0].Name + `", "confidence": 0.9}]}
+
+Rules:
+- Give every label that applies, and at least one; use only the labels listed above
+- confidence is how sure you are that the label applies, from 0 to 1
+- Give each label once`)
+	return out.String()
+}
+
+// Parse reads the labels of one classify response, most confident first.
+// Labels scored below minConfidence are dropped; anything that doesn't
+// match the schema is an error.
+func (s *Spec) Parse(response string, minConfidence float64) ([]types.Label, error) {
+	_, data, err := s.schema.DecodeObject(response)
+	if err != nil {
+		return nil, err
+	}
+	var parsed struct {
+		Labels []types.Label `json:"labels"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	// A label given twice keeps its highest score
+	best := make(map[string]float64)
+	for _, label := range parsed.Labels {
+		if score, ok := best[label.Name]; !ok || label.Confidence > score {
+			best[label.Name] = label.Confidence
+		}
+	}
+	var labels []types.Label
+	for name, confidence := range best {
+		if confidence >= minConfidence {
+			labels = append(labels, types.Label{Name: name, Confidence: confidence})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].Confidence != labels[j].Confidence {
+			return labels[i].Confidence > labels[j].Confidence
+		}
+		return labels[i].Name < labels[j].Name
+	})
+	return labels, nil
+}
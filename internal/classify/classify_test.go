@@ -0,0 +1,129 @@
+package classify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		want    []Label
+		err     string
+	}{
+		{
+			name:    "names and descriptions",
+			entries: []string{"bug: something is broken", " docs ", ""},
+			want:    []Label{{Name: "bug", Description: "something is broken"}, {Name: "docs"}},
+		},
+		{name: "duplicate label", entries: []string{"bug", "bug: again"}, err: "duplicate label"},
+		{name: "invalid name", entries: []string{"has space"}, err: "invalid label"},
+		{name: "no labels", entries: []string{"", " : only a description"}, err: "no labels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := New(tt.entries)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if len(spec.Labels) != len(tt.want) {
+				t.Fatalf("got %v, want %v", spec.Labels, tt.want)
+			}
+			for i := range tt.want {
+				if spec.Labels[i] != tt.want[i] {
+					t.Errorf("label %d: got %v, want %v", i, spec.Labels[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	spec, err := New([]string{"bug", "docs", "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		response      string
+		minConfidence float64
+		want          []types.Label
+		wantErr       bool
+	}{
+		{
+			name:     "most confident first",
+			response: `{"labels": [{"label": "docs", "confidence": 0.4}, {"label": "bug", "confidence": 0.9}]}`,
+			want:     []types.Label{{Name: "bug", Confidence: 0.9}, {Name: "docs", Confidence: 0.4}},
+		},
+		{
+			name:     "ties by name",
+			response: `{"labels": [{"label": "test", "confidence": 0.5}, {"label": "docs", "confidence": 0.5}]}`,
+			want:     []types.Label{{Name: "docs", Confidence: 0.5}, {Name: "test", Confidence: 0.5}},
+		},
+		{
+			name:     "duplicate label keeps its highest score",
+			response: `{"labels": [{"label": "bug", "confidence": 0.3}, {"label": "bug", "confidence": 0.8}, {"label": "bug", "confidence": 0.5}]}`,
+			want:     []types.Label{{Name: "bug", Confidence: 0.8}},
+		},
+		{
+			name:          "min-confidence drops low scores",
+			response:      `{"labels": [{"label": "bug", "confidence": 0.7}, {"label": "docs", "confidence": 0.2}]}`,
+			minConfidence: 0.5,
+			want:          []types.Label{{Name: "bug", Confidence: 0.7}},
+		},
+		{
+			name:          "min-confidence is inclusive",
+			response:      `{"labels": [{"label": "bug", "confidence": 0.5}]}`,
+			minConfidence: 0.5,
+			want:          []types.Label{{Name: "bug", Confidence: 0.5}},
+		},
+		{
+			name:          "everything below min-confidence",
+			response:      `{"labels": [{"label": "bug", "confidence": 0.1}]}`,
+			minConfidence: 0.5,
+			want:          nil,
+		},
+		{
+			name:     "fenced response",
+			response: "```json\n{\"labels\": [{\"label\": \"test\", \"confidence\": 1}]}\n```",
+			want:     []types.Label{{Name: "test", Confidence: 1}},
+		},
+		{name: "unknown label", response: `{"labels": [{"label": "feature", "confidence": 0.9}]}`, wantErr: true},
+		{name: "confidence out of range", response: `{"labels": [{"label": "bug", "confidence": 1.5}]}`, wantErr: true},
+		{name: "no labels", response: `{"labels": []}`, wantErr: true},
+		{name: "missing confidence", response: `{"labels": [{"label": "bug"}]}`, wantErr: true},
+		{name: "extra field", response: `{"labels": [{"label": "bug", "confidence": 0.9}], "why": "x"}`, wantErr: true},
+		{name: "not JSON", response: "bug", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := spec.Parse(tt.response, tt.minConfidence)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("label %d: got %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
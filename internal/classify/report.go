@@ -0,0 +1,141 @@
+package classify
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// Report formats
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+)
+
+// Entry is the classification of one file
+type Entry struct {
+	File   string        `json:"file"`
+	Labels []types.Label `json:"labels"`
+}
+
+// Collect gathers the classifications of a run in file order. Files that
+// failed or were skipped are left out.
+func Collect(results []*types.ProcessingResult) []Entry {
+	var entries []Entry
+	for _, result := range results {
+		if !result.Success || result.Mode != types.ModeClassify {
+			continue
+		}
+		labels := result.Labels
+		if labels == nil {
+			labels = []types.Label{}
+		}
+		entries = append(entries, Entry{File: filepath.ToSlash(result.InputFile), Labels: labels})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].File < entries[j].File
+	})
+	return entries
+}
+
+// JSON renders entries as an indented JSON array
+func JSON(entries []Entry) ([]byte, error) {
+	if entries == nil {
+		entries = []Entry{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// CSV renders entries with one row per file and label. A file left with no
+// label gets a row with empty label and confidence.
+func CSV(entries []Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"file", "label", "confidence"})
+	for _, entry := range entries {
+		if len(entry.Labels) == 0 {
+			w.Write([]string{entry.File, "", ""})
+		}
+		for _, label := range entry.Labels {
+			w.Write([]string{entry.File, label.Name, strconv.FormatFloat(label.Confidence, 'f', -1, 64)})
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// Tagged reads a JSON or CSV report written by classify and returns the
+// absolute paths of the files tagged with any of labels. Relative paths
+// are taken as relative to the working directory, as classify writes them.
+func Tagged(path string, labels []string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+
+	var entries []Entry
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		entries, err = parseCSV(data)
+	} else {
+		err = json.Unmarshal(data, &entries)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid tags file %s: %w", path, err)
+	}
+
+	wanted := make(map[string]bool)
+	for _, label := range labels {
+		wanted[label] = true
+	}
+	files := make(map[string]bool)
+	for _, entry := range entries {
+		for _, label := range entry.Labels {
+			if !wanted[label.Name] {
+				continue
+			}
+			abs, err := filepath.Abs(filepath.FromSlash(entry.File))
+			if err != nil {
+				return nil, err
+			}
+			files[abs] = true
+		}
+	}
+	return files, nil
+}
+
+// parseCSV reads the rows written by CSV back into entries
+func parseCSV(data []byte) ([]Entry, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 2 || rows[0][0] != "file" || rows[0][1] != "label" {
+		return nil, fmt.Errorf("expected a header row starting with file,label")
+	}
+
+	var entries []Entry
+	for _, row := range rows[1:] {
+		if len(row) < 2 || row[1] == "" {
+			continue
+		}
+		var confidence float64
+		if len(row) > 2 {
+			confidence, _ = strconv.ParseFloat(row[2], 64)
+		}
+		entries = append(entries, Entry{File: row[0], Labels: []types.Label{{Name: row[1], Confidence: confidence}}})
+	}
+	return entries, nil
+}
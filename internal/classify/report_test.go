@@ -0,0 +1,120 @@
+package classify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	entries := []Entry{
+		{File: "a.go", Labels: []types.Label{{Name: "bug", Confidence: 0.9}, {Name: "docs", Confidence: 0.25}}},
+		{File: "dir/b, c.go", Labels: []types.Label{{Name: "test", Confidence: 1}}},
+		{File: "empty.go", Labels: []types.Label{}},
+	}
+	data, err := CSV(entries)
+	if err != nil {
+		t.Fatalf("CSV: %v", err)
+	}
+	want := "file,label,confidence\na.go,bug,0.9\na.go,docs,0.25\n\"dir/b, c.go\",test,1\nempty.go,,\n"
+	if string(data) != want {
+		t.Errorf("CSV got:\n%s\nwant:\n%s", data, want)
+	}
+
+	// Rows come back one label each, and files with no label are left out
+	parsed, err := parseCSV(data)
+	if err != nil {
+		t.Fatalf("parseCSV: %v", err)
+	}
+	wantParsed := []Entry{
+		{File: "a.go", Labels: []types.Label{{Name: "bug", Confidence: 0.9}}},
+		{File: "a.go", Labels: []types.Label{{Name: "docs", Confidence: 0.25}}},
+		{File: "dir/b, c.go", Labels: []types.Label{{Name: "test", Confidence: 1}}},
+	}
+	if !reflect.DeepEqual(parsed, wantParsed) {
+		t.Errorf("parseCSV got %v, want %v", parsed, wantParsed)
+	}
+}
+
+func TestParseCSVHeader(t *testing.T) {
+	for _, data := range []string{"", "path,label\na.go,bug\n", "file\na.go\n"} {
+		if _, err := parseCSV([]byte(data)); err == nil {
+			t.Errorf("parseCSV(%q) accepted a file without a file,label header", data)
+		}
+	}
+}
+
+func TestTagged(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	abs := filepath.Join(dir, "abs.go")
+
+	entries := []Entry{
+		{File: "a.go", Labels: []types.Label{{Name: "bug", Confidence: 0.9}}},
+		{File: "sub/b.go", Labels: []types.Label{{Name: "docs", Confidence: 0.5}, {Name: "bug", Confidence: 0.4}}},
+		{File: "c.go", Labels: []types.Label{{Name: "test", Confidence: 1}}},
+		{File: filepath.ToSlash(abs), Labels: []types.Label{{Name: "docs", Confidence: 0.8}}},
+		{File: "none.go", Labels: []types.Label{}},
+	}
+	jsonData, err := JSON(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvData, err := CSV(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("tags.json", jsonData, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("tags.CSV", csvData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		labels []string
+		want   []string
+	}{
+		{"one label", []string{"bug"}, []string{"a.go", filepath.Join("sub", "b.go")}},
+		{"any of several labels", []string{"docs", "test"}, []string{filepath.Join("sub", "b.go"), "c.go", abs}},
+		{"unused label", []string{"feature"}, nil},
+	}
+	for _, path := range []string{"tags.json", "tags.CSV"} {
+		for _, tt := range tests {
+			t.Run(path+"/"+tt.name, func(t *testing.T) {
+				got, err := Tagged(path, tt.labels)
+				if err != nil {
+					t.Fatalf("Tagged: %v", err)
+				}
+				want := make(map[string]bool)
+				for _, file := range tt.want {
+					if !filepath.IsAbs(file) {
+						file = filepath.Join(dir, file)
+					}
+					want[file] = true
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestTaggedErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Tagged(filepath.Join(dir, "missing.json"), []string{"bug"}); err == nil {
+		t.Error("missing tags file accepted")
+	}
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Tagged(bad, []string{"bug"}); err == nil {
+		t.Error("invalid tags file accepted")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/Zachacious/presto/internal/utils"
 	"github.com/Zachacious/presto/pkg/types"
 	"gopkg.in/yaml.v3"
 )
@@ -150,6 +151,18 @@ func (m *Manager) ApplyCommand(name string, opts *types.ProcessingOptions) error
 	if cmd.Options.OutputSuffix != "" {
 		opts.OutputSuffix = cmd.Options.OutputSuffix
 	}
+	if cmd.Options.OutputTemplate != "" {
+		if err := utils.ValidatePathTemplate(cmd.Options.OutputTemplate); err != nil {
+			return fmt.Errorf("command %s: invalid output template: %w", name, err)
+		}
+		opts.OutputTemplate = cmd.Options.OutputTemplate
+	}
+	if cmd.Options.OnExists != "" {
+		opts.OnExists = types.ExistsPolicy(cmd.Options.OnExists)
+	}
+	if cmd.Options.MapPrompt != "" {
+		opts.MapPrompt = cmd.Options.MapPrompt
+	}
 	if cmd.Options.FilePattern != "" {
 		opts.FilePattern = cmd.Options.FilePattern
 	}
@@ -162,6 +175,29 @@ func (m *Manager) ApplyCommand(name string, opts *types.ProcessingOptions) error
 	if len(cmd.Options.ContextFiles) > 0 {
 		opts.ContextFiles = append(opts.ContextFiles, cmd.Options.ContextFiles...)
 	}
+	if cmd.Options.AutoContext {
+		opts.AutoContext = cmd.Options.AutoContext
+	}
+	if cmd.Options.AutoContextDepth != 0 {
+		opts.AutoContextDepth = cmd.Options.AutoContextDepth
+	}
+	if cmd.Options.AutoContextFull {
+		opts.AutoContextFull = cmd.Options.AutoContextFull
+	}
+	if len(cmd.Options.ContextCommands) > 0 {
+		opts.ContextCommands = append(opts.ContextCommands, cmd.Options.ContextCommands...)
+	}
+	if len(cmd.Options.ContextTemplates) > 0 {
+		for _, tmpl := range cmd.Options.ContextTemplates {
+			if err := utils.ValidatePathTemplate(tmpl); err != nil {
+				return fmt.Errorf("command %s: invalid context template: %w", name, err)
+			}
+		}
+		opts.ContextTemplates = append(opts.ContextTemplates, cmd.Options.ContextTemplates...)
+	}
+	if cmd.Options.ContextRepoMap {
+		opts.ContextRepoMap = cmd.Options.ContextRepoMap
+	}
 	if cmd.Options.Recursive {
 		opts.Recursive = cmd.Options.Recursive
 	}
@@ -321,6 +357,7 @@ func (m *Manager) loadBuiltinCommands() error {
 			Prompt:      "Create a comprehensive summary of the content in the context files. Include key points, main concepts, and important details in a well-organized format.",
 			Options: types.CommandOptions{
 				OutputMode: "file",
+				MapPrompt:  "Summarize this content: its purpose, key points and important details.",
 			},
 		},
 		{
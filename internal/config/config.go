@@ -4,17 +4,109 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 
+	"github.com/Zachacious/presto/internal/utils"
 	"github.com/Zachacious/presto/pkg/types"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	AI       types.APIConfig `yaml:"ai"`
-	Defaults DefaultsConfig  `yaml:"defaults"`
-	Filters  FiltersConfig   `yaml:"filters"`
+	AI          types.APIConfig       `yaml:"ai"`
+	Defaults    DefaultsConfig        `yaml:"defaults"`
+	Filters     FiltersConfig         `yaml:"filters"`
+	Pricing     map[string]ModelPrice `yaml:"pricing"` // Keyed by model name; also covers its dated releases
+	Budget      BudgetConfig          `yaml:"budget"`
+	Redaction   RedactionConfig       `yaml:"redaction"`
+	FileContext FileContextConfig     `yaml:"file_context"`
+	Context     ContextConfig         `yaml:"context"`
+	MapReduce   MapReduceConfig       `yaml:"map_reduce"`
+}
+
+// MapReduceConfig controls generate runs with a map prompt
+type MapReduceConfig struct {
+	ChunkTokens int    `yaml:"chunk_tokens"` // Largest piece of a file sent to one map request
+	Cache       bool   `yaml:"cache"`        // Reuse map and combine results across runs; never pruned
+	CacheDir    string `yaml:"cache_dir"`    // Defaults to ~/.presto/cache
+}
+
+// ContextConfig controls how context files are fitted into each request
+type ContextConfig struct {
+	MaxTokens int            `yaml:"max_tokens"` // Cap on context tokens per request; 0 uses whatever the window allows
+	Windows   map[string]int `yaml:"windows"`    // Context window in tokens, keyed by model name or prefix
+
+	// Limits for --context-cmd output
+	CommandTimeout  int `yaml:"command_timeout"`   // Seconds
+	CommandMaxBytes int `yaml:"command_max_bytes"` // Output kept per command
+}
+
+// defaultContextWindow is assumed for models without a configured window
+const defaultContextWindow = 32000
+
+// FileContextConfig controls the block describing the current file that
+// precedes each transform prompt
+type FileContextConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Fields   []string `yaml:"fields"`   // Lines to include; see filecontext.Fields
+	Template string   `yaml:"template"` // text/template; overrides Fields when set
+}
+
+// ProjectConfigFile is the per-project override file, looked up from the
+// working directory up to the repository root
+const ProjectConfigFile = ".presto.yaml"
+
+// projectConfig lists the settings a project file may override. It is kept
+// narrow on purpose: a checked-out repository must not be able to redirect
+// API traffic or credentials.
+type projectConfig struct {
+	FileContext *FileContextConfig `yaml:"file_context"`
+}
+
+// projectFileContextFields are the file context fields a project file may
+// select. Fields that read the environment or reveal the user or absolute
+// paths, and templates, which can reach them all, are only honoured from the
+// user's own config, as is time, which would defeat prompt caching.
+var projectFileContextFields = map[string]bool{
+	"path": true, "dir": true, "base": true, "ext": true, "language": true,
+	"size": true, "modified": true, "mode": true, "git_path": true,
+	"project": true, "package": true, "siblings": true, "readme": true,
+	"os": true, "arch": true,
+}
+
+// RedactionConfig controls masking of secrets and personal data before
+// content is sent to the provider
+type RedactionConfig struct {
+	Enabled              bool              `yaml:"enabled"`
+	Detectors            []string          `yaml:"detectors"` // Built-in detector names; empty enables all. env_secret only runs on .env and config files
+	Patterns             map[string]string `yaml:"patterns"`  // Custom detectors: name -> regex
+	SkipFilesWithSecrets bool              `yaml:"skip_files_with_secrets"`
+}
+
+// BudgetConfig contains default run limits; zero means unlimited
+type BudgetConfig struct {
+	MaxFiles       int     `yaml:"max_files"`
+	MaxTotalTokens int     `yaml:"max_total_tokens"`
+	MaxCost        float64 `yaml:"max_cost"` // USD per run
+}
+
+// ModelPrice holds per-model token prices in USD per million tokens
+type ModelPrice struct {
+	Input       float64 `yaml:"input"`
+	Output      float64 `yaml:"output"`
+	CachedInput float64 `yaml:"cached_input"`
+}
+
+// Cost returns the dollar cost of a request. Cached tokens are billed
+// separately from (not as part of) input tokens.
+func (mp ModelPrice) Cost(input, output, cached int) float64 {
+	cachedRate := mp.CachedInput
+	if cachedRate == 0 {
+		cachedRate = mp.Input
+	}
+	return (float64(input)*mp.Input + float64(output)*mp.Output + float64(cached)*cachedRate) / 1_000_000
 }
 
 // DefaultsConfig contains default processing options
@@ -25,6 +117,8 @@ type DefaultsConfig struct {
 	BackupOriginal bool   `yaml:"backup_original"`
 	RemoveComments bool   `yaml:"remove_comments"`
 	FilePattern    string `yaml:"file_pattern"`
+	OnConflict     string `yaml:"on_conflict"` // abort|sibling|merge
+	OnExists       string `yaml:"on_exists"`   // skip|overwrite|merge, for per-file generate
 }
 
 // FiltersConfig contains file filtering options
@@ -47,6 +141,8 @@ func DefaultConfig() *Config {
 			BackupOriginal: true,
 			RemoveComments: false,
 			FilePattern:    "",
+			OnConflict:     string(types.ConflictAbort),
+			OnExists:       string(types.ExistsSkip),
 		},
 		Filters: FiltersConfig{
 			MaxFileSize: 1024 * 1024, // 1MB
@@ -69,7 +165,98 @@ func DefaultConfig() *Config {
 			IncludeExts:  []string{},
 			ExcludeFiles: []string{"*.min.*", "*.bundle.*", "*-lock.*"},
 		},
+		Pricing: map[string]ModelPrice{
+			"gpt-4.1":           {Input: 2.00, Output: 8.00, CachedInput: 0.50},
+			"gpt-4.1-mini":      {Input: 0.40, Output: 1.60, CachedInput: 0.10},
+			"gpt-4.1-nano":      {Input: 0.10, Output: 0.40, CachedInput: 0.025},
+			"gpt-4o":            {Input: 2.50, Output: 10.00, CachedInput: 1.25},
+			"gpt-4o-mini":       {Input: 0.15, Output: 0.60, CachedInput: 0.075},
+			"gpt-4-turbo":       {Input: 10.00, Output: 30.00},
+			"gpt-4":             {Input: 30.00, Output: 60.00},
+			"gpt-3.5-turbo":     {Input: 0.50, Output: 1.50},
+			"claude-3-5-sonnet": {Input: 3.00, Output: 15.00, CachedInput: 0.30},
+			"claude-3-7-sonnet": {Input: 3.00, Output: 15.00, CachedInput: 0.30},
+			"claude-sonnet-4":   {Input: 3.00, Output: 15.00, CachedInput: 0.30},
+			"claude-3-5-haiku":  {Input: 0.80, Output: 4.00, CachedInput: 0.08},
+			"claude-3-haiku":    {Input: 0.25, Output: 1.25, CachedInput: 0.03},
+			"claude-3-opus":     {Input: 15.00, Output: 75.00, CachedInput: 1.50},
+			"claude-opus-4":     {Input: 15.00, Output: 75.00, CachedInput: 1.50},
+		},
+		Redaction: RedactionConfig{
+			Enabled: true,
+		},
+		MapReduce: MapReduceConfig{
+			ChunkTokens: 8000,
+			Cache:       true,
+		},
+		Context: ContextConfig{
+			CommandTimeout:  30,
+			CommandMaxBytes: 64 * 1024,
+			Windows: map[string]int{
+				"gpt-4.1":       1047576,
+				"gpt-4o":        128000,
+				"gpt-4-turbo":   128000,
+				"gpt-4":         8192,
+				"gpt-3.5-turbo": 16385,
+				"o1":            200000,
+				"o3":            200000,
+				"o4":            200000,
+				"claude":        200000,
+			},
+		},
+		FileContext: FileContextConfig{
+			Enabled: true,
+			Fields:  []string{"path", "language", "project", "package"},
+		},
+	}
+}
+
+// PriceFor returns the price entry for a model. Exact names win; otherwise a
+// configured name only covers releases of that model, such as
+// "claude-3-5-sonnet-20241022" or "gpt-4o-2024-08-06", never a different
+// model that happens to share the prefix, like gpt-4.5 for gpt-4.
+func (c *Config) PriceFor(model string) (ModelPrice, bool) {
+	return lookupModel(c.Pricing, model, isRelease)
+}
+
+// ContextWindowFor returns the context window of a model in tokens, matched
+// by exact name or else the longest configured prefix, falling back to a
+// conservative default
+func (c *Config) ContextWindowFor(model string) int {
+	if window, ok := lookupModel(c.Context.Windows, model, strings.HasPrefix); ok && window > 0 {
+		return window
+	}
+	return defaultContextWindow
+}
+
+// releaseSuffix matches what providers append to a model name for a dated
+// or versioned release of it
+var releaseSuffix = regexp.MustCompile(`^(?:-\d{4}-\d{2}-\d{2}|-\d{8}|-\d{4}|@\d{8}|-v\d+(?:[.:]\d+)*|-latest)$`)
+
+// isRelease reports whether model is name or a release of it
+func isRelease(model, name string) bool {
+	rest, ok := strings.CutPrefix(model, name)
+	return ok && (rest == "" || releaseSuffix.MatchString(rest))
+}
+
+// lookupModel finds a model's entry by exact name, then by the longest name
+// that match accepts for it
+func lookupModel[T any](entries map[string]T, model string, match func(model, name string) bool) (T, bool) {
+	if entry, ok := entries[model]; ok {
+		return entry, true
 	}
+
+	var best string
+	for name := range entries {
+		if match(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		var zero T
+		return zero, false
+	}
+	return entries[best], true
 }
 
 // LoadConfig loads configuration from file with environment variable fallbacks
@@ -92,12 +279,79 @@ func LoadConfig(configPath string) (*Config, error) {
 		}
 	}
 
+	// Apply project-level overrides
+	if err := cfg.applyProjectConfig(); err != nil {
+		return nil, err
+	}
+
 	// Apply environment variable overrides
 	cfg.applyEnvOverrides()
 
 	return cfg, nil
 }
 
+// applyProjectConfig merges the nearest project file over the loaded config
+func (c *Config) applyProjectConfig() error {
+	path := findProjectConfig()
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read project config: %w", err)
+	}
+
+	// Decode over a copy of the loaded config so unset keys keep their values
+	fileContext := c.FileContext
+	project := projectConfig{FileContext: &fileContext}
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return fmt.Errorf("failed to parse project config %s: %w", path, err)
+	}
+
+	// Whether anything is sent at all stays the user's choice
+	if fileContext.Enabled != c.FileContext.Enabled {
+		return fmt.Errorf("project config %s: file_context.enabled can only be set in the user config", path)
+	}
+	if fileContext.Template != c.FileContext.Template {
+		return fmt.Errorf("project config %s: file_context.template can only be set in the user config", path)
+	}
+	if !slices.Equal(fileContext.Fields, c.FileContext.Fields) {
+		for _, field := range fileContext.Fields {
+			if !projectFileContextFields[field] {
+				return fmt.Errorf("project config %s: file_context field %q can only be set in the user config", path, field)
+			}
+		}
+	}
+
+	c.FileContext = fileContext
+	return nil
+}
+
+// findProjectConfig walks up from the working directory to the repository
+// root looking for the project config file
+func findProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+
+	// Don't look past the repository root
+	root := utils.GitRoot(dir)
+	for {
+		path := filepath.Join(dir, ProjectConfigFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
 // applyEnvOverrides applies environment variable overrides
 func (c *Config) applyEnvOverrides() {
 	// Try multiple environment variable names for compatibility
@@ -325,6 +579,12 @@ func ValidateConfig(cfg *Config) error {
 	if cfg.AI.Model == "" {
 		return fmt.Errorf("model is required")
 	}
+	if cfg.Context.CommandTimeout <= 0 {
+		return fmt.Errorf("context.command_timeout must be a positive number of seconds")
+	}
+	if cfg.Context.CommandMaxBytes <= 0 {
+		return fmt.Errorf("context.command_max_bytes must be positive")
+	}
 	return nil
 }
 
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestApplyProjectConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+		want    []string
+		wantErr bool
+	}{
+		{"safe fields", "file_context:\n  fields: [path, package, readme]\n", []string{"path", "package", "readme"}, false},
+		{"unset keys kept", "file_context:\n  enabled: false\n", []string{"path"}, false},
+		{"enable", "file_context:\n  enabled: true\n  fields: [path, siblings, readme]\n", nil, true},
+		{"time", "file_context:\n  fields: [path, time]\n", nil, true},
+		{"environment", "file_context:\n  fields: [path, \"env:AWS_SECRET_ACCESS_KEY\"]\n", nil, true},
+		{"user", "file_context:\n  fields: [user]\n", nil, true},
+		{"absolute path", "file_context:\n  fields: [abs_path]\n", nil, true},
+		{"template", "file_context:\n  template: \"{{.User}}\"\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, ProjectConfigFile), []byte(tt.project), 0644); err != nil {
+				t.Fatal(err)
+			}
+			t.Chdir(dir)
+
+			cfg := &Config{FileContext: FileContextConfig{Fields: []string{"path"}}}
+			err := cfg.applyProjectConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got fields %v", cfg.FileContext.Fields)
+				}
+				if cfg.FileContext.Enabled || cfg.FileContext.Template != "" || !slices.Equal(cfg.FileContext.Fields, []string{"path"}) {
+					t.Errorf("rejected project config was applied: %+v", cfg.FileContext)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyProjectConfig: %v", err)
+			}
+			if !slices.Equal(cfg.FileContext.Fields, tt.want) {
+				t.Errorf("fields = %v, want %v", cfg.FileContext.Fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigContextCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeout  int
+		maxBytes int
+		wantErr  bool
+	}{
+		{"defaults", 30, 64 * 1024, false},
+		{"zero timeout", 0, 64 * 1024, true},
+		{"negative timeout", -1, 64 * 1024, true},
+		{"zero max bytes", 30, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.AI.APIKey = "key"
+			cfg.Context.CommandTimeout = tt.timeout
+			cfg.Context.CommandMaxBytes = tt.maxBytes
+			if err := ValidateConfig(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPriceFor(t *testing.T) {
+	cfg := DefaultConfig()
+	tests := []struct {
+		model string
+		want  string // The entry it should be priced as, or "" for none
+	}{
+		{"gpt-4o", "gpt-4o"},
+		{"gpt-4o-mini", "gpt-4o-mini"},
+		{"gpt-4o-2024-08-06", "gpt-4o"},
+		{"gpt-4o-mini-2024-07-18", "gpt-4o-mini"},
+		{"gpt-4-0613", "gpt-4"},
+		{"claude-3-5-sonnet-20241022", "claude-3-5-sonnet"},
+		{"claude-3-5-sonnet-latest", "claude-3-5-sonnet"},
+		{"claude-3-5-sonnet@20240620", "claude-3-5-sonnet"},
+		{"claude-sonnet-4-20250514", "claude-sonnet-4"},
+		{"gpt-4.5-preview", ""},
+		{"gpt-4-32k", ""},
+		{"claude-3-5-sonnet-v2-experimental", ""},
+		{"unknown-model", ""},
+	}
+	for _, tt := range tests {
+		got, ok := cfg.PriceFor(tt.model)
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("%s: priced as %+v, want no price", tt.model, got)
+		case tt.want != "" && (!ok || got != cfg.Pricing[tt.want]):
+			t.Errorf("%s: got %+v, %v; want the %s price", tt.model, got, ok, tt.want)
+		}
+	}
+}
+
+func TestContextWindowFor(t *testing.T) {
+	cfg := DefaultConfig()
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"gpt-4.1-mini", 1047576},
+		{"o4-mini", 200000},
+		{"claude-opus-4-1-20250805", 200000},
+		{"gpt-4-0613", 8192},
+		{"mystery", defaultContextWindow},
+	}
+	for _, tt := range tests {
+		if got := cfg.ContextWindowFor(tt.model); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
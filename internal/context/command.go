@@ -0,0 +1,110 @@
+package context
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// LoadCommand runs a shell command and captures its combined output as a
+// context file. A non-zero exit is not an error: failing tests and lint
+// output are exactly what these commands are for. Output beyond maxBytes
+// keeps its beginning and end; a command still running after timeout is
+// killed and whatever it printed is kept.
+func (h *Handler) LoadCommand(command string, timeout time.Duration, maxBytes int) (*types.ContextFile, error) {
+	cmd := shellCommand(command)
+	output := newCappedBuffer(maxBytes)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// The shell gets its own process group so a timeout stops everything it started
+	setProcessGroup(cmd)
+	// Grandchildren that left the group can still hold the pipes open
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run context command %q: %w", command, err)
+	}
+
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		killProcessGroup(cmd)
+	})
+	err := cmd.Wait()
+	timer.Stop()
+
+	var notes []string
+	if timedOut.Load() {
+		notes = append(notes, fmt.Sprintf("timed out after %s", timeout))
+	} else if exitErr, ok := err.(*exec.ExitError); ok {
+		notes = append(notes, fmt.Sprintf("exit status %d", exitErr.ExitCode()))
+	} else if err != nil {
+		return nil, fmt.Errorf("context command %q failed: %w", command, err)
+	}
+	if output.omitted > 0 {
+		notes = append(notes, fmt.Sprintf("%d bytes omitted", output.omitted))
+	}
+
+	label := "$ " + command
+	if len(notes) > 0 {
+		label += " (" + strings.Join(notes, ", ") + ")"
+	}
+
+	return &types.ContextFile{
+		Language: types.LangText,
+		Content:  output.String(),
+		Label:    label,
+		Pinned:   true,
+	}, nil
+}
+
+// shellCommand runs command through the platform shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// cappedBuffer keeps the first and last halves of at most max bytes of output
+type cappedBuffer struct {
+	max     int
+	head    []byte
+	tail    []byte
+	omitted int
+}
+
+func newCappedBuffer(max int) *cappedBuffer {
+	return &cappedBuffer{max: max}
+}
+
+// Write implements io.Writer
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+
+	if room := b.max/2 - len(b.head); room > 0 {
+		take := min(room, len(p))
+		b.head = append(b.head, p[:take]...)
+		p = p[take:]
+	}
+
+	b.tail = append(b.tail, p...)
+	if keep := b.max - b.max/2; len(b.tail) > keep {
+		b.omitted += len(b.tail) - keep
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-keep:]...)
+	}
+	return n, nil
+}
+
+// String joins the kept output, marking any gap
+func (b *cappedBuffer) String() string {
+	if b.omitted == 0 {
+		return string(b.head) + string(b.tail)
+	}
+	return fmt.Sprintf("%s\n... [%d bytes omitted] ...\n%s", b.head, b.omitted, b.tail)
+}
@@ -0,0 +1,45 @@
+package context
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadCommandTimeoutKillsChildren(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	marker := filepath.Join(t.TempDir(), "marker")
+
+	// The background child outlives the shell unless its group is killed
+	command := "(sleep 1; touch " + marker + ") & echo started; sleep 10"
+	file, err := New().LoadCommand(command, 200*time.Millisecond, 1024)
+	if err != nil {
+		t.Fatalf("LoadCommand: %v", err)
+	}
+	if !strings.Contains(file.Label, "timed out") || !strings.Contains(file.Content, "started") {
+		t.Errorf("got label %q, content %q", file.Label, file.Content)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("child of the timed-out command kept running")
+	}
+}
+
+func TestLoadCommandMaxBytes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	file, err := New().LoadCommand("printf 0123456789abcdefghij", time.Minute, 10)
+	if err != nil {
+		t.Fatalf("LoadCommand: %v", err)
+	}
+	if !strings.HasPrefix(file.Content, "01234") || !strings.HasSuffix(file.Content, "fghij") || !strings.Contains(file.Label, "10 bytes omitted") {
+		t.Errorf("got label %q, content %q", file.Label, file.Content)
+	}
+}
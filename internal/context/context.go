@@ -5,24 +5,54 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/Zachacious/presto/internal/language"
+	"github.com/Zachacious/presto/internal/notebook"
+	"github.com/Zachacious/presto/internal/textfile"
 	"github.com/Zachacious/presto/pkg/types"
 )
 
 // Handler manages context files and patterns
-type Handler struct{}
+type Handler struct {
+	skipped []string // Pattern matches left out, with the reason
+}
 
 // New creates a new context handler
 func New() *Handler {
 	return &Handler{}
 }
 
-// LoadContext loads context files from patterns and specific files
+// LoadContext loads context files from patterns and specific files. Files
+// may carry a label ("docs:README.md"). A specific file that can't be loaded
+// is an error; pattern matches that are too large or binary are skipped and
+// reported by SummarizeContext.
 func (h *Handler) LoadContext(patterns []string, files []string, basePath string, maxFileSize int64) ([]*types.ContextFile, error) {
 	var contextFiles []*types.ContextFile
 	seenFiles := make(map[string]bool) // Avoid duplicates
+	h.skipped = nil
+
+	// Load specific files first so their labels win over pattern matches
+	paths, labels := h.ParseContextArguments(files)
+	for _, file := range paths {
+		resolvedPath := h.resolvePath(file, basePath)
+
+		if seenFiles[resolvedPath] {
+			continue
+		}
+		seenFiles[resolvedPath] = true
+
+		contextFile, err := h.loadContextFile(resolvedPath, maxFileSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load context file %s: %w", file, err)
+		}
+		if label, ok := labels[file]; ok {
+			contextFile.Label = label
+		}
+		contextFile.Pinned = true
+		contextFiles = append(contextFiles, contextFile)
+	}
 
 	// Load from patterns
 	for _, pattern := range patterns {
@@ -39,129 +69,119 @@ func (h *Handler) LoadContext(patterns []string, files []string, basePath string
 
 			contextFile, err := h.loadContextFile(file, maxFileSize)
 			if err != nil {
-				continue // Skip problematic files
+				h.skipped = append(h.skipped, fmt.Sprintf("%s (%v)", h.generateLabel(file), err))
+				continue
 			}
 			contextFiles = append(contextFiles, contextFile)
 		}
 	}
 
-	// Load specific files
-	for _, file := range files {
-		resolvedPath := h.resolvePath(file, basePath)
-
-		if seenFiles[resolvedPath] {
-			continue
-		}
-		seenFiles[resolvedPath] = true
-
-		contextFile, err := h.loadContextFile(resolvedPath, maxFileSize)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load context file %s: %w", file, err)
-		}
-		contextFiles = append(contextFiles, contextFile)
-	}
-
 	return contextFiles, nil
 }
 
-// findFilesByPattern finds files matching a pattern
+// findFilesByPattern finds files matching a pattern. Patterns with a path
+// separator or "**" are matched against the path relative to basePath, with
+// "**" spanning directories; other globs match file names at any depth.
+// Anything else is treated as a regular expression.
 func (h *Handler) findFilesByPattern(pattern, basePath string) ([]string, error) {
-	var matches []string
+	var match func(path, rel, name string) bool
 
-	// Handle different pattern types
-	if strings.Contains(pattern, "*") || strings.Contains(pattern, "?") {
-		// Glob pattern
-		globPattern := filepath.Join(basePath, pattern)
-		if !filepath.IsAbs(globPattern) && basePath != "." {
-			globPattern = filepath.Join(".", pattern)
-		}
-
-		globMatches, err := filepath.Glob(globPattern)
+	switch {
+	case strings.Contains(pattern, "**") || (isGlob(pattern) && strings.ContainsAny(pattern, "/\\")):
+		re, err := globToRegexp(filepath.ToSlash(pattern))
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid glob pattern: %w", err)
 		}
-		matches = append(matches, globMatches...)
-
-		// Also try recursive glob if pattern doesn't start with */
-		if !strings.HasPrefix(pattern, "*/") && !strings.HasPrefix(pattern, "**/") {
-			recursivePattern := filepath.Join(basePath, "**", pattern)
-			if !filepath.IsAbs(recursivePattern) {
-				recursivePattern = filepath.Join(".", "**", pattern)
-			}
-
-			// Walk directories for recursive matching
-			err = filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return nil // Continue on errors
-				}
-
-				if info.IsDir() {
-					if h.shouldSkipDir(info.Name()) {
-						return filepath.SkipDir
-					}
-					return nil
-				}
-
-				// Check if file matches pattern
-				if matched, _ := filepath.Match(pattern, info.Name()); matched {
-					if h.isTextFile(path) {
-						matches = append(matches, path)
-					}
-				}
-
-				return nil
-			})
+		match = func(path, rel, name string) bool { return re.MatchString(rel) }
+	case isGlob(pattern):
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob pattern: %w", err)
+		}
+		match = func(path, rel, name string) bool {
+			matched, _ := filepath.Match(pattern, name)
+			return matched
 		}
-	} else {
-		// Regex pattern - search recursively
+	default:
 		regex, err := regexp.Compile(pattern)
 		if err != nil {
 			return nil, fmt.Errorf("invalid regex pattern: %w", err)
 		}
+		match = func(path, rel, name string) bool { return regex.MatchString(path) || regex.MatchString(name) }
+	}
 
-		err = filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil // Continue on errors
-			}
-
-			if info.IsDir() {
-				// Skip common ignore directories
-				if h.shouldSkipDir(info.Name()) {
-					return filepath.SkipDir
-				}
-				return nil
-			}
+	var matches []string
+	err := filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Continue on errors
+		}
 
-			if regex.MatchString(path) || regex.MatchString(info.Name()) {
-				if h.isTextFile(path) {
-					matches = append(matches, path)
-				}
+		if info.IsDir() {
+			if path != basePath && h.shouldSkipDir(info.Name()) {
+				return filepath.SkipDir
 			}
-
 			return nil
-		})
+		}
 
+		rel, err := filepath.Rel(basePath, path)
 		if err != nil {
-			return nil, err
+			return nil
+		}
+		if match(path, filepath.ToSlash(rel), info.Name()) && h.isTextFile(path) {
+			matches = append(matches, path)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Remove duplicates and filter for text files only
-	var textFiles []string
-	seen := make(map[string]bool)
+	return matches, nil
+}
 
-	for _, match := range matches {
-		if seen[match] {
-			continue
-		}
-		seen[match] = true
+// isGlob reports whether a pattern uses glob metacharacters
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
 
-		if h.isTextFile(match) {
-			textFiles = append(textFiles, match)
+// globToRegexp converts a slash-separated glob to an anchored regular
+// expression. "**/" matches zero or more directories, "**" anything, "*" and
+// "?" stay within one path segment.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.TrimPrefix(pattern, "./")
+
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class in %q", pattern)
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
 		}
 	}
+	re.WriteString("$")
 
-	return textFiles, nil
+	return regexp.Compile(re.String())
 }
 
 // loadContextFile loads a single context file
@@ -175,17 +195,34 @@ func (h *Handler) loadContextFile(path string, maxFileSize int64) (*types.Contex
 		return nil, fmt.Errorf("file too large: %d bytes (max %d)", info.Size(), maxFileSize)
 	}
 
-	content, err := os.ReadFile(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sniffed := textfile.Sniff(data)
+	if sniffed.Binary {
+		return nil, fmt.Errorf("binary file")
+	}
+
+	content, err := textfile.Decode(data, sniffed.Format)
 	if err != nil {
 		return nil, err
 	}
 
 	lang := language.DetectLanguage(path)
 
+	// A notebook is sent as its cells; outputs and metadata only cost tokens
+	if lang == types.LangNotebook {
+		if nb, err := notebook.Parse(content); err == nil {
+			content = nb.Text()
+		}
+	}
+
 	return &types.ContextFile{
 		Path:     path,
 		Language: lang,
-		Content:  string(content),
+		Content:  content,
 		Label:    h.generateLabel(path),
 	}, nil
 }
@@ -207,9 +244,13 @@ func (h *Handler) resolvePath(file, basePath string) string {
 	return filepath.Join(basePath, file)
 }
 
-// isTextFile determines if a file should be processed as text
+// isTextFile determines if a file should be processed as text. Extensionless
+// and unknown files are judged by their content rather than their name.
 func (h *Handler) isTextFile(path string) bool {
 	lang := language.DetectLanguage(path)
+	if lang == types.LangUnknown || filepath.Ext(path) == "" {
+		return textfile.IsText(path)
+	}
 	return language.IsTextFile(lang)
 }
 
@@ -240,7 +281,9 @@ func (h *Handler) ParseContextArguments(args []string) ([]string, map[string]str
 	labels := make(map[string]string)
 
 	for _, arg := range args {
-		if idx := strings.Index(arg, ":"); idx > 0 && !strings.Contains(arg[:idx], "/") && !strings.Contains(arg[:idx], "\\") {
+		idx := strings.Index(arg, ":")
+		isDrive := idx == 1 && len(arg) > 2 && (arg[2] == '\\' || arg[2] == '/')
+		if idx > 0 && !isDrive && !strings.Contains(arg[:idx], "/") && !strings.Contains(arg[:idx], "\\") {
 			// Only treat as label:path if the part before : doesn't contain path separators
 			label := arg[:idx]
 			path := arg[idx+1:]
@@ -280,11 +323,23 @@ func (h *Handler) SummarizeContext(contextFiles []*types.ContextFile) string {
 		totalSize += int64(len(file.Content))
 	}
 
-	for lang, count := range langCounts {
-		summary.WriteString(fmt.Sprintf("  - %s: %d files\n", lang, count))
+	langs := make([]string, 0, len(langCounts))
+	for lang := range langCounts {
+		langs = append(langs, string(lang))
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		summary.WriteString(fmt.Sprintf("  - %s: %d files\n", lang, langCounts[types.Language(lang)]))
 	}
 
 	summary.WriteString(fmt.Sprintf("  - Total size: %d bytes", totalSize))
 
+	if len(h.skipped) > 0 {
+		summary.WriteString(fmt.Sprintf("\nSkipped %d matches:", len(h.skipped)))
+		for _, skipped := range h.skipped {
+			summary.WriteString("\n  - " + skipped)
+		}
+	}
+
 	return summary.String()
 }
@@ -0,0 +1,362 @@
+package context
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Zachacious/presto/internal/language"
+	"github.com/Zachacious/presto/internal/outline"
+	"github.com/Zachacious/presto/internal/textfile"
+	"github.com/Zachacious/presto/internal/utils"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// maxDependencyFiles caps how many files one input can pull in
+const maxDependencyFiles = 50
+
+var (
+	jsImportPattern = regexp.MustCompile(`(?m)(?:import|export)\s[^'"]*?from\s+['"](\.{1,2}/[^'"]+)['"]|import\s+['"](\.{1,2}/[^'"]+)['"]|require\(\s*['"](\.{1,2}/[^'"]+)['"]\s*\)|import\(\s*['"](\.{1,2}/[^'"]+)['"]\s*\)`)
+	pyFromPattern   = regexp.MustCompile(`(?m)^\s*from\s+(\.*[\w.]*)\s+import[ \t]+([\w \t,*()]+)`)
+	pyImportPattern = regexp.MustCompile(`(?m)^\s*import\s+([\w.]+(?:\s*,\s*[\w.]+)*)`)
+)
+
+// jsExtensions are tried, in order, when a JS/TS import omits the extension
+var jsExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs", ".d.ts"}
+
+// Resolver finds the local dependencies of source files: packages in the same
+// Go module, and relative JS/TS and Python imports. It is safe for
+// concurrent use and caches what it reads.
+type Resolver struct {
+	maxFileSize int64 // Larger dependencies are left out
+
+	mu      sync.Mutex
+	modules map[string]goModule // go.mod directory -> module
+	files   map[string]string   // path -> content
+}
+
+// source is a file whose imports are being followed
+type source struct {
+	path    string
+	content string
+	lang    types.Language
+}
+
+// goModule is a parsed go.mod
+type goModule struct {
+	root string
+	path string
+}
+
+// NewResolver creates a dependency resolver that skips files larger than
+// maxFileSize bytes
+func NewResolver(maxFileSize int64) *Resolver {
+	return &Resolver{
+		maxFileSize: maxFileSize,
+		modules:     make(map[string]goModule),
+		files:       make(map[string]string),
+	}
+}
+
+// Dependencies returns context files for the local dependencies of a file,
+// following imports up to depth levels. With full false each dependency is
+// reduced to its signatures.
+func (r *Resolver) Dependencies(path, content string, lang types.Language, depth int, full bool) []*types.ContextFile {
+	if depth <= 0 {
+		return nil
+	}
+
+	start, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{start: true}
+	var found []string
+	frontier := []source{{start, content, lang}}
+
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		var next []source
+		for _, f := range frontier {
+			for _, dep := range r.imports(f.path, f.content, f.lang) {
+				if seen[dep] || len(found) >= maxDependencyFiles {
+					continue
+				}
+				seen[dep] = true
+
+				depContent, ok := r.read(dep)
+				if !ok {
+					continue
+				}
+				found = append(found, dep)
+				next = append(next, source{dep, depContent, language.DetectLanguage(dep)})
+			}
+		}
+		frontier = next
+	}
+
+	var files []*types.ContextFile
+	for _, dep := range found {
+		depContent, _ := r.read(dep)
+		depLang := language.DetectLanguage(dep)
+		label := relativeLabel(dep)
+
+		if !full {
+			if sketch := outline.Outline(depContent, depLang); sketch != "" {
+				depContent = sketch
+				label += " (signatures)"
+			}
+		}
+
+		files = append(files, &types.ContextFile{
+			Path:     dep,
+			Language: depLang,
+			Content:  depContent,
+			Label:    label,
+		})
+	}
+	return files
+}
+
+// imports resolves a file's local imports to absolute file paths
+func (r *Resolver) imports(path, content string, lang types.Language) []string {
+	switch lang {
+	case types.LangGo:
+		return r.goImports(path, content)
+	case types.LangJavaScript, types.LangTypeScript:
+		return jsImports(path, content)
+	case types.LangPython:
+		return pythonImports(path, content)
+	}
+	return nil
+}
+
+// goImports resolves imports that belong to the file's own module to the
+// non-test Go files of each imported package
+func (r *Resolver) goImports(path, content string) []string {
+	parsed, err := parser.ParseFile(token.NewFileSet(), path, content, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+
+	module, ok := r.module(filepath.Dir(path))
+	if !ok {
+		return nil
+	}
+
+	var deps []string
+	for _, spec := range parsed.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		rel, ok := strings.CutPrefix(importPath, module.path)
+		if !ok || (rel != "" && !strings.HasPrefix(rel, "/")) {
+			continue
+		}
+		deps = append(deps, goPackageFiles(filepath.Join(module.root, filepath.FromSlash(rel)))...)
+	}
+	return deps
+}
+
+// module finds and parses the go.mod governing dir
+func (r *Resolver) module(dir string) (goModule, bool) {
+	for {
+		r.mu.Lock()
+		cached, ok := r.modules[dir]
+		r.mu.Unlock()
+		if ok {
+			return cached, true
+		}
+
+		if modPath := utils.GoModulePath(filepath.Join(dir, "go.mod")); modPath != "" {
+			module := goModule{root: dir, path: modPath}
+			r.mu.Lock()
+			r.modules[dir] = module
+			r.mu.Unlock()
+			return module, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return goModule{}, false
+		}
+		dir = parent
+	}
+}
+
+// read returns a text file's decoded content, cached. Files over the size
+// limit are skipped, as LoadContext skips them.
+func (r *Resolver) read(path string) (string, bool) {
+	r.mu.Lock()
+	content, ok := r.files[path]
+	r.mu.Unlock()
+	if ok {
+		return content, true
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Size() > r.maxFileSize {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	info := textfile.Sniff(data)
+	if info.Binary {
+		return "", false
+	}
+	content, err = textfile.Decode(data, info.Format)
+	if err != nil {
+		return "", false
+	}
+
+	r.mu.Lock()
+	r.files[path] = content
+	r.mu.Unlock()
+	return content, true
+}
+
+// goPackageFiles lists the non-test Go files of a package directory
+func goPackageFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// jsImports resolves relative import specifiers to files
+func jsImports(path, content string) []string {
+	var deps []string
+	for _, m := range jsImportPattern.FindAllStringSubmatch(content, -1) {
+		for _, spec := range m[1:] {
+			if spec == "" {
+				continue
+			}
+			if resolved := resolveJS(filepath.Join(filepath.Dir(path), filepath.FromSlash(spec))); resolved != "" {
+				deps = append(deps, resolved)
+			}
+		}
+	}
+	return deps
+}
+
+// resolveJS applies node-style resolution: exact file, added extension, then index file
+func resolveJS(base string) string {
+	if isFile(base) {
+		return base
+	}
+	for _, ext := range jsExtensions {
+		if isFile(base + ext) {
+			return base + ext
+		}
+	}
+	// "./util.js" may refer to "util.ts" when compiling TypeScript
+	if ext := filepath.Ext(base); ext == ".js" || ext == ".jsx" {
+		stem := strings.TrimSuffix(base, ext)
+		for _, alt := range []string{".ts", ".tsx"} {
+			if isFile(stem + alt) {
+				return stem + alt
+			}
+		}
+	}
+	for _, ext := range jsExtensions {
+		if index := filepath.Join(base, "index"+ext); isFile(index) {
+			return index
+		}
+	}
+	return ""
+}
+
+// pythonImports resolves relative imports, and absolute imports that exist
+// under the working directory
+func pythonImports(path, content string) []string {
+	var deps []string
+	dir := filepath.Dir(path)
+	wd, _ := os.Getwd()
+
+	for _, m := range pyFromPattern.FindAllStringSubmatch(content, -1) {
+		module := m[1]
+		dots := len(module) - len(strings.TrimLeft(module, "."))
+
+		var base string
+		if dots > 0 {
+			base = dir
+			for i := 1; i < dots; i++ {
+				base = filepath.Dir(base)
+			}
+		} else {
+			base = wd
+		}
+
+		modulePath := filepath.Join(base, filepath.FromSlash(strings.ReplaceAll(module[dots:], ".", "/")))
+		if resolved := resolvePython(modulePath); resolved != "" {
+			deps = append(deps, resolved)
+		}
+
+		// Imported names may be submodules, as in "from . import a, b"
+		for _, name := range strings.Split(strings.Trim(m[2], "() \n"), ",") {
+			fields := strings.Fields(name) // "a as b"
+			if len(fields) == 0 || fields[0] == "*" {
+				continue
+			}
+			if resolved := resolvePython(filepath.Join(modulePath, fields[0])); resolved != "" {
+				deps = append(deps, resolved)
+			}
+		}
+	}
+
+	for _, m := range pyImportPattern.FindAllStringSubmatch(content, -1) {
+		for _, module := range strings.Split(m[1], ",") {
+			module = strings.TrimSpace(module)
+			if resolved := resolvePython(filepath.Join(wd, filepath.FromSlash(strings.ReplaceAll(module, ".", "/")))); resolved != "" {
+				deps = append(deps, resolved)
+			}
+		}
+	}
+
+	return deps
+}
+
+// resolvePython maps a module path to its .py file or package __init__.py
+func resolvePython(base string) string {
+	if isFile(base + ".py") {
+		return base + ".py"
+	}
+	if init := filepath.Join(base, "__init__.py"); isFile(init) {
+		return init
+	}
+	return ""
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// relativeLabel shows a path relative to the working directory when possible
+func relativeLabel(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return path
+}
@@ -0,0 +1,158 @@
+package context
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// writeTree creates files under dir, keyed by slash-separated path
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		input string
+		depth int
+		want  []string // Labels, without the signatures suffix
+	}{
+		{
+			name: "go packages of the same module",
+			files: map[string]string{
+				"go.mod":            "module example.com/app\n\ngo 1.22\n",
+				"main.go":           "package main\n\nimport (\n\t\"fmt\"\n\t\"example.com/app/util\"\n\t\"example.com/other/x\"\n)\n",
+				"util/util.go":      "package util\n\nimport \"example.com/app/util/deep\"\n\nfunc A() {}\n",
+				"util/util_test.go": "package util\n",
+				"util/more.go":      "package util\n\nfunc B() {}\n",
+				"util/deep/deep.go": "package deep\n\nfunc C() {}\n",
+			},
+			input: "main.go",
+			depth: 1,
+			want:  []string{"util/more.go", "util/util.go"},
+		},
+		{
+			name: "go imports followed to depth",
+			files: map[string]string{
+				"go.mod":            "module example.com/app\n",
+				"main.go":           "package main\n\nimport \"example.com/app/util\"\n",
+				"util/util.go":      "package util\n\nimport \"example.com/app/util/deep\"\n",
+				"util/deep/deep.go": "package deep\n",
+			},
+			input: "main.go",
+			depth: 2,
+			want:  []string{"util/util.go", "util/deep/deep.go"},
+		},
+		{
+			name: "go module prefix isn't a package boundary",
+			files: map[string]string{
+				"go.mod":         "module example.com/app\n",
+				"main.go":        "package main\n\nimport \"example.com/appendix\"\n",
+				"endix/endix.go": "package endix\n",
+			},
+			input: "main.go",
+			depth: 1,
+			want:  nil,
+		},
+		{
+			name: "js and ts relative imports",
+			files: map[string]string{
+				"src/app.ts":          "import { a } from './a'\nimport b from \"../lib/b.js\"\nconst c = require('./c')\nimport('./lazy')\nimport './side'\nimport React from 'react'\n",
+				"src/a.ts":            "export const a = 1\n",
+				"lib/b.ts":            "export default 2\n",
+				"src/c.js":            "module.exports = 3\n",
+				"src/lazy/index.tsx":  "export {}\n",
+				"src/side.mjs":        "\n",
+				"node_modules/r/x.js": "\n",
+			},
+			input: "src/app.ts",
+			depth: 1,
+			want:  []string{"src/a.ts", "lib/b.ts", "src/c.js", "src/lazy/index.tsx", "src/side.mjs"},
+		},
+		{
+			name: "python relative and absolute imports",
+			files: map[string]string{
+				"pkg/__init__.py":        "",
+				"pkg/main.py":            "from . import helpers, models as m\nfrom .sub.tool import run\nfrom ..outside import x\nimport pkg.config, os\nimport requests\n",
+				"pkg/helpers.py":         "def h(): pass\n",
+				"pkg/models/__init__.py": "class M: pass\n",
+				"pkg/sub/tool.py":        "def run(): pass\n",
+				"pkg/config.py":          "X = 1\n",
+			},
+			input: "pkg/main.py",
+			depth: 1,
+			want:  []string{"pkg/__init__.py", "pkg/helpers.py", "pkg/models/__init__.py", "pkg/sub/tool.py", "pkg/config.py"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+			t.Chdir(dir)
+
+			input := tt.files[tt.input]
+			lang := map[string]types.Language{".go": types.LangGo, ".ts": types.LangTypeScript, ".py": types.LangPython}[filepath.Ext(tt.input)]
+			deps := NewResolver(1<<20).Dependencies(tt.input, input, lang, tt.depth, true)
+
+			var got []string
+			for _, dep := range deps {
+				got = append(got, dep.Label)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDependenciesSignatures(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":       "module example.com/app\n",
+		"main.go":      "package main\n\nimport \"example.com/app/util\"\n",
+		"util/util.go": "package util\n\n// A does a\nfunc A() int {\n\treturn 1\n}\n",
+	})
+	t.Chdir(dir)
+
+	deps := NewResolver(1<<20).Dependencies("main.go", "package main\n\nimport \"example.com/app/util\"\n", types.LangGo, 1, false)
+	if len(deps) != 1 {
+		t.Fatalf("got %d dependencies, want 1", len(deps))
+	}
+	if deps[0].Label != "util/util.go (signatures)" || strings.Contains(deps[0].Content, "return 1") {
+		t.Errorf("got %q:\n%s", deps[0].Label, deps[0].Content)
+	}
+}
+
+func TestDependenciesMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"app.js":   "import './small'\nimport './large'\n",
+		"small.js": "export {}\n",
+		"large.js": strings.Repeat("// padding\n", 100),
+	})
+	t.Chdir(dir)
+
+	deps := NewResolver(100).Dependencies("app.js", "import './small'\nimport './large'\n", types.LangJavaScript, 1, true)
+	if len(deps) != 1 || deps[0].Label != "small.js" {
+		var labels []string
+		for _, dep := range deps {
+			labels = append(labels, dep.Label)
+		}
+		t.Errorf("got %q, want only small.js", labels)
+	}
+}
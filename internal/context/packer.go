@@ -0,0 +1,268 @@
+package context
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/outline"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/internal/utils"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// minTruncatedTokens is the smallest useful slice of a truncated file; below
+// this the file is dropped instead
+const minTruncatedTokens = 200
+
+var (
+	identifierPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]{3,}`)
+	importLinePattern = regexp.MustCompile(`(?m)^\s*(import|from|require|#include|use|using)\b.*$|^\s*"[^"]+"\s*$|require\(['"][^'"]+['"]\)`)
+)
+
+// commonWords are identifiers too frequent to say anything about relevance
+var commonWords = map[string]bool{
+	"func": true, "return": true, "string": true, "error": true, "true": true, "false": true,
+	"import": true, "package": true, "const": true, "type": true, "struct": true, "interface": true,
+	"self": true, "this": true, "class": true, "def": true, "function": true, "export": true,
+	"default": true, "public": true, "private": true, "static": true, "void": true, "null": true,
+	"None": true, "True": true, "False": true, "else": true, "from": true, "async": true,
+	"await": true, "range": true, "break": true, "continue": true, "switch": true, "case": true,
+	"with": true, "while": true, "for": true, "int64": true, "bool": true, "byte": true, "make": true,
+	"append": true, "len": true, "new": true, "var": true, "let": true, "the": true, "and": true,
+	"that": true, "nil": true, "err": true, "fmt": true, "Errorf": true, "Sprintf": true,
+}
+
+// Target is what context is being packed for: an input file, or the prompt
+// itself in generate mode
+type Target struct {
+	Path    string
+	Content string
+}
+
+// Packer ranks context files by relevance to a target and fits them into a
+// token budget, keeping the most relevant in full and shrinking the rest
+type Packer struct {
+	provider    types.AIProvider
+	lineNumbers bool
+}
+
+// NewPacker creates a packer that counts tokens for the given provider
+func NewPacker(provider types.AIProvider) *Packer {
+	return &Packer{provider: provider}
+}
+
+// WithLineNumbers returns a packer that sends the content of files with a
+// path with line numbers, so answers can cite them. Numbers are added after
+// a file's form is chosen: outlines are built from the plain source and
+// don't carry them.
+func (pk *Packer) WithLineNumbers() *Packer {
+	return &Packer{provider: pk.provider, lineNumbers: true}
+}
+
+// candidate is a context file with its relevance score
+type candidate struct {
+	file  *types.ContextFile
+	score float64
+	order int
+}
+
+// Pack selects context for target within budget tokens. It returns the files
+// to send, most relevant first, and a usage entry for every candidate. The
+// target file itself is never used as its own context.
+func (pk *Packer) Pack(target Target, files []*types.ContextFile, budget int) ([]*types.ContextFile, []types.ContextUsage) {
+	targetIDs := identifiers(target.Content)
+	targetImports := importLines(target.Content)
+
+	var candidates []candidate
+	for i, file := range files {
+		if target.Path != "" && utils.SamePath(file.Path, target.Path) {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			file:  file,
+			score: score(target, targetIDs, targetImports, file),
+			order: i,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	var packed []*types.ContextFile
+	var usage []types.ContextUsage
+	remaining := budget
+
+	for _, c := range candidates {
+		header := tokens.Count(fmt.Sprintf("=== %s (%s) ===\n", c.file.Label, c.file.Language), pk.provider)
+		entry := types.ContextUsage{Path: c.file.Path, Label: c.file.Label, Score: c.score, Mode: types.ContextDropped}
+
+		content, mode := pk.fit(c.file, remaining-header)
+		if mode != types.ContextDropped {
+			used := header + tokens.Count(content, pk.provider)
+			remaining -= used
+			entry.Mode = mode
+			entry.Tokens = used
+
+			fitted := *c.file
+			fitted.Content = content
+			if mode != types.ContextFull {
+				fitted.Label = fmt.Sprintf("%s [%s]", c.file.Label, mode)
+			}
+			packed = append(packed, &fitted)
+		}
+		usage = append(usage, entry)
+	}
+
+	return packed, usage
+}
+
+// fit returns the largest form of a file that fits in room tokens: the whole
+// file, its outline, or its leading lines
+func (pk *Packer) fit(file *types.ContextFile, room int) (string, types.ContextMode) {
+	if room <= 0 {
+		return "", types.ContextDropped
+	}
+
+	content := file.Content
+	if pk.lineNumbers && file.Path != "" {
+		content = NumberLines(content)
+	}
+	if tokens.Count(content, pk.provider) <= room {
+		return content, types.ContextFull
+	}
+
+	if sketch := outline.Outline(file.Content, file.Language); sketch != "" {
+		if tokens.Count(sketch, pk.provider) <= room {
+			return sketch, types.ContextOutline
+		}
+	}
+
+	if room < minTruncatedTokens {
+		return "", types.ContextDropped
+	}
+	return pk.truncate(content, room), types.ContextTruncated
+}
+
+// NumberLines prefixes every line with its 1-based number
+func NumberLines(content string) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	width := len(fmt.Sprint(len(lines)))
+
+	var b strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&b, "%*d| %s\n", width, i+1, line)
+	}
+	return b.String()
+}
+
+// truncate keeps whole leading lines of content within room tokens
+func (pk *Packer) truncate(content string, room int) string {
+	const marker = "\n... [truncated]"
+	room -= tokens.Count(marker, pk.provider)
+
+	lines := strings.SplitAfter(content, "\n")
+	var out strings.Builder
+	used := 0
+	for _, line := range lines {
+		n := tokens.Count(line, pk.provider)
+		if used+n > room {
+			break
+		}
+		out.WriteString(line)
+		used += n
+	}
+	return strings.TrimRight(out.String(), "\n") + marker
+}
+
+// score rates how relevant a context file is to the target. It combines
+// shared identifiers, import relationships and directory proximity; files
+// the user named explicitly always come first.
+func score(target Target, targetIDs map[string]bool, targetImports string, file *types.ContextFile) float64 {
+	s := 0.0
+	if file.Pinned {
+		s += 10
+	}
+
+	// Shared identifiers, normalised so large files don't win on size alone
+	fileIDs := identifiers(file.Content)
+	shared := 0
+	for id := range fileIDs {
+		if targetIDs[id] {
+			shared++
+		}
+	}
+	if len(targetIDs) > 0 && len(fileIDs) > 0 {
+		s += float64(shared) / math.Sqrt(float64(len(targetIDs)*len(fileIDs)))
+	}
+
+	if target.Path == "" {
+		return s
+	}
+
+	// Import relationships in either direction
+	if refersTo(targetImports, file.Path) {
+		s += 0.5
+	}
+	if refersTo(importLines(file.Content), target.Path) {
+		s += 0.3
+	}
+
+	// Directory proximity
+	s += 0.3 / float64(1+dirDistance(target.Path, file.Path))
+
+	return s
+}
+
+// identifiers returns the distinct, non-trivial identifiers in text
+func identifiers(text string) map[string]bool {
+	ids := make(map[string]bool)
+	for _, id := range identifierPattern.FindAllString(text, -1) {
+		if !commonWords[id] {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// importLines returns the import-like lines of a file, joined
+func importLines(text string) string {
+	return strings.Join(importLinePattern.FindAllString(text, -1), "\n")
+}
+
+// refersTo reports whether import lines mention a file by stem or by its package directory
+func refersTo(imports, path string) bool {
+	if imports == "" {
+		return false
+	}
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	dir := filepath.Base(filepath.Dir(path))
+
+	if len(stem) >= 3 && stem != "index" && stem != "__init__" && strings.Contains(imports, stem) {
+		return true
+	}
+	return len(dir) >= 3 && dir != "." && strings.Contains(imports, "/"+dir)
+}
+
+// dirDistance counts the directory steps between the folders of two paths
+func dirDistance(a, b string) int {
+	partsA := splitDir(a)
+	partsB := splitDir(b)
+
+	common := 0
+	for common < len(partsA) && common < len(partsB) && partsA[common] == partsB[common] {
+		common++
+	}
+	return len(partsA) - common + len(partsB) - common
+}
+
+func splitDir(path string) []string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return strings.Split(filepath.ToSlash(filepath.Dir(path)), "/")
+}
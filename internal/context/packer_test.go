@@ -0,0 +1,49 @@
+package context
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func TestNumberLines(t *testing.T) {
+	content := "a\n\nb\n" + strings.Repeat("x\n", 8)
+	got := NumberLines(content)
+	if !strings.HasPrefix(got, " 1| a\n 2| \n 3| b\n") || !strings.HasSuffix(got, "11| x\n") {
+		t.Errorf("NumberLines = %q", got)
+	}
+}
+
+func TestPackWithLineNumbers(t *testing.T) {
+	var body strings.Builder
+	for i := 0; i < 200; i++ {
+		body.WriteString("\tfmt.Println(\"some fairly long line of output\", i, j, k)\n")
+	}
+	src := "package main\n\nimport \"fmt\"\n\n// Run does the work\nfunc Run(i, j, k int) {\n" + body.String() + "}\n"
+	file := &types.ContextFile{Path: "main.go", Language: types.LangGo, Content: src, Label: "main.go"}
+	pk := NewPacker(types.ProviderOpenAI).WithLineNumbers()
+
+	// Everything fits: sent whole, with line numbers
+	packed, usage := pk.Pack(Target{Content: "question"}, []*types.ContextFile{file}, 100000)
+	if usage[0].Mode != types.ContextFull || !strings.HasPrefix(packed[0].Content, "  1| package main\n") {
+		t.Fatalf("full: mode %s, content %.40q", usage[0].Mode, packed[0].Content)
+	}
+
+	// Too big: the outline is built from the plain source, so it still parses
+	packed, usage = pk.Pack(Target{Content: "question"}, []*types.ContextFile{file}, tokens.Count(src, types.ProviderOpenAI)/2)
+	if usage[0].Mode != types.ContextOutline {
+		t.Fatalf("over budget: mode %s, want %s", usage[0].Mode, types.ContextOutline)
+	}
+	if !strings.Contains(packed[0].Content, "func Run(i, j, k int)") || strings.Contains(packed[0].Content, "| ") {
+		t.Errorf("outline = %q", packed[0].Content)
+	}
+
+	// Command output has no path and no line numbers
+	cmd := &types.ContextFile{Language: types.LangText, Content: "ok\n", Label: "$ go test"}
+	packed, _ = pk.Pack(Target{Content: "question"}, []*types.ContextFile{cmd}, 1000)
+	if packed[0].Content != "ok\n" {
+		t.Errorf("command output = %q", packed[0].Content)
+	}
+}
@@ -0,0 +1,39 @@
+package context
+
+import (
+	"github.com/Zachacious/presto/internal/utils"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// LoadTemplates expands per-input context templates such as
+// "{{dir}}/{{stem}}_test.go" against inputPath, within the input root, and
+// loads the files that exist. Templates describe optional companions, so a
+// path that is missing, unreadable or the input itself is skipped rather
+// than reported.
+func (h *Handler) LoadTemplates(templates []string, inputPath, root string, maxFileSize int64) ([]*types.ContextFile, error) {
+	var files []*types.ContextFile
+	seen := map[string]bool{}
+
+	for _, tmpl := range templates {
+		path, err := utils.ExpandPathTemplate(tmpl, inputPath, root)
+		if err != nil {
+			return nil, err
+		}
+		if seen[path] || utils.SamePath(path, inputPath) {
+			continue
+		}
+		seen[path] = true
+
+		if !isFile(path) {
+			continue
+		}
+		file, err := h.loadContextFile(path, maxFileSize)
+		if err != nil {
+			continue
+		}
+		file.Pinned = true
+		files = append(files, file)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,65 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Zachacious/presto/internal/schema"
+)
+
+// DefaultPrompt is used when an extraction has no prompt of its own
+const DefaultPrompt = "Extract the requested data from this file. Leave out anything the file doesn't state; never invent values."
+
+// Spec is the schema every extracted object must match
+type Spec struct {
+	Schema *schema.Schema
+	Raw    []byte // Compacted schema document, sent to the provider
+}
+
+// Load reads a JSON Schema file. The root must describe an object, since
+// every input file yields one record.
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	s, err := schema.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Type) != 1 || s.Type[0] != "object" {
+		return nil, fmt.Errorf("schema root must have \"type\": \"object\"")
+	}
+
+	var raw bytes.Buffer
+	if err := json.Compact(&raw, data); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &Spec{Schema: s, Raw: raw.Bytes()}, nil
+}
+
+// Instructions describes the response format to the model
+func (s *Spec) Instructions() string {
+	return `=== OUTPUT FORMAT ===
+Respond with a single JSON object matching this JSON Schema and nothing else:
+
+` + string(s.Raw) + `
+
+Rules:
+- Use only what the input file states
+- Use empty arrays for lists with no entries
+- No markdown, no code fences, no commentary`
+}
+
+// Parse reads the object of one extraction response. Anything that doesn't
+// match the schema is an error.
+func (s *Spec) Parse(response string) (map[string]any, error) {
+	v, _, err := s.Schema.DecodeObject(response)
+	if err != nil {
+		return nil, err
+	}
+	// The root schema is an object, so a valid value always is one
+	return v.(map[string]any), nil
+}
@@ -0,0 +1,172 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// Output formats
+const (
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// sourceField names the field holding each record's input file
+const sourceField = "_source"
+
+// FormatFor picks the output format: the one asked for, or else the one
+// named by the output file's extension, or else JSON
+func FormatFor(format, outputPath string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(outputPath)), ".")
+		if format != FormatJSONL && format != FormatCSV {
+			format = FormatJSON
+		}
+	}
+	switch format {
+	case FormatJSON, FormatJSONL, FormatCSV:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown extract format %q (use json, jsonl or csv)", format)
+}
+
+// Render writes the extracted objects of a run in one format, in input file
+// order. Each record starts with its source file, followed by the schema's
+// properties in schema order and then any others by name.
+func (s *Spec) Render(results []*types.ProcessingResult, format string) ([]byte, int, error) {
+	var extracted []*types.ProcessingResult
+	for _, result := range results {
+		if result.Extracted != nil {
+			extracted = append(extracted, result)
+		}
+	}
+	sort.SliceStable(extracted, func(i, j int) bool {
+		return extracted[i].InputFile < extracted[j].InputFile
+	})
+
+	var out []byte
+	var err error
+	switch format {
+	case FormatCSV:
+		out, err = s.csv(extracted)
+	case FormatJSONL:
+		var buf bytes.Buffer
+		for _, result := range extracted {
+			buf.Write(s.record(result))
+			buf.WriteByte('\n')
+		}
+		out = buf.Bytes()
+	default:
+		var buf bytes.Buffer
+		buf.WriteString("[")
+		for i, result := range extracted {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n  ")
+			if err := json.Indent(&buf, s.record(result), "  ", "  "); err != nil {
+				return nil, 0, err
+			}
+		}
+		if len(extracted) > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("]\n")
+		out = buf.Bytes()
+	}
+	return out, len(extracted), err
+}
+
+// record encodes one result as a JSON object with ordered keys
+func (s *Spec) record(result *types.ProcessingResult) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	writeField := func(key string, value any) {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(marshal(key))
+		buf.WriteByte(':')
+		buf.Write(marshal(value))
+	}
+
+	writeField(sourceField, filepath.ToSlash(result.InputFile))
+	for _, key := range s.keys(result.Extracted) {
+		writeField(key, result.Extracted[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// keys lists an object's keys in schema order, then the rest sorted
+func (s *Spec) keys(object map[string]any) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, key := range s.Schema.Order {
+		if _, ok := object[key]; ok {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	var extra []string
+	for key := range object {
+		if !seen[key] {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	return append(keys, extra...)
+}
+
+// csv writes one row per record with a column per schema property. Nested
+// objects and arrays are written as JSON.
+func (s *Spec) csv(results []*types.ProcessingResult) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	columns := append([]string{sourceField}, s.Schema.Order...)
+	if err := w.Write(columns); err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		row := make([]string, len(columns))
+		row[0] = filepath.ToSlash(result.InputFile)
+		for i, key := range s.Schema.Order {
+			row[i+1] = cell(result.Extracted[key])
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// cell renders one value as CSV text
+func cell(v any) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		return string(marshal(value))
+	}
+}
+
+// marshal encodes a decoded JSON value, leaving HTML characters unescaped
+func marshal(v any) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
@@ -0,0 +1,441 @@
+package filecontext
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Zachacious/presto/internal/utils"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+const (
+	// maxReadmeBytes caps how much of the nearest README is included
+	maxReadmeBytes = 2000
+
+	// maxSiblings caps the sibling file list
+	maxSiblings = 50
+)
+
+// DefaultFields is the field set used when none is configured. It avoids
+// anything that changes between calls or identifies the user.
+var DefaultFields = []string{"path", "language", "project", "package"}
+
+// field is one selectable line of the context block
+type field struct {
+	label string
+	value func(d *Data) string
+}
+
+// fields maps config names to context lines. "env:NAME" is handled separately.
+var fields = map[string]field{
+	"path":     {"File", (*Data).RelPath},
+	"abs_path": {"Absolute path", (*Data).AbsPath},
+	"dir":      {"Directory", (*Data).Dir},
+	"base":     {"Base name", (*Data).Base},
+	"ext":      {"Extension", (*Data).Ext},
+	"language": {"Language", (*Data).Language},
+	"size":     {"Size", (*Data).Size},
+	"modified": {"Last modified", (*Data).Modified},
+	"mode":     {"File mode", (*Data).Mode},
+	"git_root": {"Git repository", (*Data).GitRoot},
+	"git_path": {"Path from git root", (*Data).GitPath},
+	"project":  {"Project type", (*Data).Project},
+	"package":  {"Package", (*Data).Package},
+	"siblings": {"Sibling files", func(d *Data) string { return strings.Join(d.Siblings(), ", ") }},
+	"readme":   {"Nearest README", (*Data).readmeBlock},
+	"os":       {"OS", (*Data).OS},
+	"arch":     {"Architecture", (*Data).Arch},
+	"user":     {"User", (*Data).User},
+	"time":     {"Processing time", (*Data).Now},
+}
+
+// Fields returns the names accepted in a field list, sorted
+func Fields() []string {
+	names := make([]string, 0, len(fields)+1)
+	for name := range fields {
+		names = append(names, name)
+	}
+	names = append(names, "env:NAME")
+	sort.Strings(names)
+	return names
+}
+
+// Builder renders the context block that describes the file being processed
+type Builder struct {
+	fields []string
+	tmpl   *template.Template
+}
+
+// New creates a builder. A non-empty tmpl is a text/template executed
+// against *Data and takes precedence over the field list.
+func New(fieldNames []string, tmpl string) (*Builder, error) {
+	if tmpl != "" {
+		t, err := template.New("file_context").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file context template: %w", err)
+		}
+		return &Builder{tmpl: t}, nil
+	}
+
+	if len(fieldNames) == 0 {
+		fieldNames = DefaultFields
+	}
+	for _, name := range fieldNames {
+		if _, ok := fields[name]; !ok && !strings.HasPrefix(name, "env:") {
+			return nil, fmt.Errorf("unknown file context field: %s (available: %s)", name, strings.Join(Fields(), ", "))
+		}
+	}
+	return &Builder{fields: fieldNames}, nil
+}
+
+// Build renders the context block for a file. content is the decoded file
+// content, used to detect the package name without reading the file again.
+func (b *Builder) Build(path, content string, language types.Language) (string, error) {
+	data := &Data{path: path, content: content, language: language}
+
+	if b.tmpl != nil {
+		var out bytes.Buffer
+		if err := b.tmpl.Execute(&out, data); err != nil {
+			return "", fmt.Errorf("failed to render file context: %w", err)
+		}
+		return strings.TrimSpace(out.String()) + "\n", nil
+	}
+
+	var out strings.Builder
+	for _, name := range b.fields {
+		label, value := name, ""
+		if env, ok := strings.CutPrefix(name, "env:"); ok {
+			label, value = env, os.Getenv(env)
+		} else {
+			f := fields[name]
+			label, value = f.label, f.value(data)
+		}
+		if value == "" {
+			continue
+		}
+		if strings.Contains(value, "\n") {
+			out.WriteString(fmt.Sprintf("%s:\n%s\n", label, value))
+		} else {
+			out.WriteString(fmt.Sprintf("%s: %s\n", label, value))
+		}
+	}
+	return out.String(), nil
+}
+
+// Data exposes facts about the current file to context templates. Values are
+// computed on demand so unused fields cost nothing.
+type Data struct {
+	path     string
+	content  string
+	language types.Language
+}
+
+// Path returns the path as given on the command line
+func (d *Data) Path() string { return d.path }
+
+// RelPath returns the path relative to the working directory when possible
+func (d *Data) RelPath() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return d.path
+	}
+	if rel, err := filepath.Rel(wd, d.AbsPath()); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return d.path
+}
+
+// AbsPath returns the absolute path
+func (d *Data) AbsPath() string {
+	abs, err := filepath.Abs(d.path)
+	if err != nil {
+		return d.path
+	}
+	return abs
+}
+
+// Dir returns the directory of the file relative to the working directory
+func (d *Data) Dir() string { return filepath.ToSlash(filepath.Dir(d.RelPath())) }
+
+// Base returns the file name
+func (d *Data) Base() string { return filepath.Base(d.path) }
+
+// Ext returns the file extension
+func (d *Data) Ext() string { return filepath.Ext(d.path) }
+
+// Language returns the detected language
+func (d *Data) Language() string { return string(d.language) }
+
+// Size returns the file size in bytes, or an empty string
+func (d *Data) Size() string {
+	if info, err := os.Stat(d.path); err == nil {
+		return fmt.Sprintf("%d bytes", info.Size())
+	}
+	return ""
+}
+
+// Modified returns the file's modification time
+func (d *Data) Modified() string {
+	if info, err := os.Stat(d.path); err == nil {
+		return info.ModTime().Format("2006-01-02 15:04:05")
+	}
+	return ""
+}
+
+// Mode returns the file's permission bits
+func (d *Data) Mode() string {
+	if info, err := os.Stat(d.path); err == nil {
+		return info.Mode().String()
+	}
+	return ""
+}
+
+// GitRoot returns the root of the enclosing git repository
+func (d *Data) GitRoot() string { return utils.GitRoot(filepath.Dir(d.AbsPath())) }
+
+// GitPath returns the path from the git root
+func (d *Data) GitPath() string {
+	root := d.GitRoot()
+	if root == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(root, d.AbsPath())
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Project describes the kind of project the file belongs to
+func (d *Data) Project() string {
+	root := d.GitRoot()
+	if root == "" {
+		root, _ = os.Getwd()
+	}
+	return detectProject(root)
+}
+
+// Package returns the package or module the file belongs to
+func (d *Data) Package() string { return detectPackage(d.AbsPath(), d.content, d.language) }
+
+// Siblings lists the other files in the file's directory
+func (d *Data) Siblings() []string {
+	entries, err := os.ReadDir(filepath.Dir(d.path))
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == d.Base() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		names = append(names, name)
+		if len(names) == maxSiblings {
+			break
+		}
+	}
+	return names
+}
+
+// Readme returns the content of the nearest README, truncated
+func (d *Data) Readme() string {
+	_, content := d.nearestReadme()
+	return content
+}
+
+// ReadmePath returns the path of the nearest README
+func (d *Data) ReadmePath() string {
+	path, _ := d.nearestReadme()
+	return path
+}
+
+// OS returns the operating system
+func (d *Data) OS() string { return runtime.GOOS }
+
+// Arch returns the CPU architecture
+func (d *Data) Arch() string { return runtime.GOARCH }
+
+// User returns the current username
+func (d *Data) User() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
+
+// Now returns the current time. Including it defeats prompt caching.
+func (d *Data) Now() string { return time.Now().Format("2006-01-02 15:04:05 MST") }
+
+// Env returns an environment variable
+func (d *Data) Env(name string) string { return os.Getenv(name) }
+
+// readmeBlock formats the nearest README for the field list
+func (d *Data) readmeBlock() string {
+	path, content := d.nearestReadme()
+	if path == "" {
+		return ""
+	}
+	return fmt.Sprintf("--- %s ---\n%s", path, strings.TrimSpace(content))
+}
+
+// nearestReadme walks up from the file's directory to the git root (or the
+// filesystem root) and returns the first README found
+func (d *Data) nearestReadme() (string, string) {
+	dir := filepath.Dir(d.AbsPath())
+	stop := d.GitRoot()
+
+	for {
+		for _, name := range []string{"README.md", "README", "README.txt", "README.rst", "readme.md"} {
+			path := filepath.Join(dir, name)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			if len(data) > maxReadmeBytes {
+				data = append(data[:maxReadmeBytes], []byte("\n...")...)
+			}
+			rel := path
+			if wd, err := os.Getwd(); err == nil {
+				if r, err := filepath.Rel(wd, path); err == nil {
+					rel = r
+				}
+			}
+			return filepath.ToSlash(rel), string(data)
+		}
+
+		parent := filepath.Dir(dir)
+		if dir == stop || parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// detectProject tries to detect what kind of project a directory holds
+func detectProject(dir string) string {
+	projectFiles := []struct{ file, kind string }{
+		{"go.mod", "Go module"},
+		{"package.json", "Node.js"},
+		{"Cargo.toml", "Rust"},
+		{"pom.xml", "Maven/Java"},
+		{"build.gradle", "Gradle/Java"},
+		{"pyproject.toml", "Python"},
+		{"requirements.txt", "Python"},
+		{"Pipfile", "Python/Pipenv"},
+		{"composer.json", "PHP/Composer"},
+		{"Gemfile", "Ruby/Bundler"},
+		{"Dockerfile", "Docker"},
+		{"docker-compose.yml", "Docker Compose"},
+		{"Makefile", "Make"},
+		{"CMakeLists.txt", "CMake"},
+	}
+
+	var kinds []string
+	seen := make(map[string]bool)
+	for _, pf := range projectFiles {
+		if _, err := os.Stat(filepath.Join(dir, pf.file)); err == nil && !seen[pf.kind] {
+			kinds = append(kinds, pf.kind)
+			seen[pf.kind] = true
+		}
+	}
+	return strings.Join(kinds, ", ")
+}
+
+var (
+	goPackagePattern   = regexp.MustCompile(`(?m)^package\s+(\w+)`)
+	javaPackagePattern = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)\s*;`)
+	namespacePattern   = regexp.MustCompile(`(?m)^\s*namespace\s+([\w.\\]+)`)
+	cargoNamePattern   = regexp.MustCompile(`(?m)^name\s*=\s*"([^"]+)"`)
+)
+
+// detectPackage finds the package a file declares or the manifest it belongs to
+func detectPackage(absPath, content string, language types.Language) string {
+	switch language {
+	case types.LangGo:
+		if m := goPackagePattern.FindStringSubmatch(content); m != nil {
+			if module := goModule(filepath.Dir(absPath)); module != "" {
+				return fmt.Sprintf("%s (module %s)", m[1], module)
+			}
+			return m[1]
+		}
+	case types.LangJava:
+		if m := javaPackagePattern.FindStringSubmatch(content); m != nil {
+			return m[1]
+		}
+	case types.LangPHP:
+		if m := namespacePattern.FindStringSubmatch(content); m != nil {
+			return m[1]
+		}
+	case types.LangPython:
+		return pythonPackage(absPath)
+	case types.LangJavaScript, types.LangTypeScript:
+		return nodePackage(filepath.Dir(absPath))
+	case types.LangRust:
+		if path := utils.FindUp(filepath.Dir(absPath), "Cargo.toml"); path != "" {
+			if data, err := os.ReadFile(path); err == nil {
+				if m := cargoNamePattern.FindSubmatch(data); m != nil {
+					return string(m[1])
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// goModule returns the module path from the nearest go.mod
+func goModule(dir string) string {
+	path := utils.FindUp(dir, "go.mod")
+	if path == "" {
+		return ""
+	}
+	return utils.GoModulePath(path)
+}
+
+// pythonPackage builds a dotted package path from __init__.py directories
+func pythonPackage(absPath string) string {
+	var parts []string
+	dir := filepath.Dir(absPath)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "__init__.py")); err != nil {
+			break
+		}
+		parts = append([]string{filepath.Base(dir)}, parts...)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return strings.Join(parts, ".")
+}
+
+// nodePackage returns the name from the nearest package.json
+func nodePackage(dir string) string {
+	path := utils.FindUp(dir, "package.json")
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	var manifest struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(data, &manifest) != nil {
+		return ""
+	}
+	return manifest.Name
+}
@@ -0,0 +1,64 @@
+package gitdiff
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChangedFiles lists the files that differ from where the current branch
+// left ref: commits on the branch, staged and unstaged edits, and new
+// untracked files. Deleted files are left out. Paths are absolute.
+func ChangedFiles(ref string) ([]string, error) {
+	root, err := git("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("not in a git repository: %w", err)
+	}
+	root = strings.TrimSpace(root)
+
+	base, err := git(root, "merge-base", ref, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("cannot compare with %s: %w", ref, err)
+	}
+
+	changed, err := git(root, "diff", "--name-only", "-z", "--diff-filter=d", strings.TrimSpace(base))
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(root, "ls-files", "--others", "--exclude-standard", "--full-name", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, name := range strings.Split(changed+untracked, "\x00") {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		paths = append(paths, filepath.Join(root, filepath.FromSlash(name)))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// git runs a git command in dir and returns its output
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
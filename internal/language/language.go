@@ -48,6 +48,8 @@ func DetectLanguage(filePath string) types.Language {
 		return types.LangYAML
 	case ".md", ".markdown":
 		return types.LangMarkdown
+	case ".ipynb":
+		return types.LangNotebook
 	case ".txt", ".text", "":
 		return types.LangText
 	default:
@@ -75,7 +77,8 @@ func GetCommentStyle(lang types.Language) types.CommentStyle {
 			BlockStart:  "/*",
 			BlockEnd:    "*/",
 		}
-	case types.LangPython, types.LangShell, types.LangRuby:
+	case types.LangPython, types.LangShell, types.LangRuby, types.LangNotebook:
+		// Notebook code cells are mostly Python
 		return types.CommentStyle{
 			LineComment: "#",
 		}
@@ -139,6 +142,8 @@ func GetFileExtensions(lang types.Language) []string {
 		return []string{".yaml", ".yml"}
 	case types.LangMarkdown:
 		return []string{".md", ".markdown"}
+	case types.LangNotebook:
+		return []string{".ipynb"}
 	case types.LangText:
 		return []string{".txt", ".text"}
 	default:
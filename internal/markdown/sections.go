@@ -0,0 +1,216 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// atxHeading matches an ATX heading line: up to three spaces, one to six
+// #s, then a space or the end of the line
+var atxHeading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]|$)`)
+
+// Section is a heading and everything under it, up to the next heading of
+// the same or a higher level
+type Section struct {
+	Heading string // The heading line, e.g. "## Troubleshooting"
+	Level   int
+
+	start, end int // Byte span, without the blank lines that follow it
+	fences     [][2]int
+}
+
+// line is one line of a document with the byte offsets of its start and
+// of its next line
+type line struct {
+	text       string
+	start, end int
+}
+
+// Sections finds the sections whose heading line matches one of patterns,
+// in document order. A section nested in one already selected is part of
+// it and isn't selected again. Headings in code fences and front matter
+// are ignored.
+func Sections(content string, patterns []*regexp.Regexp) []*Section {
+	lines := splitLines(content)
+	first := frontMatterEnd(lines)
+
+	type heading struct {
+		index, level int
+	}
+	var headings []heading
+	var fences [][2]int
+	fenceStart, fence := -1, ""
+	for i := first; i < len(lines); i++ {
+		text := lines[i].text
+		if fence != "" {
+			if closesFence(text, fence) {
+				fences = append(fences, [2]int{lines[fenceStart].start, lines[i].end})
+				fence = ""
+			}
+			continue
+		}
+		if marker := openFence(text); marker != "" {
+			fenceStart, fence = i, marker
+			continue
+		}
+		if m := atxHeading.FindStringSubmatch(text); m != nil {
+			headings = append(headings, heading{index: i, level: len(m[1])})
+		}
+	}
+	if fence != "" {
+		// An unclosed fence runs to the end of the document
+		fences = append(fences, [2]int{lines[fenceStart].start, len(content)})
+	}
+
+	var sections []*Section
+	selectedEnd := 0
+	for h, hd := range headings {
+		start := lines[hd.index].start
+		text := strings.TrimSpace(lines[hd.index].text)
+		if start < selectedEnd || !matchesAny(patterns, text) {
+			continue
+		}
+
+		end := len(content)
+		for _, next := range headings[h+1:] {
+			if next.level <= hd.level {
+				end = lines[next.index].start
+				break
+			}
+		}
+		selectedEnd = end
+		// Blank lines before the next heading stay where they are
+		end = start + len(strings.TrimRight(content[start:end], " \t\r\n"))
+
+		s := &Section{Heading: text, Level: hd.level, start: start, end: end}
+		for _, f := range fences {
+			if f[0] >= start && f[0] < end {
+				s.fences = append(s.fences, [2]int{f[0], min(f[1], end)})
+			}
+		}
+		sections = append(sections, s)
+	}
+	return sections
+}
+
+// Text returns the section's content
+func (s *Section) Text(content string) string {
+	return content[s.start:s.end]
+}
+
+// Masked returns the section's content with each code block replaced by a
+// placeholder, and the code blocks in order, for Unmask
+func (s *Section) Masked(content string) (string, []string) {
+	var b strings.Builder
+	var blocks []string
+	pos := s.start
+	for i, f := range s.fences {
+		b.WriteString(content[pos:f[0]])
+		block := content[f[0]:f[1]]
+		trimmed := strings.TrimRight(block, "\r\n")
+		blocks = append(blocks, trimmed)
+		b.WriteString(placeholder(i + 1))
+		b.WriteString(block[len(trimmed):])
+		pos = f[1]
+	}
+	b.WriteString(content[pos:s.end])
+	return b.String(), blocks
+}
+
+// Unmask puts code blocks back in place of their placeholders. Each must
+// appear exactly once, so a block the model dropped or repeated is an error.
+func Unmask(text string, blocks []string) (string, error) {
+	for i, block := range blocks {
+		mark := placeholder(i + 1)
+		switch n := strings.Count(text, mark); {
+		case n == 0:
+			return "", fmt.Errorf("code block %d (%s) was removed", i+1, mark)
+		case n > 1:
+			return "", fmt.Errorf("code block %d (%s) appears %d times", i+1, mark, n)
+		}
+		text = strings.Replace(text, mark, block, 1)
+	}
+	return text, nil
+}
+
+// PlaceholderNote tells the model how to treat the placeholders of Masked
+func PlaceholderNote() string {
+	return fmt.Sprintf("Lines like %s stand for code blocks that must not change. Keep each one exactly once, on its own line, where the code belongs.", placeholder(1))
+}
+
+// Span returns the byte offsets of the section, for region.Replace
+func (s *Section) Span() (int, int) {
+	return s.start, s.end
+}
+
+// splitLines splits content into lines, keeping their offsets. Text has
+// no line ending.
+func splitLines(content string) []line {
+	var lines []line
+	for start := 0; start < len(content); {
+		end := strings.IndexByte(content[start:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += start + 1
+		}
+		lines = append(lines, line{text: strings.TrimRight(content[start:end], "\r\n"), start: start, end: end})
+		start = end
+	}
+	return lines
+}
+
+// frontMatterEnd returns the index of the first line after YAML (---) or
+// TOML (+++) front matter, or 0 when there is none
+func frontMatterEnd(lines []line) int {
+	if len(lines) == 0 || (lines[0].text != "---" && lines[0].text != "+++") {
+		return 0
+	}
+	for i := 1; i < len(lines); i++ {
+		if lines[i].text == lines[0].text || (lines[0].text == "---" && lines[i].text == "...") {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// openFence returns the marker of a line opening a code fence: three or
+// more backticks or tildes after up to three spaces
+func openFence(text string) string {
+	trimmed := strings.TrimLeft(text, " ")
+	if len(text)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return ""
+	}
+	c := trimmed[0]
+	if c != '`' && c != '~' {
+		return ""
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, string(c)))
+	if n < 3 || (c == '`' && strings.Contains(trimmed[n:], "`")) {
+		return ""
+	}
+	return trimmed[:n]
+}
+
+// closesFence reports whether text closes a fence opened with marker: the
+// same character, at least as many, and nothing after it
+func closesFence(text, marker string) bool {
+	trimmed := strings.TrimSpace(text)
+	return len(text)-len(strings.TrimLeft(text, " ")) <= 3 &&
+		len(trimmed) >= len(marker) &&
+		strings.Trim(trimmed, marker[:1]) == ""
+}
+
+func placeholder(n int) string {
+	return fmt.Sprintf("<!-- presto:code %d -->", n)
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, p := range patterns {
+		if p.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
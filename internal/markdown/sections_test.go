@@ -0,0 +1,142 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSections(t *testing.T) {
+	doc := strings.Join([]string{
+		"---",
+		"# Not a heading: front matter",
+		"---",
+		"# Guide",
+		"",
+		"## Install",
+		"Run it.",
+		"",
+		"### Install on Linux",
+		"apt install",
+		"",
+		"```sh",
+		"# not a heading: in a fence",
+		"```",
+		"",
+		"## Usage",
+		"Use it.",
+		"",
+		"",
+		"## Install again",
+		"~~~",
+		"## fenced",
+	}, "\n") + "\n"
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string // Headings of the selected sections
+	}{
+		{"top level takes everything", []string{"^# Guide$"}, []string{"# Guide"}},
+		{"nested section inside a selected one", []string{"Install"}, []string{"## Install", "## Install again"}},
+		{"nested section alone", []string{"Linux"}, []string{"### Install on Linux"}},
+		{"front matter and fences ignored", []string{"not a heading", "fenced"}, nil},
+		{"several patterns", []string{"Usage", "Linux"}, []string{"### Install on Linux", "## Usage"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patterns []*regexp.Regexp
+			for _, p := range tt.patterns {
+				patterns = append(patterns, regexp.MustCompile(p))
+			}
+			var got []string
+			for _, s := range Sections(doc, patterns) {
+				got = append(got, s.Heading)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSectionSpan(t *testing.T) {
+	doc := strings.Join([]string{
+		"# A",
+		"",
+		"## B",
+		"text",
+		"",
+		"",
+		"## C",
+		"more",
+		"",
+	}, "\n") + "\n"
+	sections := Sections(doc, []*regexp.Regexp{regexp.MustCompile("^## ")})
+	if len(sections) != 2 {
+		t.Fatalf("got %d sections, want 2", len(sections))
+	}
+	if got := sections[0].Text(doc); got != "## B\ntext" {
+		t.Errorf("section B = %q", got)
+	}
+	// The blank lines between sections stay outside both
+	_, end := sections[0].Span()
+	start, _ := sections[1].Span()
+	if got := doc[end:start]; got != "\n\n\n" {
+		t.Errorf("between B and C: %q, want three newlines", got)
+	}
+	if got := sections[1].Text(doc); got != "## C\nmore" {
+		t.Errorf("section C = %q", got)
+	}
+}
+
+func TestMaskedUnmask(t *testing.T) {
+	doc := strings.Join([]string{
+		"## Example",
+		"Before.",
+		"```go",
+		"x := 1",
+		"```",
+		"Between.",
+		"~~~",
+		"raw",
+		"~~~",
+		"After.",
+	}, "\n") + "\n"
+	sections := Sections(doc, []*regexp.Regexp{regexp.MustCompile("Example")})
+	if len(sections) != 1 {
+		t.Fatalf("got %d sections, want 1", len(sections))
+	}
+	masked, blocks := sections[0].Masked(doc)
+	wantMasked := strings.Join([]string{"## Example", "Before.", placeholder(1), "Between.", placeholder(2), "After."}, "\n")
+	if masked != wantMasked {
+		t.Errorf("masked:\n%s\nwant:\n%s", masked, wantMasked)
+	}
+	if len(blocks) != 2 || blocks[0] != "```go\nx := 1\n```" || blocks[1] != "~~~\nraw\n~~~" {
+		t.Errorf("blocks = %q", blocks)
+	}
+
+	restored, err := Unmask(masked, blocks)
+	if err != nil {
+		t.Fatalf("Unmask: %v", err)
+	}
+	if restored != sections[0].Text(doc) {
+		t.Errorf("round trip:\n%s\nwant:\n%s", restored, sections[0].Text(doc))
+	}
+
+	tests := []struct {
+		name string
+		text string
+		err  string
+	}{
+		{"dropped block", strings.Replace(masked, placeholder(2), "", 1), "code block 2"},
+		{"duplicated block", masked + "\n" + placeholder(1), "appears 2 times"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Unmask(tt.text, blocks); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package merge
+
+import (
+	"strings"
+)
+
+// maxLCSCells bounds the size of the LCS table; larger inputs fall back to
+// treating the differing middle section as a single hunk
+const maxLCSCells = 25_000_000
+
+// Conflict markers written around hunks that could not be merged
+const (
+	MarkerOurs   = "<<<<<<< presto"
+	MarkerBase   = "||||||| original"
+	MarkerSep    = "======="
+	MarkerTheirs = ">>>>>>> on disk"
+)
+
+// Result is the outcome of a three-way merge
+type Result struct {
+	Content   string
+	Conflicts int
+}
+
+// ThreeWay merges two descendants of base line by line. Hunks changed on only
+// one side are taken from that side; hunks changed identically on both sides
+// are taken once; anything else is emitted between conflict markers.
+func ThreeWay(base, ours, theirs string) Result {
+	b := splitLines(base)
+	o := splitLines(ours)
+	t := splitLines(theirs)
+
+	matchO := lcsMatch(b, o)
+	matchT := lcsMatch(b, t)
+
+	var out strings.Builder
+	conflicts := 0
+	i, j, k := 0, 0, 0
+
+	for {
+		// Find the next base line that both sides kept, in order
+		sync := -1
+		for x := i; x < len(b); x++ {
+			if matchO[x] >= j && matchT[x] >= k {
+				sync = x
+				break
+			}
+		}
+
+		endB, endO, endT := len(b), len(o), len(t)
+		if sync >= 0 {
+			endB, endO, endT = sync, matchO[sync], matchT[sync]
+		}
+
+		if !resolveHunk(&out, b[i:endB], o[j:endO], t[k:endT]) {
+			conflicts++
+		}
+
+		if sync < 0 {
+			break
+		}
+
+		out.WriteString(b[sync])
+		i, j, k = sync+1, matchO[sync]+1, matchT[sync]+1
+	}
+
+	return Result{Content: out.String(), Conflicts: conflicts}
+}
+
+// resolveHunk writes the merged form of a hunk and reports whether it merged cleanly
+func resolveHunk(out *strings.Builder, base, ours, theirs []string) bool {
+	switch {
+	case equal(ours, base):
+		writeLines(out, theirs)
+	case equal(theirs, base), equal(ours, theirs):
+		writeLines(out, ours)
+	default:
+		writeMarker(out, MarkerOurs)
+		writeLines(out, ours)
+		writeMarker(out, MarkerBase)
+		writeLines(out, base)
+		writeMarker(out, MarkerSep)
+		writeLines(out, theirs)
+		writeMarker(out, MarkerTheirs)
+		return false
+	}
+	return true
+}
+
+// lcsMatch returns, for every line of a, the index of the matching line in b
+// (or -1) according to a longest common subsequence
+func lcsMatch(a, b []string) []int {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+
+	// Common prefix and suffix are matched directly
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		match[pre] = pre
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		match[len(a)-1-suf] = len(b) - 1 - suf
+		suf++
+	}
+
+	ma := a[pre : len(a)-suf]
+	mb := b[pre : len(b)-suf]
+	n, m := len(ma), len(mb)
+	if n == 0 || m == 0 || n*m > maxLCSCells {
+		return match
+	}
+
+	// table[x][y] holds the LCS length of ma[x:] and mb[y:]
+	table := make([][]int32, n+1)
+	for x := range table {
+		table[x] = make([]int32, m+1)
+	}
+	for x := n - 1; x >= 0; x-- {
+		for y := m - 1; y >= 0; y-- {
+			if ma[x] == mb[y] {
+				table[x][y] = table[x+1][y+1] + 1
+			} else if table[x+1][y] >= table[x][y+1] {
+				table[x][y] = table[x+1][y]
+			} else {
+				table[x][y] = table[x][y+1]
+			}
+		}
+	}
+
+	for x, y := 0, 0; x < n && y < m; {
+		switch {
+		case ma[x] == mb[y]:
+			match[pre+x] = pre + y
+			x++
+			y++
+		case table[x+1][y] >= table[x][y+1]:
+			x++
+		default:
+			y++
+		}
+	}
+
+	return match
+}
+
+// splitLines splits content into lines, keeping line terminators
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
+
+func writeMarker(out *strings.Builder, marker string) {
+	// Keep markers on their own line even if the previous hunk lacked a newline
+	if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		out.WriteString("\n")
+	}
+	out.WriteString(marker + "\n")
+}
@@ -0,0 +1,123 @@
+package merge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestThreeWay(t *testing.T) {
+	base := "a\nb\nc\nd\ne\n"
+
+	tests := []struct {
+		name          string
+		ours, theirs  string
+		want          string
+		wantConflicts int
+	}{
+		{
+			name:   "unchanged",
+			ours:   base,
+			theirs: base,
+			want:   base,
+		},
+		{
+			name:   "only ours changed",
+			ours:   "a\nB\nc\nd\ne\n",
+			theirs: base,
+			want:   "a\nB\nc\nd\ne\n",
+		},
+		{
+			name:   "only theirs changed",
+			ours:   base,
+			theirs: "a\nb\nc\nD\ne\n",
+			want:   "a\nb\nc\nD\ne\n",
+		},
+		{
+			name:   "clean merge of separate edits",
+			ours:   "A\nb\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\nE\n",
+			want:   "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:   "identical edits",
+			ours:   "a\nb\nC\nd\ne\n",
+			theirs: "a\nb\nC\nd\ne\n",
+			want:   "a\nb\nC\nd\ne\n",
+		},
+		{
+			name:   "insert at EOF",
+			ours:   "a\nb\nc\nd\ne\nf\n",
+			theirs: "A\nb\nc\nd\ne\n",
+			want:   "A\nb\nc\nd\ne\nf\n",
+		},
+		{
+			name:   "identical insert at EOF",
+			ours:   "a\nb\nc\nd\ne\nf\n",
+			theirs: "a\nb\nc\nd\ne\nf\n",
+			want:   "a\nb\nc\nd\ne\nf\n",
+		},
+		{
+			name:   "deletion on one side",
+			ours:   "a\nb\nd\ne\n",
+			theirs: "a\nb\nc\nd\nE\n",
+			want:   "a\nb\nd\nE\n",
+		},
+		{
+			name:   "overlapping edit",
+			ours:   "a\nb\nours\nd\ne\n",
+			theirs: "a\nb\ntheirs\nd\ne\n",
+			want: "a\nb\n" +
+				MarkerOurs + "\nours\n" +
+				MarkerBase + "\nc\n" +
+				MarkerSep + "\ntheirs\n" +
+				MarkerTheirs + "\nd\ne\n",
+			wantConflicts: 1,
+		},
+		{
+			name:   "different inserts at EOF",
+			ours:   "a\nb\nc\nd\ne\nours\n",
+			theirs: "a\nb\nc\nd\ne\ntheirs\n",
+			want: "a\nb\nc\nd\ne\n" +
+				MarkerOurs + "\nours\n" +
+				MarkerBase + "\n" +
+				MarkerSep + "\ntheirs\n" +
+				MarkerTheirs + "\n",
+			wantConflicts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ThreeWay(base, tt.ours, tt.theirs)
+			if got.Content != tt.want {
+				t.Errorf("content:\n%s\nwant:\n%s", got.Content, tt.want)
+			}
+			if got.Conflicts != tt.wantConflicts {
+				t.Errorf("conflicts = %d, want %d", got.Conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestThreeWayNoFinalNewline(t *testing.T) {
+	base := "a\nb\nc"
+	got := ThreeWay(base, "A\nb\nc", "a\nb\nC")
+	if got.Conflicts != 0 || got.Content != "A\nb\nC" {
+		t.Errorf("got %q with %d conflicts", got.Content, got.Conflicts)
+	}
+}
+
+func TestThreeWayConflictMarkersOnOwnLines(t *testing.T) {
+	// A side ending without a newline must not glue a marker onto its last line
+	got := ThreeWay("a\nb", "a\nours", "a\ntheirs")
+	if got.Conflicts != 1 {
+		t.Fatalf("conflicts = %d, want 1", got.Conflicts)
+	}
+	for _, line := range strings.Split(got.Content, "\n") {
+		for _, marker := range []string{MarkerOurs, MarkerBase, MarkerSep, MarkerTheirs} {
+			if strings.Contains(line, marker) && line != marker {
+				t.Errorf("marker not on its own line: %q", line)
+			}
+		}
+	}
+}
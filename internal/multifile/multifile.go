@@ -0,0 +1,228 @@
+package multifile
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Action is what a file block does to its path
+type Action string
+
+const (
+	ActionCreate  Action = "create"  // Write a file that does not exist yet
+	ActionReplace Action = "replace" // Overwrite an existing file
+	ActionDelete  Action = "delete"  // Remove an existing file
+)
+
+// Block markers of the response format
+const (
+	headerPrefix = "=== FILE: "
+	endMarker    = "=== END FILE ==="
+)
+
+// headerPattern matches "=== FILE: path (action) ==="
+var headerPattern = regexp.MustCompile(`^=== FILE: (.+?) \((create|replace|delete)\) ===$`)
+
+// Change is one file block of a multi-file response
+type Change struct {
+	Path    string // As written by the model, relative to the working directory
+	Action  Action
+	Content string // Empty for deletes
+}
+
+// Instructions describes the response format to the model
+func Instructions() string {
+	return `=== OUTPUT FORMAT ===
+Respond with one block per file you create, replace or delete, and nothing else:
+
+=== FILE: path/to/file.ext (create) ===
+<complete content of the new file>
+=== END FILE ===
+
+=== FILE: path/to/existing.ext (replace) ===
+<complete new content of the existing file>
+=== END FILE ===
+
+=== FILE: path/to/obsolete.ext (delete) ===
+=== END FILE ===
+
+Rules:
+- Paths are relative to the working directory, like the file labels above, and use forward slashes
+- "create" is only for files that do not exist; "replace" and "delete" only for files that do
+- Always write the whole file; never elide content or use placeholders
+- Do not wrap blocks in markdown code fences
+- Only touch files the task requires`
+}
+
+// Parse reads the file blocks of a response. Text outside blocks, such as a
+// stray explanation or code fence, is ignored; an unterminated block or a
+// path named twice is an error.
+func Parse(response string) ([]Change, error) {
+	var changes []Change
+	seen := make(map[string]bool)
+
+	var current *Change
+	var body []string
+
+	scanner := bufio.NewScanner(strings.NewReader(response))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if current == nil {
+			if !strings.HasPrefix(line, headerPrefix) {
+				continue
+			}
+			m := headerPattern.FindStringSubmatch(strings.TrimSpace(line))
+			if m == nil {
+				return nil, fmt.Errorf("malformed file header: %q", line)
+			}
+			path := strings.TrimSpace(m[1])
+			if seen[path] {
+				return nil, fmt.Errorf("%s appears more than once", path)
+			}
+			seen[path] = true
+			current = &Change{Path: path, Action: Action(m[2])}
+			body = body[:0]
+			continue
+		}
+
+		if strings.TrimSpace(line) == endMarker {
+			if current.Action != ActionDelete {
+				current.Content = strings.Join(body, "\n")
+				if len(body) > 0 {
+					current.Content += "\n"
+				}
+			}
+			changes = append(changes, *current)
+			current = nil
+			continue
+		}
+		body = append(body, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if current != nil {
+		return nil, fmt.Errorf("block for %s is not terminated (response truncated?)", current.Path)
+	}
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("response contains no file blocks")
+	}
+	return changes, nil
+}
+
+// Resolve checks every change against the project root and the file system
+// and returns the absolute path of each. Paths must be relative, stay inside
+// root once symlinks are followed, stay out of .git, and match their action:
+// creates must not exist, replaces and deletes must.
+func Resolve(changes []Change, root string) ([]string, error) {
+	rootAbs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(rootAbs); err == nil {
+		rootAbs = resolved
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(wd); err == nil {
+		wd = resolved
+	}
+
+	paths := make([]string, len(changes))
+	for i, change := range changes {
+		path, err := resolvePath(change.Path, wd, rootAbs)
+		if err != nil {
+			return nil, err
+		}
+
+		info, statErr := os.Lstat(path)
+		exists := statErr == nil
+		switch {
+		case exists && info.IsDir():
+			return nil, fmt.Errorf("%s is a directory", change.Path)
+		case change.Action == ActionCreate && exists:
+			return nil, fmt.Errorf("cannot create %s: it already exists", change.Path)
+		case change.Action != ActionCreate && !exists:
+			return nil, fmt.Errorf("cannot %s %s: it does not exist", change.Action, change.Path)
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+// resolvePath turns a model-supplied path into an absolute path inside root
+func resolvePath(path, wd, root string) (string, error) {
+	if path == "" || filepath.IsAbs(path) || filepath.VolumeName(path) != "" || strings.HasPrefix(path, "~") {
+		return "", fmt.Errorf("invalid path %q: must be relative to the project", path)
+	}
+
+	abs := filepath.Join(wd, filepath.FromSlash(path))
+	if !within(abs, root) {
+		return "", fmt.Errorf("path %q is outside the project root %s", path, root)
+	}
+
+	// Follow symlinks through the deepest existing ancestor so a link
+	// can't smuggle a write outside the root
+	existing := abs
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	if resolved, err := filepath.EvalSymlinks(existing); err == nil && !within(resolved, root) {
+		return "", fmt.Errorf("path %q leads outside the project root through a symlink", path)
+	}
+
+	rel, _ := filepath.Rel(root, abs)
+	if rel == ".git" || strings.HasPrefix(rel, ".git"+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q is inside .git", path)
+	}
+	return abs, nil
+}
+
+// within reports whether path is root or below it
+func within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// LineStats counts the lines added and removed going from old to new,
+// ignoring order
+func LineStats(old, new string) (added, removed int) {
+	counts := make(map[string]int)
+	for _, line := range splitLines(old) {
+		counts[line]++
+	}
+	for _, line := range splitLines(new) {
+		if counts[line] > 0 {
+			counts[line]--
+		} else {
+			added++
+		}
+	}
+	for _, n := range counts {
+		removed += n
+	}
+	return added, removed
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
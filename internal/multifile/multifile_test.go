@@ -0,0 +1,77 @@
+package multifile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// project creates a project root with an existing file, a .git directory
+// and a symlink to a directory outside it, and makes it the working directory
+func project(t *testing.T) string {
+	t.Helper()
+	base := t.TempDir()
+	root := filepath.Join(base, "project")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, ".git"), filepath.Join(root, "sub"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	t.Chdir(root)
+	return root
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		action  Action
+		wantErr bool
+	}{
+		{"replace existing", "main.go", ActionReplace, false},
+		{"create new", "sub/new.go", ActionCreate, false},
+		{"create in new directory", "pkg/util/util.go", ActionCreate, false},
+		{"dot file beside .git", ".gitignore", ActionCreate, false},
+		{"parent directory", "../escape.go", ActionCreate, true},
+		{"parent inside path", "sub/../../escape.go", ActionCreate, true},
+		{"absolute", "/etc/passwd", ActionReplace, true},
+		{"home", "~/.bashrc", ActionReplace, true},
+		{"empty", "", ActionCreate, true},
+		{"through symlink", "link/evil.go", ActionCreate, true},
+		{"symlink itself", "link", ActionReplace, true},
+		{"git directory", ".git/config", ActionCreate, true},
+		{"git hooks", ".git/hooks/pre-commit", ActionCreate, true},
+		{"create existing", "main.go", ActionCreate, true},
+		{"replace missing", "missing.go", ActionReplace, true},
+		{"delete directory", "sub", ActionDelete, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := project(t)
+			paths, err := Resolve([]Change{{Path: tt.path, Action: tt.action}}, root)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Resolve(%q) = %v, want an error", tt.path, paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q): %v", tt.path, err)
+			}
+			rel, err := filepath.Rel(root, paths[0])
+			if err != nil || rel != filepath.FromSlash(tt.path) {
+				resolvedRoot, _ := filepath.EvalSymlinks(root)
+				if rel, _ = filepath.Rel(resolvedRoot, paths[0]); rel != filepath.FromSlash(tt.path) {
+					t.Errorf("Resolve(%q) = %s, want it under %s", tt.path, paths[0], root)
+				}
+			}
+		})
+	}
+}
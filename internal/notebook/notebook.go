@@ -0,0 +1,198 @@
+package notebook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/structured"
+)
+
+// Cell types, and the --cells targets that pick them
+const (
+	CellCode     = "code"
+	CellMarkdown = "markdown"
+	CellAll      = "all"
+)
+
+// sourceSelector finds the source of every cell
+var sourceSelector = structured.MustParseSelector("$.cells[*].source")
+
+// Cell is one cell of a notebook
+type Cell struct {
+	Number int // 1-based
+	Type   string
+	Source string
+
+	start, end int // Byte span of the source value
+}
+
+// Notebook is a parsed nbformat 4 notebook. Only cell sources can change;
+// outputs, metadata and formatting are written back as they were read.
+type Notebook struct {
+	Language string // The kernel's language, e.g. "python"
+	Cells    []*Cell
+
+	content string
+}
+
+// ValidTarget reports whether target names cells --cells can select
+func ValidTarget(target string) bool {
+	switch target {
+	case "", CellCode, CellMarkdown, CellAll:
+		return true
+	}
+	return false
+}
+
+// Parse reads a notebook
+func Parse(content string) (*Notebook, error) {
+	var doc struct {
+		NBFormat int `json:"nbformat"`
+		Metadata struct {
+			Kernelspec struct {
+				Language string `json:"language"`
+			} `json:"kernelspec"`
+			LanguageInfo struct {
+				Name string `json:"name"`
+			} `json:"language_info"`
+		} `json:"metadata"`
+		Cells []struct {
+			CellType string          `json:"cell_type"`
+			Source   json.RawMessage `json:"source"`
+		} `json:"cells"`
+	}
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, fmt.Errorf("invalid notebook: %w", err)
+	}
+	if doc.NBFormat < 4 {
+		return nil, fmt.Errorf("nbformat %d notebooks aren't supported; save it as version 4", doc.NBFormat)
+	}
+
+	spans, err := structured.Spans(content, sourceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notebook: %w", err)
+	}
+	if len(spans) != len(doc.Cells) {
+		return nil, fmt.Errorf("invalid notebook: %d of %d cells have a source", len(spans), len(doc.Cells))
+	}
+
+	nb := &Notebook{Language: doc.Metadata.LanguageInfo.Name, content: content}
+	if nb.Language == "" {
+		nb.Language = doc.Metadata.Kernelspec.Language
+	}
+	for i, c := range doc.Cells {
+		source, err := decodeSource(c.Source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source in cell %d: %w", i+1, err)
+		}
+		nb.Cells = append(nb.Cells, &Cell{
+			Number: i + 1,
+			Type:   c.CellType,
+			Source: source,
+			start:  spans[i].Start,
+			end:    spans[i].End,
+		})
+	}
+	return nb, nil
+}
+
+// Targets returns the cells target selects: code, markdown or all (also
+// the default). Raw cells are only included in all.
+func (nb *Notebook) Targets(target string) []*Cell {
+	var cells []*Cell
+	for _, c := range nb.Cells {
+		if target == "" || target == CellAll || c.Type == target {
+			cells = append(cells, c)
+		}
+	}
+	return cells
+}
+
+// Text renders the cells as a script in the percent format, without
+// outputs; it is how a notebook is read when sent as context
+func (nb *Notebook) Text() string {
+	var b strings.Builder
+	for i, c := range nb.Cells {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "# %%%% cell %d [%s]\n", c.Number, c.Type)
+		b.WriteString(strings.TrimRight(c.Source, "\n"))
+	}
+	return b.String()
+}
+
+// Apply returns the notebook with new sources for the cells, keyed by cell
+// number. Everything else is kept byte for byte.
+func (nb *Notebook) Apply(sources map[int]string) string {
+	cells := make([]*Cell, 0, len(sources))
+	for _, c := range nb.Cells {
+		if source, ok := sources[c.Number]; ok && source != c.Source {
+			cells = append(cells, c)
+		}
+	}
+	sort.Slice(cells, func(i, j int) bool { return cells[i].start > cells[j].start })
+
+	out := nb.content
+	for _, c := range cells {
+		out = out[:c.start] + nb.encodeSource(c, sources[c.Number]) + out[c.end:]
+	}
+	return out
+}
+
+// decodeSource reads a cell source, which nbformat allows as one string or
+// as a list of lines
+func decodeSource(raw json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// encodeSource writes a new source for c the way its old one was written: a
+// string stays a string, and a list of lines keeps Jupyter's one line per
+// element layout at the indentation of the cell
+func (nb *Notebook) encodeSource(c *Cell, source string) string {
+	old := nb.content[c.start:c.end]
+	if strings.HasPrefix(old, `"`) {
+		return quote(source)
+	}
+	if source == "" {
+		return "[]"
+	}
+
+	line := nb.content[strings.LastIndexByte(nb.content[:c.start], '\n')+1:]
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+
+	var b strings.Builder
+	b.WriteString("[")
+	for i, line := range strings.SplitAfter(source, "\n") {
+		if line == "" {
+			continue
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n" + indent + " " + quote(line))
+	}
+	b.WriteString("\n" + indent + "]")
+	return b.String()
+}
+
+// quote renders s as a JSON string, leaving HTML characters as they are,
+// as Jupyter does
+func quote(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,158 @@
+package notebook
+
+import (
+	"strings"
+	"testing"
+)
+
+// notebookJSON is laid out the way Jupyter saves notebooks
+const notebookJSON = `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# Title\n",
+    "Some <b>text</b>"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 1,
+   "metadata": {},
+   "outputs": [{"output_type": "stream", "name": "stdout", "text": ["1\n"]}],
+   "source": "x = 1\nprint(x)"
+  },
+  {
+   "cell_type": "code",
+   "execution_count": null,
+   "metadata": {},
+   "outputs": [],
+   "source": []
+  }
+ ],
+ "metadata": {
+  "kernelspec": {"display_name": "Python 3", "language": "python", "name": "python3"},
+  "language_info": {"name": "python"}
+ },
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+`
+
+func TestParse(t *testing.T) {
+	nb, err := Parse(notebookJSON)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if nb.Language != "python" {
+		t.Errorf("Language = %q, want python", nb.Language)
+	}
+	want := []Cell{
+		{Number: 1, Type: CellMarkdown, Source: "# Title\nSome <b>text</b>"},
+		{Number: 2, Type: CellCode, Source: "x = 1\nprint(x)"},
+		{Number: 3, Type: CellCode, Source: ""},
+	}
+	if len(nb.Cells) != len(want) {
+		t.Fatalf("got %d cells, want %d", len(nb.Cells), len(want))
+	}
+	for i, w := range want {
+		c := nb.Cells[i]
+		if c.Number != w.Number || c.Type != w.Type || c.Source != w.Source {
+			t.Errorf("cell %d: got %d %s %q, want %d %s %q", i+1, c.Number, c.Type, c.Source, w.Number, w.Type, w.Source)
+		}
+	}
+	if got := len(nb.Targets(CellCode)); got != 2 {
+		t.Errorf("Targets(code) = %d cells, want 2", got)
+	}
+	if got := len(nb.Targets("")); got != 3 {
+		t.Errorf("Targets(\"\") = %d cells, want 3", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"not JSON", "{", "invalid notebook"},
+		{"nbformat 3", `{"nbformat": 3, "worksheets": []}`, "nbformat 3"},
+		{"missing nbformat", `{"cells": []}`, "nbformat 0"},
+		{"cell without source", `{"nbformat": 4, "cells": [{"cell_type": "code"}]}`, "0 of 1 cells"},
+		{"source not text", `{"nbformat": 4, "cells": [{"cell_type": "code", "source": 5}]}`, "cell 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestKernelspecLanguage(t *testing.T) {
+	nb, err := Parse(`{"nbformat": 4, "metadata": {"kernelspec": {"language": "R"}}, "cells": []}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb.Language != "R" {
+		t.Errorf("Language = %q, want R", nb.Language)
+	}
+}
+
+func TestApply(t *testing.T) {
+	nb, err := Parse(notebookJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Unchanged sources leave every byte in place
+	if got := nb.Apply(map[int]string{1: nb.Cells[0].Source, 2: nb.Cells[1].Source}); got != notebookJSON {
+		t.Errorf("unchanged Apply rewrote the notebook:\n%s", got)
+	}
+
+	got := nb.Apply(map[int]string{
+		1: "# New <i>title</i>\n",
+		2: "y = 2",
+		3: "a\nb",
+	})
+	want := strings.NewReplacer(
+		`"source": [
+    "# Title\n",
+    "Some <b>text</b>"
+   ]`, `"source": [
+    "# New <i>title</i>\n"
+   ]`,
+		`"source": "x = 1\nprint(x)"`, `"source": "y = 2"`,
+		`"source": []`, `"source": [
+    "a\n",
+    "b"
+   ]`,
+	).Replace(notebookJSON)
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	reparsed, err := Parse(got)
+	if err != nil {
+		t.Fatalf("Parse after Apply: %v", err)
+	}
+	if reparsed.Cells[2].Source != "a\nb" {
+		t.Errorf("cell 3 source = %q, want %q", reparsed.Cells[2].Source, "a\nb")
+	}
+}
+
+func TestApplyEmptiesList(t *testing.T) {
+	nb, err := Parse(notebookJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := nb.Apply(map[int]string{1: ""})
+	if !strings.Contains(got, `"cell_type": "markdown",
+   "metadata": {},
+   "source": []`) {
+		t.Errorf("emptied list source not written as []:\n%s", got)
+	}
+}
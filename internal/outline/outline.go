@@ -0,0 +1,101 @@
+package outline
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"regexp"
+	"strings"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// declarationPatterns match lines that declare something worth keeping in an
+// outline, per language. Languages without an entry use genericPattern.
+var declarationPatterns = map[types.Language]*regexp.Regexp{
+	types.LangPython:     regexp.MustCompile(`^\s*(async\s+def|def|class)\s+\w+|^(import|from)\s+\S+`),
+	types.LangJavaScript: regexp.MustCompile(`^\s*(export\s+)?(default\s+)?(async\s+)?(function\*?|class|const|let|var)\s+\w+|^\s*(import|export)\b|^\s{2,4}(async\s+|static\s+|get\s+|set\s+)*\w+\s*\([^)]*\)\s*\{`),
+	types.LangTypeScript: regexp.MustCompile(`^\s*(export\s+)?(default\s+)?(declare\s+)?(async\s+)?(function\*?|class|interface|type|enum|const|let|var|abstract\s+class)\s+\w+|^\s*(import|export)\b|^\s{2,4}(public\s+|private\s+|protected\s+|readonly\s+|async\s+|static\s+)*\w+\??\s*[(:<]`),
+	types.LangRust:       regexp.MustCompile(`^\s*(pub(\([^)]*\))?\s+)?(async\s+)?(fn|struct|enum|trait|impl|mod|type|const|static|use)\b`),
+	types.LangRuby:       regexp.MustCompile(`^\s*(def|class|module)\s+\S+|^\s*require`),
+	types.LangShell:      regexp.MustCompile(`^\s*(function\s+)?\w+\s*\(\)\s*\{?`),
+	types.LangSQL:        regexp.MustCompile(`(?i)^\s*create\s+`),
+	types.LangMarkdown:   regexp.MustCompile(`^#{1,6}\s`),
+}
+
+// genericPattern catches declarations in C-like languages: type declarations
+// and shallow lines that look like a function header
+var genericPattern = regexp.MustCompile(`^\s*(public|private|protected|internal|static|abstract|final|export|package|import|using|namespace|#include|class|interface|struct|enum|typedef|template)\b|^\s{0,4}[\w:<>\[\],\s\*&]+\s+\**\w+\s*\([^;]*\)\s*(const\s*)?\{?\s*$`)
+
+// GofmtConfig prints Go declarations the way gofmt lays them out
+var GofmtConfig = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// Outline reduces a file to its declarations: imports, types and function
+// signatures without bodies. It returns an empty string if nothing was found.
+func Outline(content string, language types.Language) string {
+	if language == types.LangGo {
+		if out, ok := goOutline(content); ok {
+			return out
+		}
+	}
+
+	pattern, ok := declarationPatterns[language]
+	if !ok {
+		pattern = genericPattern
+	}
+
+	var out strings.Builder
+	inFence := false
+	for _, line := range strings.Split(content, "\n") {
+		// Markdown headings inside code fences are shell comments, not sections
+		if language == types.LangMarkdown && strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || strings.TrimSpace(line) == "" || !pattern.MatchString(line) {
+			continue
+		}
+		out.WriteString(strings.TrimRight(line, " \t\r{"))
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// goOutline prints a Go file with function bodies removed. It keeps doc
+// comments on exported declarations. It reports false if the file doesn't parse.
+func goOutline(content string) (string, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return "", false
+	}
+
+	var out bytes.Buffer
+	out.WriteString("package " + file.Name.Name + "\n")
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			d.Body = nil
+			out.WriteString("\n")
+			if d.Doc != nil && d.Name.IsExported() {
+				for _, line := range strings.Split(strings.TrimSpace(d.Doc.Text()), "\n") {
+					out.WriteString("// " + line + "\n")
+				}
+			}
+			d.Doc = nil
+		case *ast.GenDecl:
+			d.Doc = nil
+			out.WriteString("\n")
+		}
+
+		if err := GofmtConfig.Fprint(&out, fset, decl); err != nil {
+			return "", false
+		}
+		out.WriteString("\n")
+	}
+
+	return out.String(), true
+}
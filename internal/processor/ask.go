@@ -0,0 +1,135 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/internal/ui"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// askInstructions tells the model how to answer in ask mode
+const askInstructions = `=== ANSWER INSTRUCTIONS ===
+Answer the question above in Markdown, using the context files. Their lines are numbered; cite the code you rely on as path:line or path:start-end, using the paths from the file headers. If the context doesn't contain the answer, say so instead of guessing.`
+
+// Ask answers a question about the inputs and context, streaming a Markdown
+// answer to w. It never writes files. Status lines go to stderr, so w can be
+// stdout and still be piped.
+func (p *Processor) Ask(opts *types.ProcessingOptions, w io.Writer) (*types.ProcessingResult, error) {
+	p.ui = ui.New(opts.Verbose)
+	startTime := time.Now()
+
+	if err := p.loadPromptFile(opts); err != nil {
+		return nil, err
+	}
+	if err := p.checkBudget(opts); err != nil {
+		return nil, err
+	}
+	prompt, packed, usage, fixedTokens, err := p.askRequest(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.ProcessingResult{
+		InputFile: "question",
+		Mode:      types.ModeAsk,
+		Context:   usage,
+		Success:   true,
+	}
+	if opts.Verbose {
+		fmt.Fprintf(os.Stderr, "📎 %d context files, ~%d tokens\n", len(packed), fixedTokens+contextTokens(usage))
+	}
+	if opts.DryRun {
+		fmt.Fprintf(w, "Would ask with %d context files (~%d tokens)\n", len(packed), fixedTokens+contextTokens(usage))
+		return result, nil
+	}
+
+	if limits := p.newBudget(opts); limits != nil {
+		if !limits.reserve(fixedTokens+contextTokens(usage), capTokens(generateOutputTokens, opts.MaxTokens)) {
+			return nil, fmt.Errorf("%w: %s", types.ErrBudgetExceeded, limits.stopReason())
+		}
+	}
+
+	aiResp, err := p.aiClient.StreamContent(types.AIRequest{
+		Model:       opts.Model,
+		Prompt:      prompt,
+		Language:    types.LangMarkdown,
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		Mode:        types.ModeAsk,
+	}, packed, w)
+	if err != nil {
+		return nil, fmt.Errorf("AI processing failed: %w", err)
+	}
+	if !strings.HasSuffix(aiResp.Content, "\n") {
+		fmt.Fprintln(w)
+	}
+	if aiResp.Truncated {
+		fmt.Fprintf(os.Stderr, "⚠️  Answer was cut off (%s); raise --max-tokens for a complete one\n", aiResp.FinishReason)
+	}
+
+	p.recordUsage(result, aiResp)
+	result.Duration = time.Since(startTime)
+	return result, nil
+}
+
+// askRequest builds the prompt of an ask request and packs the inputs and
+// context around it, most relevant to the question first. Files are sent
+// with line numbers so the answer can cite them.
+func (p *Processor) askRequest(opts *types.ProcessingOptions) (string, []*types.ContextFile, []types.ContextUsage, int, error) {
+	var files []*types.FileInfo
+	if opts.InputPath != "" {
+		var err error
+		files, err = p.findFiles(opts)
+		if err != nil {
+			return "", nil, nil, 0, fmt.Errorf("failed to find files: %w", err)
+		}
+	}
+	contextFiles, err := p.loadContextFiles(opts)
+	if err != nil {
+		return "", nil, nil, 0, fmt.Errorf("failed to load context files: %w", err)
+	}
+
+	var candidates []*types.ContextFile
+	inputs := make(map[string]*types.FileInfo, len(files))
+	for _, file := range files {
+		content, skipReason, err := p.readSourceFile(file)
+		if err != nil || skipReason != "" {
+			continue // Unreadable, binary and secret-bearing inputs just aren't asked about
+		}
+		inputs[fileKey(file.Path)] = file
+		candidates = append(candidates, &types.ContextFile{
+			Path:     file.Path,
+			Language: file.Language,
+			Content:  content,
+			Label:    relativePath(file.Path),
+		})
+	}
+	candidates = append(candidates, withoutInputs(contextFiles, inputs)...)
+	if len(candidates) == 0 {
+		return "", nil, nil, 0, fmt.Errorf("nothing to ask about: use --input or --context")
+	}
+
+	// As in generate mode, the system prompt is only sent when overridden;
+	// the default one asks for file content, not answers
+	prompt := opts.AIPrompt
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", nil, nil, 0, fmt.Errorf("failed to get system prompt: %w", err)
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+	prompt += "\n\n" + askInstructions
+
+	fixedTokens := tokens.Count(prompt, p.config.AI.Provider) + promptOverheadTokens
+	// Line numbers are added once each file's form is chosen, so files that
+	// don't fit can still be outlined
+	packed, usage := p.packer.WithLineNumbers().Pack(context.Target{Content: opts.AIPrompt}, candidates, p.contextBudget(opts, fixedTokens))
+	return prompt, packed, usage, fixedTokens, nil
+}
@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Zachacious/presto/internal/config"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// budget enforces run-level limits on files, tokens and cost. Each job
+// reserves its estimated usage before it is dispatched; the reservation is
+// replaced by actual usage once the job finishes.
+type budget struct {
+	mu sync.Mutex
+
+	maxFiles  int
+	maxTokens int
+	maxCost   float64
+
+	price  config.ModelPrice
+	priced bool
+
+	dispatched int
+	tokens     int     // Actual usage of finished jobs plus reservations of running ones
+	cost       float64 // Same as tokens, in USD
+	reason     string  // Why dispatching stopped
+}
+
+// checkBudget rejects a cost limit that can't be enforced: usage is priced
+// from the configured table, so a model without a price never costs anything
+func (p *Processor) checkBudget(opts *types.ProcessingOptions) error {
+	if opts.MaxCost <= 0 {
+		return nil
+	}
+	model := opts.Model
+	if model == "" {
+		model = p.config.AI.Model
+	}
+	if _, ok := p.config.PriceFor(model); !ok {
+		return fmt.Errorf("no price configured for %s, so a cost limit of $%.2f can't be enforced; add it under pricing", model, opts.MaxCost)
+	}
+	return nil
+}
+
+// newBudget creates a budget from the run options; it returns nil when no limits are set
+func (p *Processor) newBudget(opts *types.ProcessingOptions) *budget {
+	if opts.MaxFiles <= 0 && opts.MaxTotalTokens <= 0 && opts.MaxCost <= 0 {
+		return nil
+	}
+
+	model := opts.Model
+	if model == "" {
+		model = p.config.AI.Model
+	}
+	price, priced := p.config.PriceFor(model)
+	return &budget{
+		maxFiles:  opts.MaxFiles,
+		maxTokens: opts.MaxTotalTokens,
+		maxCost:   opts.MaxCost,
+		price:     price,
+		priced:    priced,
+	}
+}
+
+// reserve claims room for a job with the given estimated usage. It returns
+// false, and stops all further dispatching, if the job would exceed a limit.
+func (b *budget) reserve(inputTokens, outputTokens int) bool {
+	return b.claim(1, inputTokens, outputTokens)
+}
+
+// reserveTokens claims room for one more request of a job that reserve has
+// already counted against the file limit
+func (b *budget) reserveTokens(inputTokens, outputTokens int) bool {
+	return b.claim(0, inputTokens, outputTokens)
+}
+
+func (b *budget) claim(files, inputTokens, outputTokens int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.reason != "" {
+		return false
+	}
+
+	tokens := inputTokens + outputTokens
+	cost := b.estimateCost(inputTokens, outputTokens)
+
+	switch {
+	case b.maxFiles > 0 && files > 0 && b.dispatched+files > b.maxFiles:
+		b.reason = fmt.Sprintf("max files (%d) reached", b.maxFiles)
+	case b.maxTokens > 0 && b.tokens+tokens > b.maxTokens:
+		b.reason = fmt.Sprintf("max total tokens (%d) would be exceeded", b.maxTokens)
+	case b.maxCost > 0 && b.cost+cost > b.maxCost:
+		b.reason = fmt.Sprintf("max cost ($%.2f) would be exceeded", b.maxCost)
+	}
+	if b.reason != "" {
+		return false
+	}
+
+	b.dispatched += files
+	b.tokens += tokens
+	b.cost += cost
+	return true
+}
+
+// settle swaps a job's reservation for its actual usage
+func (b *budget) settle(inputTokens, outputTokens int, result *types.ProcessingResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += result.AITokensUsed - (inputTokens + outputTokens)
+	b.cost += result.Cost - b.estimateCost(inputTokens, outputTokens)
+}
+
+// stopReason returns why dispatching stopped, or an empty string
+func (b *budget) stopReason() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reason
+}
+
+func (b *budget) estimateCost(inputTokens, outputTokens int) float64 {
+	if !b.priced {
+		return 0
+	}
+	return b.price.Cost(inputTokens, outputTokens, 0)
+}
+
+// budgetSkipped builds the result for a file that was never dispatched
+func budgetSkipped(file string, mode types.ProcessingMode, reason string) *types.ProcessingResult {
+	return &types.ProcessingResult{
+		InputFile:  file,
+		Mode:       mode,
+		Skipped:    true,
+		SkipReason: fmt.Sprintf("%v: %s", types.ErrBudgetExceeded, reason),
+		OverBudget: true,
+	}
+}
@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Zachacious/presto/internal/config"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func TestCheckBudget(t *testing.T) {
+	p := &Processor{config: &config.Config{
+		AI:      types.APIConfig{Model: "priced-model"},
+		Pricing: map[string]config.ModelPrice{"priced-model": {Input: 1, Output: 2}},
+	}}
+	tests := []struct {
+		name string
+		opts types.ProcessingOptions
+		err  string
+	}{
+		{"no cost limit", types.ProcessingOptions{Model: "unpriced-model", MaxTotalTokens: 1000}, ""},
+		{"priced default model", types.ProcessingOptions{MaxCost: 1}, ""},
+		{"priced model", types.ProcessingOptions{Model: "priced-model", MaxCost: 1}, ""},
+		{"unpriced model", types.ProcessingOptions{Model: "unpriced-model", MaxCost: 1}, "no price configured for unpriced-model"},
+	}
+	for _, tt := range tests {
+		err := p.checkBudget(&tt.opts)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestBudgetReserveTokens(t *testing.T) {
+	b := &budget{maxFiles: 1, maxTokens: 100}
+	if !b.reserve(0, 0) {
+		t.Fatal("first file rejected")
+	}
+	for i := 0; i < 3; i++ {
+		if !b.reserveTokens(20, 10) {
+			t.Fatalf("request %d of the first file rejected", i+1)
+		}
+	}
+	if b.reserveTokens(20, 10) {
+		t.Error("request over the token limit accepted")
+	}
+
+	b = &budget{maxFiles: 1}
+	b.reserve(0, 0)
+	if b.reserve(0, 0) {
+		t.Error("second file accepted with --max-files 1")
+	}
+}
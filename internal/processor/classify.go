@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/classify"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// classifyOutputTokens is the assumed response size of one classify
+// request, capped by the request's max tokens
+const classifyOutputTokens = 256
+
+// classifyQuery builds the run's label set and describes the request and
+// answer of a classification. A response that doesn't match the schema is
+// retried once.
+func (p *Processor) classifyQuery(opts *types.ProcessingOptions) (fileQuery, error) {
+	spec, err := classify.New(opts.Labels)
+	if err != nil {
+		return fileQuery{}, err
+	}
+	return fileQuery{
+		mode: types.ModeClassify,
+		prompt: func(opts *types.ProcessingOptions) (string, error) {
+			return p.classifyPrompt(opts, spec)
+		},
+		label:   "To classify",
+		retries: 1,
+		invalid: "invalid classify response",
+		parse: func(response, _ string, result *types.ProcessingResult) error {
+			labels, err := spec.Parse(response, opts.MinConfidence)
+			result.Labels = labels
+			return err
+		},
+		summary: func(result *types.ProcessingResult) string {
+			names := make([]string, len(result.Labels))
+			for i, label := range result.Labels {
+				names[i] = label.Name
+			}
+			if len(names) == 0 {
+				return "no labels"
+			}
+			return strings.Join(names, ", ")
+		},
+		output: classifyOutputTokens,
+	}, nil
+}
+
+// classifyPrompt builds the prompt of a classify request. As in review, the
+// system prompt is only sent when overridden.
+func (p *Processor) classifyPrompt(opts *types.ProcessingOptions, spec *classify.Spec) (string, error) {
+	prompt := opts.AIPrompt
+	if prompt == "" {
+		prompt = classify.DefaultPrompt
+	}
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", fmt.Errorf("failed to get system prompt: %w", err)
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+	return prompt + "\n\n" + spec.Instructions(), nil
+}
+
+// filterTagged keeps the files a classify run tagged with any of opts.Tagged
+func filterTagged(files []*types.FileInfo, opts *types.ProcessingOptions) ([]*types.FileInfo, error) {
+	tagged, err := classify.Tagged(opts.TagsFile, opts.Tagged)
+	if err != nil {
+		return nil, err
+	}
+	var kept []*types.FileInfo
+	for _, file := range files {
+		if tagged[absPath(file.Path)] {
+			kept = append(kept, file)
+		}
+	}
+	return kept, nil
+}
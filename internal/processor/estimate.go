@@ -0,0 +1,282 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/Zachacious/presto/internal/comments"
+	"github.com/Zachacious/presto/internal/config"
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/internal/ui"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+const (
+	// promptOverheadTokens approximates the output instructions wrapped
+	// around every transform request
+	promptOverheadTokens = 150
+
+	// transformOutputRatio is how much longer a transformed file tends to be
+	// than its input (added docs, comments, error handling)
+	transformOutputRatio = 1.15
+
+	// generateOutputTokens is the assumed response size for generate mode,
+	// capped by the request's max tokens
+	generateOutputTokens = 4096
+)
+
+// NewOffline creates a processor that never contacts the AI provider. It is
+// used for estimates, which must work without an API key.
+func NewOffline(cfg *config.Config) (*Processor, error) {
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	fileContext, err := newFileContext(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Processor{
+		commentRemover: comments.New(),
+		config:         cfg,
+		redactor:       redactor,
+		fileContext:    fileContext,
+		contextLoader:  context.New(),
+		packer:         context.NewPacker(cfg.AI.Provider),
+		deps:           context.NewResolver(cfg.Filters.MaxFileSize),
+	}, nil
+}
+
+// Estimate walks the same files and context as ProcessPath and projects the
+// token usage and cost of the run without calling the API
+func (p *Processor) Estimate(opts *types.ProcessingOptions) (*types.CostEstimate, error) {
+	p.ui = ui.New(opts.Verbose)
+
+	// An estimate runs nothing, context commands included
+	dryRun := *opts
+	dryRun.DryRun = true
+	opts = &dryRun
+
+	if err := p.loadPromptFile(opts); err != nil {
+		return nil, err
+	}
+	query, err := p.runQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	contextFiles, err := p.loadContextFiles(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load context files: %w", err)
+	}
+
+	model := opts.Model
+	if model == "" {
+		model = p.config.AI.Model
+	}
+
+	est := &types.CostEstimate{
+		Model:        model,
+		ContextFiles: len(contextFiles),
+	}
+	price, priced := p.config.PriceFor(model)
+	est.Priced = priced
+
+	provider := p.config.AI.Provider
+
+	addEstimate := func(name string, input, output int) {
+		fe := types.FileEstimate{File: name, InputTokens: input, OutputTokens: output}
+		if priced {
+			fe.Cost = price.Cost(input, output, 0)
+		}
+		est.Files = append(est.Files, fe)
+		est.InputTokens += input
+		est.OutputTokens += output
+		est.Cost += fe.Cost
+	}
+
+	if opts.Mode == types.ModeAsk {
+		_, _, usage, fixedTokens, err := p.askRequest(opts)
+		if err != nil {
+			return nil, err
+		}
+		addEstimate("question", fixedTokens+contextTokens(usage), capTokens(generateOutputTokens, opts.MaxTokens))
+		return est, nil
+	}
+
+	if opts.Mode == types.ModeGenerate && opts.MapPrompt != "" {
+		var files []*types.FileInfo
+		if opts.InputPath != "" {
+			files, err = p.findFiles(opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find files: %w", err)
+			}
+		}
+		store, err := p.mapCache()
+		if err != nil {
+			return nil, err
+		}
+
+		// Cached map results cost nothing; combine levels are not projected,
+		// so the reduce input is capped at what one request can hold
+		chunks, _ := p.mapChunks(opts, files, contextFiles)
+		mapOutput := capTokens(mapOutputTokens, opts.MaxTokens)
+		for i, task := range p.mapTasks(opts, chunks) {
+			if _, ok := store.get(task.key); ok {
+				continue
+			}
+			addEstimate(chunks[i].label, tokens.Count(task.prompt, provider)+itemTokens(task.files, provider), mapOutput)
+		}
+
+		finalPrompt, err := p.reducePrompt(opts)
+		if err != nil {
+			return nil, err
+		}
+		fixed := tokens.Count(finalPrompt, provider) + promptOverheadTokens
+		reduceInput := min(len(chunks)*mapOutput, p.contextBudget(opts, fixed))
+		addEstimate(opts.OutputPath, fixed+reduceInput, capTokens(generateOutputTokens, opts.MaxTokens))
+		return est, nil
+	}
+
+	if opts.Mode == types.ModeGenerate && opts.OutputTemplate == "" {
+		promptTokens := tokens.Count(opts.AIPrompt, provider)
+		if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+			systemPrompt, err := p.getSystemPrompt(opts)
+			if err != nil {
+				return nil, err
+			}
+			promptTokens += tokens.Count(systemPrompt, provider)
+		}
+		_, usage := p.packContext(context.Target{Content: opts.AIPrompt}, promptTokens, opts, contextFiles)
+		addEstimate(opts.OutputPath, promptTokens+contextTokens(usage), capTokens(generateOutputTokens, opts.MaxTokens))
+		return est, nil
+	}
+
+	var files []*types.FileInfo
+	if opts.InputPath != "" || opts.Mode != types.ModeMultiFile {
+		files, err = p.findFiles(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find files: %w", err)
+		}
+	}
+
+	if opts.Mode == types.ModeMultiFile {
+		prompt, inputs, byPath, _, err := p.multiFileRequest(opts, files)
+		if err != nil {
+			return nil, err
+		}
+		input := promptOverheadTokens + tokens.Count(prompt, provider)
+		for _, cf := range inputs {
+			input += tokens.Count(cf.Content, provider)
+		}
+		_, usage := p.packContext(context.Target{Content: opts.AIPrompt}, input, opts, withoutInputs(contextFiles, byPath))
+		addEstimate(fmt.Sprintf("%d input files", len(inputs)), input+contextTokens(usage), capTokens(generateOutputTokens, opts.MaxTokens))
+		return est, nil
+	}
+
+	promptTokens, err := p.countPromptTokens(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		input, output, ok := p.estimateInput(file, opts, promptTokens, contextFiles, query)
+		if ok {
+			addEstimate(file.Path, input, output)
+		}
+	}
+
+	return est, nil
+}
+
+// countPromptTokens approximates the fixed prompt tokens of a transform request
+func (p *Processor) countPromptTokens(opts *types.ProcessingOptions) (int, error) {
+	systemPrompt, err := p.getSystemPrompt(opts)
+	if err != nil {
+		return 0, err
+	}
+	return tokens.CountAll(p.config.AI.Provider, systemPrompt, opts.AIPrompt) + promptOverheadTokens, nil
+}
+
+// estimateInput projects the tokens one input file will use in a per-file run
+func (p *Processor) estimateInput(file *types.FileInfo, opts *types.ProcessingOptions, promptTokens int, contextFiles []*types.ContextFile, query *fileQuery) (int, int, bool) {
+	if query != nil {
+		return p.estimateQuery(file, opts, contextFiles, *query)
+	}
+	switch opts.Mode {
+	case types.ModeGenerate:
+		return p.estimateGenerated(file, opts, contextFiles)
+	case types.ModeRecords:
+		return p.estimateRecords(file, opts, contextFiles)
+	}
+	if len(opts.Selectors) > 0 {
+		return p.estimateSelected(file, opts, contextFiles)
+	}
+	if len(opts.Sections) > 0 {
+		return p.estimateSections(file, opts, contextFiles)
+	}
+	if len(opts.Symbols) > 0 || len(opts.LineRanges) > 0 {
+		return p.estimateRegions(file, opts, contextFiles)
+	}
+	if file.Language == types.LangNotebook {
+		return p.estimateNotebook(file, opts, contextFiles)
+	}
+	return p.estimateTransform(file, opts, promptTokens, contextFiles)
+}
+
+// estimateGenerated projects input and output tokens for generating one
+// file from an input. Outputs the OnExists policy would skip are not sent.
+func (p *Processor) estimateGenerated(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) (int, int, bool) {
+	outputPath := p.generatedPath(file, opts)
+	existing, existingContent, skipReason, err := p.readExistingOutput(outputPath, opts)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+
+	content, skipReason, err := p.readSourceFile(file)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+
+	prompt, err := p.perFilePrompt(opts, outputPath, existing != nil)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	fixedTokens := tokens.CountAll(p.config.AI.Provider, prompt, content, existingContent) + promptOverheadTokens
+	candidates := p.candidateContext(file, content, opts, contextFiles)
+	_, usage := p.packContext(context.Target{Path: file.Path, Content: content}, fixedTokens, opts, candidates)
+
+	return fixedTokens + contextTokens(usage), capTokens(generateOutputTokens, opts.MaxTokens), true
+}
+
+// estimateTransform projects input and output tokens for transforming one
+// file. promptTokens covers the prompt sent with every file; context is
+// packed per file as it would be for the real request. It returns false for
+// files that would be skipped.
+func (p *Processor) estimateTransform(file *types.FileInfo, opts *types.ProcessingOptions, promptTokens int, contextFiles []*types.ContextFile) (int, int, bool) {
+	content, skipReason, err := p.readSourceFile(file)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	if opts.RemoveComments {
+		content = p.commentRemover.RemoveComments(content, file.Language)
+	}
+
+	fixedTokens := promptTokens + p.transformContentTokens(file, content)
+	candidates := p.candidateContext(file, content, opts, contextFiles)
+	_, usage := p.packContext(context.Target{Path: file.Path, Content: content}, fixedTokens, opts, candidates)
+
+	output := int(float64(tokens.Count(content, p.config.AI.Provider)) * transformOutputRatio)
+	return fixedTokens + contextTokens(usage), output, true
+}
+
+// capTokens limits n to max when max is set
+func capTokens(n, max int) int {
+	if max > 0 && n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+package processor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Zachacious/presto/internal/extract"
+	"github.com/Zachacious/presto/internal/utils"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// extractOutputTokens is the assumed response size of one extraction
+// request, capped by the request's max tokens
+const extractOutputTokens = 1024
+
+// extractRetries is how many times a response that doesn't match the
+// schema is sent back with the validation error
+const extractRetries = 2
+
+// extractQuery reads the run's schema and describes the request and answer
+// of an extraction. Objects that don't match the schema are sent back with
+// the errors; once every file is done they are written to the data file.
+func (p *Processor) extractQuery(opts *types.ProcessingOptions) (fileQuery, error) {
+	spec, err := extract.Load(opts.SchemaFile)
+	if err != nil {
+		return fileQuery{}, err
+	}
+	return fileQuery{
+		mode: types.ModeExtract,
+		prompt: func(opts *types.ProcessingOptions) (string, error) {
+			return p.extractPrompt(opts, spec)
+		},
+		label:   "Input",
+		schema:  spec.Raw,
+		retries: extractRetries,
+		invalid: "response doesn't match the schema",
+		parse: func(response, _ string, result *types.ProcessingResult) error {
+			object, err := spec.Parse(response)
+			if err != nil {
+				return err
+			}
+			result.Extracted = object
+			result.OutputFile = opts.OutputPath
+			return nil
+		},
+		summary: func(*types.ProcessingResult) string { return "extracted" },
+		output:  extractOutputTokens,
+		write: func(results []*types.ProcessingResult) error {
+			return writeExtracted(results, spec, opts)
+		},
+	}, nil
+}
+
+// extractPrompt builds the prompt of an extraction request. As in review,
+// the system prompt is only sent when overridden.
+func (p *Processor) extractPrompt(opts *types.ProcessingOptions, spec *extract.Spec) (string, error) {
+	prompt := opts.AIPrompt
+	if prompt == "" {
+		prompt = extract.DefaultPrompt
+	}
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", fmt.Errorf("failed to get system prompt: %w", err)
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+	return prompt + "\n\n" + spec.Instructions(), nil
+}
+
+// writeExtracted writes the objects of a run to its data file
+func writeExtracted(results []*types.ProcessingResult, spec *extract.Spec, opts *types.ProcessingOptions) error {
+	data, count, err := spec.Render(results, opts.ExtractFormat)
+	if err != nil {
+		return fmt.Errorf("failed to write extracted data: %w", err)
+	}
+	if err := utils.EnsureDir(filepath.Dir(opts.OutputPath)); err != nil {
+		return fmt.Errorf("failed to write extracted data: %w", err)
+	}
+	if err := os.WriteFile(opts.OutputPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write extracted data: %w", err)
+	}
+	fmt.Printf("📝 %d records written to %s\n", count, opts.OutputPath)
+	return nil
+}
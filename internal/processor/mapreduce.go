@@ -0,0 +1,488 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zachacious/presto/internal/cache"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// mapOutputTokens is the assumed size of one map or combine result
+const mapOutputTokens = 1024
+
+// mapChunk is one piece of the corpus: a whole file, or part of a large one
+type mapChunk struct {
+	label   string
+	lang    types.Language
+	content string
+}
+
+// aiTask is one request of a map-reduce run. Tasks with a key are cached.
+type aiTask struct {
+	key    string
+	prompt string
+	files  []*types.ContextFile
+}
+
+// taskResult is a finished task, in the order the tasks were given
+type taskResult struct {
+	index   int
+	content string
+	resp    *types.AIResponse // Nil when served from the cache
+	err     error
+}
+
+// processMapReduce generates one output from a corpus of any size. The map
+// prompt runs on every file or chunk with the worker pool; the results are
+// then combined level by level until they fit one request, and the generate
+// prompt runs over them. Map and combine results are cached.
+func (p *Processor) processMapReduce(opts *types.ProcessingOptions, files []*types.FileInfo, contextFiles []*types.ContextFile) ([]*types.ProcessingResult, error) {
+	startTime := time.Now()
+
+	result := &types.ProcessingResult{
+		OutputFile: opts.OutputPath,
+		Mode:       types.ModeGenerate,
+	}
+	fail := func(err error) ([]*types.ProcessingResult, error) {
+		result.Error = err
+		result.OverBudget = errors.Is(err, types.ErrBudgetExceeded)
+		result.Duration = time.Since(startTime)
+		p.ui.FileError(opts.OutputPath, err)
+		return []*types.ProcessingResult{result}, nil
+	}
+
+	store, err := p.mapCache()
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, inputs := p.mapChunks(opts, files, contextFiles)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("nothing to map: no readable input or context files")
+	}
+	result.InputFile = fmt.Sprintf("%d chunks", len(chunks))
+
+	tasks := p.mapTasks(opts, chunks)
+	if opts.DryRun {
+		cached := 0
+		for _, task := range tasks {
+			if _, ok := store.get(task.key); ok {
+				cached++
+			}
+		}
+		fmt.Printf("Would map %d chunks (%d cached) and reduce them into %s\n", len(tasks), cached, opts.OutputPath)
+		result.Success = true
+		return []*types.ProcessingResult{result}, nil
+	}
+
+	// Each input counts against --max-files once, however many chunks it
+	// makes; every request then reserves its tokens
+	limits := p.newBudget(opts)
+	if limits != nil {
+		for i := 0; i < inputs; i++ {
+			if !limits.reserve(0, 0) {
+				return fail(fmt.Errorf("%w: %s", types.ErrBudgetExceeded, limits.stopReason()))
+			}
+		}
+	}
+
+	// Map
+	outputs, err := p.runTasks(opts, tasks, store, limits, result, "Mapping")
+	if err != nil {
+		return fail(fmt.Errorf("map failed: %w", err))
+	}
+	items := make([]*types.ContextFile, len(chunks))
+	for i, chunk := range chunks {
+		items[i] = &types.ContextFile{Language: types.LangText, Content: outputs[i], Label: chunk.label}
+	}
+
+	// Combine until the results fit the final request
+	finalPrompt, err := p.reducePrompt(opts)
+	if err != nil {
+		return fail(err)
+	}
+	for level := 1; ; level++ {
+		room := p.contextBudget(opts, tokens.Count(finalPrompt, p.config.AI.Provider)+promptOverheadTokens)
+		batches := p.batchItems(items, room)
+		if len(batches) == 1 {
+			break
+		}
+		if len(batches) == len(items) {
+			return fail(fmt.Errorf("map results are too large to combine; ask for shorter results in the map prompt"))
+		}
+
+		combine := make([]aiTask, len(batches))
+		for i, batch := range batches {
+			combine[i] = p.combineTask(opts, batch)
+		}
+		outputs, err := p.runTasks(opts, combine, store, limits, result, fmt.Sprintf("Combining (level %d)", level))
+		if err != nil {
+			return fail(fmt.Errorf("combine failed: %w", err))
+		}
+
+		items = make([]*types.ContextFile, len(outputs))
+		for i, output := range outputs {
+			items[i] = &types.ContextFile{
+				Language: types.LangText,
+				Content:  output,
+				Label:    fmt.Sprintf("combined results %d.%d", level, i+1),
+			}
+		}
+	}
+
+	// Reduce
+	p.ui.StartSpinner(fmt.Sprintf("Reducing %d results...", len(items)))
+	input := tokens.Count(finalPrompt, p.config.AI.Provider) + itemTokens(items, p.config.AI.Provider)
+	output := capTokens(generateOutputTokens, opts.MaxTokens)
+	if limits != nil && !limits.reserveTokens(input, output) {
+		p.ui.StopSpinner()
+		return fail(fmt.Errorf("%w: %s", types.ErrBudgetExceeded, limits.stopReason()))
+	}
+	aiResp, err := p.aiClient.ProcessContent(types.AIRequest{
+		Model:       opts.Model,
+		Prompt:      finalPrompt,
+		Language:    types.LangText,
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		Mode:        types.ModeGenerate,
+	}, items)
+	p.ui.StopSpinner()
+	if limits != nil {
+		usage := &types.ProcessingResult{}
+		if aiResp != nil {
+			p.recordUsage(usage, aiResp)
+		}
+		limits.settle(input, output, usage)
+	}
+	if err != nil {
+		return fail(fmt.Errorf("AI processing failed: %w", err))
+	}
+	p.recordUsage(result, aiResp)
+	if aiResp.Truncated {
+		return fail(fmt.Errorf("response was cut off (%s); nothing written, raise --max-tokens", aiResp.FinishReason))
+	}
+
+	if err := os.WriteFile(opts.OutputPath, []byte(aiResp.Content), 0644); err != nil {
+		return fail(fmt.Errorf("failed to write output file: %w", err))
+	}
+
+	result.Success = true
+	result.BytesChanged = len(aiResp.Content)
+	result.Duration = time.Since(startTime)
+	p.ui.FileSuccess(result.InputFile, opts.OutputPath, result.Duration, result.AITokensUsed)
+	return []*types.ProcessingResult{result}, nil
+}
+
+// mapChunks splits the inputs and the run's context into map-sized pieces,
+// and counts the inputs that could be read. Files too large for one map
+// request are cut at line boundaries.
+func (p *Processor) mapChunks(opts *types.ProcessingOptions, files []*types.FileInfo, contextFiles []*types.ContextFile) ([]mapChunk, int) {
+	var sources []*types.ContextFile
+	inputs := make(map[string]*types.FileInfo, len(files))
+
+	for _, file := range files {
+		content, skipReason, err := p.readSourceFile(file)
+		if err != nil {
+			p.ui.FileError(file.Path, err)
+			continue
+		}
+		if skipReason != "" {
+			p.ui.FileSkipped(file.Path, skipReason)
+			continue
+		}
+		inputs[absPath(file.Path)] = file
+		sources = append(sources, &types.ContextFile{
+			Path:     file.Path,
+			Language: file.Language,
+			Content:  content,
+			Label:    relativePath(file.Path),
+		})
+	}
+	for _, cf := range contextFiles {
+		if cf.Path == "" || inputs[absPath(cf.Path)] == nil {
+			sources = append(sources, cf)
+		}
+	}
+
+	limit := p.config.MapReduce.ChunkTokens
+	room := p.contextBudget(opts, tokens.Count(opts.MapPrompt, p.config.AI.Provider)+promptOverheadTokens)
+	if limit <= 0 || limit > room {
+		limit = room
+	}
+
+	var chunks []mapChunk
+	for _, source := range sources {
+		parts := splitByTokens(source.Content, limit, p.config.AI.Provider)
+		for i, part := range parts {
+			label := source.Label
+			if len(parts) > 1 {
+				label = fmt.Sprintf("%s (part %d/%d)", source.Label, i+1, len(parts))
+			}
+			chunks = append(chunks, mapChunk{label: label, lang: source.Language, content: part})
+		}
+	}
+	return chunks, len(inputs)
+}
+
+// mapTasks builds the map request of every chunk
+func (p *Processor) mapTasks(opts *types.ProcessingOptions, chunks []mapChunk) []aiTask {
+	prompt := opts.MapPrompt + "\n\nAnswer for this part only; the answers for all parts of the corpus are combined afterwards."
+
+	tasks := make([]aiTask, len(chunks))
+	for i, chunk := range chunks {
+		tasks[i] = aiTask{
+			key:    p.taskKey(opts, "map", prompt, chunk.label, chunk.content),
+			prompt: prompt,
+			files:  []*types.ContextFile{{Language: chunk.lang, Content: chunk.content, Label: chunk.label}},
+		}
+	}
+	return tasks
+}
+
+// combineTask builds a request that merges a batch of intermediate results
+func (p *Processor) combineTask(opts *types.ProcessingOptions, batch []*types.ContextFile) aiTask {
+	prompt := fmt.Sprintf(`The context files are partial results, each produced by this instruction on one part of a larger corpus:
+
+%s
+
+Merge them into a single result of the same kind. Keep every detail that could matter for the final task:
+
+%s`, opts.MapPrompt, opts.AIPrompt)
+
+	parts := []string{"combine", prompt}
+	for _, item := range batch {
+		parts = append(parts, item.Content)
+	}
+	return aiTask{
+		key:    p.taskKey(opts, parts...),
+		prompt: prompt,
+		files:  batch,
+	}
+}
+
+// reducePrompt builds the final prompt. As in single-output generate, the
+// system prompt is only sent when overridden.
+func (p *Processor) reducePrompt(opts *types.ProcessingOptions) (string, error) {
+	prompt := fmt.Sprintf("The context files are the results of this instruction, applied to each part of a corpus:\n\n%s\n\n---\n\n%s", opts.MapPrompt, opts.AIPrompt)
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", fmt.Errorf("failed to get system prompt: %w", err)
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+	return prompt, nil
+}
+
+// runTasks runs tasks with the worker pool, serving what it can from the
+// cache, and returns their outputs in order. Usage is added to result.
+func (p *Processor) runTasks(opts *types.ProcessingOptions, tasks []aiTask, store *mapStore, limits *budget, result *types.ProcessingResult, stage string) ([]string, error) {
+	jobs := make(chan int)
+	results := make(chan taskResult)
+	stop := make(chan struct{}) // Closed on the first error; no new tasks start
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(opts.MaxConcurrent, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results <- p.runTask(opts, index, tasks[index], store, limits)
+			}
+		}()
+	}
+	go func() {
+		defer func() {
+			close(jobs)
+			wg.Wait()
+			close(results)
+		}()
+		for i := range tasks {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			select {
+			case jobs <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	p.ui.StartSpinner(fmt.Sprintf("%s 0/%d...", stage, len(tasks)))
+
+	outputs := make([]string, len(tasks))
+	var firstErr error
+	done, cached := 0, 0
+	for r := range results {
+		done++
+		if r.err != nil {
+			if firstErr == nil {
+				firstErr = r.err
+				close(stop)
+			}
+			continue
+		}
+		outputs[r.index] = r.content
+		if r.resp != nil {
+			p.recordUsage(result, r.resp)
+		} else {
+			cached++
+		}
+		p.ui.UpdateSpinner(fmt.Sprintf("%s %d/%d...", stage, done, len(tasks)))
+	}
+
+	p.ui.StopSpinner()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if opts.Verbose {
+		p.ui.Progress(fmt.Sprintf("%s: %d requests, %d from cache", stage, len(tasks), cached))
+	}
+	return outputs, nil
+}
+
+// runTask answers one task from the cache or the AI
+func (p *Processor) runTask(opts *types.ProcessingOptions, index int, task aiTask, store *mapStore, limits *budget) taskResult {
+	if content, ok := store.get(task.key); ok {
+		return taskResult{index: index, content: content}
+	}
+
+	input := tokens.Count(task.prompt, p.config.AI.Provider) + itemTokens(task.files, p.config.AI.Provider)
+	output := capTokens(mapOutputTokens, opts.MaxTokens)
+	if limits != nil && !limits.reserveTokens(input, output) {
+		return taskResult{index: index, err: fmt.Errorf("%w: %s", types.ErrBudgetExceeded, limits.stopReason())}
+	}
+
+	resp, err := p.aiClient.ProcessContent(types.AIRequest{
+		Model:       opts.Model,
+		Prompt:      task.prompt,
+		Language:    types.LangText,
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		Mode:        types.ModeGenerate,
+	}, task.files)
+	if limits != nil {
+		usage := &types.ProcessingResult{}
+		if resp != nil {
+			p.recordUsage(usage, resp)
+		}
+		limits.settle(input, output, usage)
+	}
+	if err != nil {
+		return taskResult{index: index, err: err}
+	}
+
+	// Responses come back with redacted values restored; keep those off disk
+	if resp.Redactions == 0 {
+		store.put(task.key, resp.Content)
+	}
+	return taskResult{index: index, content: resp.Content, resp: resp}
+}
+
+// batchItems groups items, in order, into batches that each fit room tokens
+func (p *Processor) batchItems(items []*types.ContextFile, room int) [][]*types.ContextFile {
+	var batches [][]*types.ContextFile
+	var current []*types.ContextFile
+	used := 0
+
+	for _, item := range items {
+		n := itemTokens([]*types.ContextFile{item}, p.config.AI.Provider)
+		if len(current) > 0 && used+n > room {
+			batches = append(batches, current)
+			current, used = nil, 0
+		}
+		current = append(current, item)
+		used += n
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// taskKey identifies a task's response by the model settings and its inputs
+func (p *Processor) taskKey(opts *types.ProcessingOptions, parts ...string) string {
+	model := opts.Model
+	if model == "" {
+		model = p.config.AI.Model
+	}
+	return cache.Key(append([]string{model, strconv.FormatFloat(opts.Temperature, 'g', -1, 64)}, parts...)...)
+}
+
+// itemTokens counts context files as they are rendered into a prompt
+func itemTokens(items []*types.ContextFile, provider types.AIProvider) int {
+	total := 0
+	for _, item := range items {
+		total += tokens.Count(fmt.Sprintf("=== %s (%s) ===\n", item.Label, item.Language), provider)
+		total += tokens.Count(item.Content, provider)
+	}
+	return total
+}
+
+// splitByTokens cuts content at line boundaries into pieces of at most limit
+// tokens. A single line longer than limit becomes a piece of its own.
+func splitByTokens(content string, limit int, provider types.AIProvider) []string {
+	if limit <= 0 || tokens.Count(content, provider) <= limit {
+		return []string{content}
+	}
+
+	var parts []string
+	var current strings.Builder
+	used := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		n := tokens.Count(line, provider)
+		if used > 0 && used+n > limit {
+			parts = append(parts, current.String())
+			current.Reset()
+			used = 0
+		}
+		current.WriteString(line)
+		used += n
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// mapStore is the optional cache of map and combine results. Entries are
+// stored as plain text under the cache directory and never pruned.
+type mapStore struct {
+	cache *cache.Cache // Nil when caching is off
+}
+
+// mapCache opens the result cache if it is enabled
+func (p *Processor) mapCache() (*mapStore, error) {
+	if !p.config.MapReduce.Cache {
+		return &mapStore{}, nil
+	}
+	c, err := cache.New(p.config.MapReduce.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	return &mapStore{cache: c}, nil
+}
+
+func (s *mapStore) get(key string) (string, bool) {
+	if s.cache == nil {
+		return "", false
+	}
+	return s.cache.Get(key)
+}
+
+// put stores a result; a failed write only costs a cache miss later
+func (s *mapStore) put(key, value string) {
+	if s.cache != nil {
+		s.cache.Put(key, value)
+	}
+}
@@ -0,0 +1,330 @@
+package processor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/language"
+	"github.com/Zachacious/presto/internal/multifile"
+	"github.com/Zachacious/presto/internal/textfile"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/internal/ui"
+	"github.com/Zachacious/presto/internal/utils"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// processMultiFile sends all inputs in one request and lets the model answer
+// with file blocks that create, replace or delete files. The blocks are
+// checked against the project root, listed, and then applied.
+func (p *Processor) processMultiFile(opts *types.ProcessingOptions, files []*types.FileInfo, contextFiles []*types.ContextFile) ([]*types.ProcessingResult, error) {
+	startTime := time.Now()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	root := utils.ProjectRoot(wd)
+
+	request := &types.ProcessingResult{
+		InputFile: "multi-file request",
+		Mode:      types.ModeMultiFile,
+	}
+	if len(files) > 0 {
+		request.InputFile = fmt.Sprintf("%d input files", len(files))
+	}
+	fail := func(err error) ([]*types.ProcessingResult, error) {
+		request.Error = err
+		request.Duration = time.Since(startTime)
+		p.ui.FileError(request.InputFile, err)
+		return []*types.ProcessingResult{request}, nil
+	}
+
+	prompt, inputs, byPath, skipped, err := p.multiFileRequest(opts, files)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Inputs go in full; the shared context is packed around them
+	fixedTokens := promptOverheadTokens + tokens.Count(prompt, p.config.AI.Provider)
+	for _, input := range inputs {
+		fixedTokens += tokens.Count(input.Content, p.config.AI.Provider)
+	}
+	packed, usage := p.packContext(context.Target{Content: opts.AIPrompt}, fixedTokens, opts, withoutInputs(contextFiles, byPath))
+	request.Context = usage
+	p.ui.FileContext(request.InputFile, usage)
+
+	if opts.DryRun {
+		request.OutputFile = "(dry-run)"
+		request.Success = true
+		return append(skipped, request), nil
+	}
+
+	if limits := p.newBudget(opts); limits != nil {
+		if !limits.reserve(fixedTokens+contextTokens(usage), capTokens(generateOutputTokens, opts.MaxTokens)) {
+			result := budgetSkipped(request.InputFile, types.ModeMultiFile, limits.stopReason())
+			p.ui.FileSkipped(request.InputFile, result.SkipReason)
+			return append(skipped, result), nil
+		}
+	}
+
+	p.ui.FileProcessing(request.InputFile)
+	aiResp, err := p.aiClient.ProcessContent(types.AIRequest{
+		Model:       opts.Model,
+		Prompt:      prompt,
+		Language:    types.LangText,
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		Mode:        types.ModeMultiFile,
+	}, append(inputs, packed...))
+	if err != nil {
+		return fail(fmt.Errorf("AI processing failed: %w", err))
+	}
+	p.recordUsage(request, aiResp)
+
+	// A cut-off response may end cleanly between blocks; never apply half a plan
+	if aiResp.Truncated {
+		return fail(fmt.Errorf("response was cut off (%s); nothing applied, raise --max-tokens", aiResp.FinishReason))
+	}
+
+	changes, err := multifile.Parse(aiResp.Content)
+	if err != nil {
+		return fail(fmt.Errorf("invalid multi-file response: %w", err))
+	}
+	paths, err := multifile.Resolve(changes, root)
+	if err != nil {
+		return fail(fmt.Errorf("rejected multi-file response: %w", err))
+	}
+
+	// Replaced and deleted files that weren't inputs are read now, so the
+	// plan can show what changes and writes keep each file's format
+	targets := make([]*types.FileInfo, len(changes))
+	plan := make([]ui.PlannedChange, len(changes))
+	for i, change := range changes {
+		old := ""
+		if change.Action != multifile.ActionCreate {
+			target, ok := byPath[fileKey(paths[i])]
+			if !ok {
+				target = &types.FileInfo{Path: paths[i], OriginalPath: paths[i], Language: language.DetectLanguage(paths[i])}
+				_, skipReason, err := p.readSourceFile(target)
+				if err != nil {
+					return fail(err)
+				}
+				if target.Snapshot == nil {
+					return fail(fmt.Errorf("cannot %s %s: %s", change.Action, change.Path, skipReason))
+				}
+			}
+			targets[i] = target
+			old = target.Snapshot.Content
+		}
+
+		plan[i] = ui.PlannedChange{Path: change.Path, Action: string(change.Action)}
+		plan[i].Added, plan[i].Removed = multifile.LineStats(old, change.Content)
+	}
+	p.ui.ChangePlan(plan)
+
+	if opts.Preview && !confirm(fmt.Sprintf("Apply %d changes? (y/N): ", len(changes))) {
+		request.Skipped = true
+		request.SkipReason = "changes declined"
+		request.Duration = time.Since(startTime)
+		p.ui.FileSkipped(request.InputFile, request.SkipReason)
+		return append(skipped, request), nil
+	}
+
+	// Token usage is reported once, on the first change
+	results := skipped
+	for i, change := range changes {
+		result := &types.ProcessingResult{
+			InputFile:  change.Path,
+			OutputFile: change.Path,
+			Mode:       types.ModeMultiFile,
+		}
+		if i == 0 {
+			result.AITokensUsed = request.AITokensUsed
+			result.InputTokens = request.InputTokens
+			result.OutputTokens = request.OutputTokens
+			result.CachedTokens = request.CachedTokens
+			result.Redactions = request.Redactions
+			result.Cost = request.Cost
+			result.Context = request.Context
+		}
+
+		if err := p.applyChange(change, paths[i], targets[i], opts, result); err != nil {
+			result.Error = err
+			result.Conflict = errors.Is(err, types.ErrFileChanged)
+			p.ui.FileError(change.Path, err)
+		} else {
+			result.Success = true
+			p.ui.FileSuccess(change.Path, result.OutputFile, time.Since(startTime), result.AITokensUsed)
+			p.ui.FileNormalized(change.Path, result.Normalizations)
+		}
+		result.Duration = time.Since(startTime)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// multiFileRequest reads the inputs and builds the prompt of a multi-file
+// request. Inputs are returned as pinned context files, and also indexed by
+// fileKey so replaced inputs keep their snapshot for conflict checks.
+func (p *Processor) multiFileRequest(opts *types.ProcessingOptions, files []*types.FileInfo) (string, []*types.ContextFile, map[string]*types.FileInfo, []*types.ProcessingResult, error) {
+	var inputs []*types.ContextFile
+	var skipped []*types.ProcessingResult
+	byPath := make(map[string]*types.FileInfo, len(files))
+
+	for _, file := range files {
+		content, skipReason, err := p.readSourceFile(file)
+		if err != nil {
+			return "", nil, nil, nil, fmt.Errorf("%s: %w", file.Path, err)
+		}
+		if skipReason != "" {
+			skipped = append(skipped, &types.ProcessingResult{
+				InputFile:  file.Path,
+				Mode:       types.ModeMultiFile,
+				Skipped:    true,
+				SkipReason: skipReason,
+			})
+			p.ui.FileSkipped(file.Path, skipReason)
+			continue
+		}
+
+		byPath[fileKey(file.Path)] = file
+		inputs = append(inputs, &types.ContextFile{
+			Path:     file.Path,
+			Language: file.Language,
+			Content:  content,
+			Label:    filepath.ToSlash(relativePath(file.Path)),
+			Pinned:   true,
+		})
+	}
+
+	prompt := opts.AIPrompt
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", nil, nil, nil, fmt.Errorf("failed to get system prompt: %w", err)
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+	prompt += "\n\n" + multifile.Instructions()
+
+	return prompt, inputs, byPath, skipped, nil
+}
+
+// applyChange carries out one file block. target is the existing file for
+// replaces and deletes; it is backed up only once the change is certain to
+// be written over it.
+func (p *Processor) applyChange(change multifile.Change, path string, target *types.FileInfo, opts *types.ProcessingOptions, result *types.ProcessingResult) error {
+	backup := func() error {
+		if !opts.BackupOriginal {
+			return nil
+		}
+		if err := p.copyFile(path, path+".backup"); err != nil {
+			return fmt.Errorf("failed to create backup: %w", err)
+		}
+		return nil
+	}
+
+	switch change.Action {
+	case multifile.ActionDelete:
+		if _, changed, err := p.readIfChanged(target); err != nil {
+			return err
+		} else if changed {
+			return fmt.Errorf("%w: not deleted", types.ErrFileChanged)
+		}
+		if err := backup(); err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to delete: %w", err)
+		}
+		result.OutputFile = "(deleted)"
+		result.BytesChanged = -len(target.Snapshot.Content)
+		return nil
+
+	case multifile.ActionReplace:
+		content, notes := textfile.Restore(change.Content, target.Format)
+		result.Normalizations = notes
+
+		content, err := p.resolveConflict(target, content, opts)
+		if err != nil {
+			return err
+		}
+		if err := backup(); err != nil {
+			return err
+		}
+		if err := p.writeTextFile(path, content, target.Format); err != nil {
+			return err
+		}
+		result.BytesChanged = len(content) - len(target.Snapshot.Content)
+		return nil
+
+	default:
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := p.writeTextFile(path, change.Content, types.FileFormat{}); err != nil {
+			return err
+		}
+		result.BytesChanged = len(change.Content)
+		return nil
+	}
+}
+
+// withoutInputs drops context files that are already sent as inputs. The
+// inputs are keyed by fileKey.
+func withoutInputs(contextFiles []*types.ContextFile, inputs map[string]*types.FileInfo) []*types.ContextFile {
+	var kept []*types.ContextFile
+	for _, cf := range contextFiles {
+		if _, isInput := inputs[fileKey(cf.Path)]; !isInput {
+			kept = append(kept, cf)
+		}
+	}
+	return kept
+}
+
+// confirm asks a yes/no question on the terminal
+func confirm(question string) bool {
+	fmt.Print(question)
+	scanner := bufio.NewScanner(os.Stdin)
+	if !scanner.Scan() {
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// absPath returns path made absolute, or unchanged if that fails
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// fileKey identifies a file by its absolute path with symlinks resolved, as
+// multifile.Resolve returns it, so a file reached through a symlinked
+// working directory matches itself
+func fileKey(path string) string {
+	abs := absPath(path)
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+// relativePath shows path relative to the working directory when it is below it
+func relativePath(path string) string {
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, absPath(path)); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zachacious/presto/internal/multifile"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func TestMultiFileInputsUnderSymlinkedDir(t *testing.T) {
+	real := t.TempDir()
+	if err := os.WriteFile(filepath.Join(real, "a.go"), []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	t.Chdir(link)
+
+	p := &Processor{}
+	input := &types.FileInfo{Path: "a.go", OriginalPath: "a.go", Language: types.LangGo}
+	_, _, byPath, _, err := p.multiFileRequest(&types.ProcessingOptions{AIPrompt: "edit"}, []*types.FileInfo{input})
+	if err != nil {
+		t.Fatalf("multiFileRequest: %v", err)
+	}
+
+	// A replace of the input must find it, snapshot and all
+	paths, err := multifile.Resolve([]multifile.Change{{Path: "a.go", Action: multifile.ActionReplace}}, link)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if target := byPath[fileKey(paths[0])]; target != input || target.Snapshot == nil {
+		t.Errorf("replaced input %s not found among %v", paths[0], byPath)
+	}
+
+	kept := withoutInputs([]*types.ContextFile{{Path: filepath.Join(link, "a.go")}, {Path: "b.go"}}, byPath)
+	if len(kept) != 1 || kept[0].Path != "b.go" {
+		t.Errorf("withoutInputs kept %d files", len(kept))
+	}
+}
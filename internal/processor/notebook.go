@@ -0,0 +1,177 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/notebook"
+	"github.com/Zachacious/presto/internal/records"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// processNotebook transforms the cells of a Jupyter notebook that --cells
+// targets. Only cell sources are sent and replaced, so outputs, metadata
+// and the rest of the file stay as they were.
+func (p *Processor) processNotebook(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) *types.ProcessingResult {
+	return p.rewriteFile(file, opts, func(content string, result *types.ProcessingResult) (string, string, error) {
+		nb, cells, skipReason, err := notebookCells(content, opts)
+		if err != nil || skipReason != "" {
+			return "", skipReason, err
+		}
+		output, err := p.transformNotebook(file, nb, cells, opts, contextFiles, result)
+		return output, "", err
+	})
+}
+
+// notebookCells parses a notebook and picks the cells --cells targets.
+// Notebooks without such cells are skipped.
+func notebookCells(content string, opts *types.ProcessingOptions) (*notebook.Notebook, []*notebook.Cell, string, error) {
+	nb, err := notebook.Parse(content)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	cells := nb.Targets(opts.Cells)
+	if len(cells) == 0 {
+		if opts.Cells == "" || opts.Cells == notebook.CellAll {
+			return nil, nil, "notebook has no cells", nil
+		}
+		return nil, nil, fmt.Sprintf("no %s cells", opts.Cells), nil
+	}
+	return nb, cells, "", nil
+}
+
+// transformNotebook sends the targeted cells in one request and returns the
+// notebook with the answers written back
+func (p *Processor) transformNotebook(file *types.FileInfo, nb *notebook.Notebook, cells []*notebook.Cell, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, result *types.ProcessingResult) (string, error) {
+	prompt, items, fixedTokens, err := p.notebookRequest(nb, cells, opts)
+	if err != nil {
+		return "", err
+	}
+	text := nb.Text()
+	candidates := p.candidateContext(file, text, opts, contextFiles)
+	packed, usage := p.packContext(context.Target{Path: file.Path, Content: text}, fixedTokens, opts, candidates)
+	result.Context = usage
+	p.ui.FileContext(file.Path, usage)
+
+	sources := []*types.ContextFile{{Language: types.LangText, Content: items, Label: "Cells", Pinned: true}}
+	if len(cells) < len(nb.Cells) {
+		// The other cells explain what the targeted ones are for
+		sources = append(sources, &types.ContextFile{Path: file.Path, Language: types.LangNotebook, Content: text, Label: "Notebook (for reference): " + file.Path, Pinned: true})
+	}
+	sources = append(sources, packed...)
+
+	req := types.AIRequest{
+		Model:       opts.Model,
+		Prompt:      prompt,
+		FileName:    file.Path,
+		Language:    types.LangNotebook,
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		Mode:        types.ModeTransform,
+		PerItem:     true,
+	}
+
+	for attempt := 0; ; attempt++ {
+		aiResp, err := p.aiClient.ProcessContent(req, sources)
+		if err != nil {
+			return "", fmt.Errorf("AI processing failed: %w", err)
+		}
+		p.recordUsage(result, aiResp)
+		if aiResp.Truncated {
+			return "", fmt.Errorf("response was cut off (%s); narrow --cells or raise --max-tokens", aiResp.FinishReason)
+		}
+
+		values, err := records.ParseResults(aiResp.Content, len(cells))
+		if err == nil {
+			// A code fence around a cell is only unwrapped if it names the
+			// kernel's language, or none
+			codeLang := cellLanguage(nb)
+			updated := make(map[int]string, len(cells))
+			for i, c := range cells {
+				value := values[i]
+				if c.Type == notebook.CellCode {
+					value = p.aiClient.CleanOutput(value, codeLang)
+				}
+				// Jupyter leaves the newline off a cell's last line
+				if !strings.HasSuffix(c.Source, "\n") {
+					value = strings.TrimRight(value, "\n")
+				}
+				updated[c.Number] = value
+			}
+			return nb.Apply(updated), nil
+		}
+		if attempt > 0 {
+			return "", fmt.Errorf("invalid response for the notebook cells: %w", err)
+		}
+		req.Prompt = prompt + fmt.Sprintf("\n\nYour previous response was rejected: %v\nRespond again with only the JSON object.", err)
+	}
+}
+
+// cellLanguage is the language of a notebook's code cells: the kernel's,
+// or else LangNotebook, which is commented like Python
+func cellLanguage(nb *notebook.Notebook) types.Language {
+	if nb.Language == "" {
+		return types.LangNotebook
+	}
+	return types.Language(strings.ToLower(nb.Language))
+}
+
+// notebookRequest builds the prompt and the cell list of a notebook
+// request, and counts the tokens they take
+func (p *Processor) notebookRequest(nb *notebook.Notebook, cells []*notebook.Cell, opts *types.ProcessingOptions) (string, string, int, error) {
+	prompt := opts.AIPrompt + "\n\nThe content is cells of a Jupyter notebook; each record gives a cell's number, type and source."
+	if nb.Language != "" {
+		prompt += fmt.Sprintf(" Code cells are %s.", nb.Language)
+	}
+	prompt += " Answer with the new source of every cell, as plain text without code fences."
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", "", 0, fmt.Errorf("failed to get system prompt: %w", err)
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+	prompt += "\n\n" + records.Instructions()
+
+	inputs := make([]json.RawMessage, len(cells))
+	for i, c := range cells {
+		source := c.Source
+		if opts.RemoveComments && c.Type == notebook.CellCode {
+			source = p.commentRemover.RemoveComments(source, cellLanguage(nb))
+		}
+		inputs[i], _ = json.Marshal(map[string]any{"cell": c.Number, "type": c.Type, "source": source})
+	}
+	items := records.Batch(inputs)
+
+	fixedTokens := tokens.CountAll(p.config.AI.Provider, prompt, items) + promptOverheadTokens
+	if len(cells) < len(nb.Cells) {
+		fixedTokens += tokens.Count(nb.Text(), p.config.AI.Provider)
+	}
+	return prompt, items, fixedTokens, nil
+}
+
+// estimateNotebook projects input and output tokens for transforming the
+// targeted cells of one notebook
+func (p *Processor) estimateNotebook(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) (int, int, bool) {
+	content, skipReason, err := p.readSourceFile(file)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	nb, cells, skipReason, err := notebookCells(content, opts)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	_, items, fixedTokens, err := p.notebookRequest(nb, cells, opts)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	text := nb.Text()
+	candidates := p.candidateContext(file, text, opts, contextFiles)
+	_, usage := p.packContext(context.Target{Path: file.Path, Content: text}, fixedTokens, opts, candidates)
+	output := int(float64(tokens.Count(items, p.config.AI.Provider)) * transformOutputRatio)
+	return fixedTokens + contextTokens(usage), capTokens(output, opts.MaxTokens), true
+}
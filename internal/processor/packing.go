@@ -0,0 +1,139 @@
+package processor
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// contextMarginDivisor reserves 1/20 of the model window for tokenizer
+// estimation error
+const contextMarginDivisor = 20
+
+// packContext picks the context files for one request. fixedTokens is
+// everything else the request sends: prompt, input content and instructions.
+func (p *Processor) packContext(target context.Target, fixedTokens int, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) ([]*types.ContextFile, []types.ContextUsage) {
+	if len(contextFiles) == 0 {
+		return nil, nil
+	}
+	return p.packer.Pack(target, contextFiles, p.contextBudget(opts, fixedTokens))
+}
+
+// candidateContext returns the context files considered for one input: the
+// run's shared context plus the file's templated companions and, with auto
+// context, its local dependencies
+func (p *Processor) candidateContext(file *types.FileInfo, content string, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) []*types.ContextFile {
+	var extra []*types.ContextFile
+
+	// Templates were validated when the run's context was loaded
+	if templated, err := p.contextLoader.LoadTemplates(opts.ContextTemplates, file.Path, inputRoot(opts), p.config.Filters.MaxFileSize); err == nil {
+		extra = append(extra, templated...)
+	}
+	if opts.AutoContext {
+		extra = append(extra, p.deps.Dependencies(file.Path, content, file.Language, opts.AutoContextDepth, opts.AutoContextFull)...)
+	}
+	if len(extra) == 0 {
+		return contextFiles
+	}
+
+	seen := make(map[string]bool, len(contextFiles)+len(extra))
+	for _, cf := range contextFiles {
+		if abs, err := filepath.Abs(cf.Path); err == nil {
+			seen[abs] = true
+		}
+	}
+
+	candidates := append([]*types.ContextFile{}, contextFiles...)
+	for _, cf := range extra {
+		abs, err := filepath.Abs(cf.Path)
+		if err != nil || seen[abs] {
+			continue
+		}
+		seen[abs] = true
+		candidates = append(candidates, cf)
+	}
+	return candidates
+}
+
+// contextBudget returns how many tokens context files may use in a request:
+// what's left of the model window after the fixed part and the response,
+// capped by the configured context limit
+func (p *Processor) contextBudget(opts *types.ProcessingOptions, fixedTokens int) int {
+	model := opts.Model
+	if model == "" {
+		model = p.config.AI.Model
+	}
+	window := p.config.ContextWindowFor(model)
+
+	output := opts.MaxTokens
+	if output == 0 {
+		output = p.config.AI.MaxTokens
+	}
+
+	available := window - fixedTokens - output - window/contextMarginDivisor
+
+	limit := opts.ContextBudget
+	if limit == 0 {
+		limit = p.config.Context.MaxTokens
+	}
+	if limit > 0 && limit < available {
+		available = limit
+	}
+	return max(available, 0)
+}
+
+// contextTokens sums the tokens of the context actually sent
+func contextTokens(usage []types.ContextUsage) int {
+	total := 0
+	for _, u := range usage {
+		total += u.Tokens
+	}
+	return total
+}
+
+// contextModeRank orders context modes from the most to the least complete
+var contextModeRank = map[types.ContextMode]int{
+	types.ContextFull:      0,
+	types.ContextOutline:   1,
+	types.ContextTruncated: 2,
+	types.ContextDropped:   3,
+}
+
+// mergeUsage adds the context usage of one more request to that of the
+// requests before it. A file's tokens add up and it keeps its best score; it
+// is dropped only if no request took it, otherwise it shows the least
+// complete form it was sent in. Entries match on path and label, since
+// command output and other pathless context differ only by label.
+func mergeUsage(total, usage []types.ContextUsage) []types.ContextUsage {
+	for _, u := range usage {
+		i := slices.IndexFunc(total, func(t types.ContextUsage) bool { return t.Path == u.Path && t.Label == u.Label })
+		if i < 0 {
+			total = append(total, u)
+			continue
+		}
+		t := &total[i]
+		t.Tokens += u.Tokens
+		t.Score = max(t.Score, u.Score)
+		switch {
+		case t.Mode == types.ContextDropped:
+			t.Mode = u.Mode
+		case u.Mode != types.ContextDropped && contextModeRank[u.Mode] > contextModeRank[t.Mode]:
+			t.Mode = u.Mode
+		}
+	}
+	return total
+}
+
+// transformFixedTokens approximates everything but context in a transform request
+func (p *Processor) transformFixedTokens(file *types.FileInfo, prompt, content string) int {
+	return tokens.Count(prompt, p.config.AI.Provider) + promptOverheadTokens + p.transformContentTokens(file, content)
+}
+
+// transformContentTokens counts the content of a transform request and the
+// file context block rendered for it
+func (p *Processor) transformContentTokens(file *types.FileInfo, content string) int {
+	return tokens.CountAll(p.config.AI.Provider, content, p.renderFileContext(file, content))
+}
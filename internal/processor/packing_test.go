@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func TestMergeUsage(t *testing.T) {
+	var total []types.ContextUsage
+	total = mergeUsage(total, []types.ContextUsage{
+		{Path: "a.go", Mode: types.ContextFull, Tokens: 100, Score: 0.5},
+		{Path: "b.go", Mode: types.ContextDropped, Score: 0.2},
+		{Path: "c.go", Mode: types.ContextOutline, Tokens: 30, Score: 0.3},
+	})
+	total = mergeUsage(total, []types.ContextUsage{
+		{Path: "a.go", Mode: types.ContextTruncated, Tokens: 40, Score: 0.9},
+		{Path: "b.go", Mode: types.ContextOutline, Tokens: 20, Score: 0.1},
+		{Path: "c.go", Mode: types.ContextDropped, Score: 0.3},
+		{Path: "d.go", Mode: types.ContextDropped, Score: 0.1},
+	})
+
+	want := []types.ContextUsage{
+		{Path: "a.go", Mode: types.ContextTruncated, Tokens: 140, Score: 0.9},
+		{Path: "b.go", Mode: types.ContextOutline, Tokens: 20, Score: 0.2},
+		{Path: "c.go", Mode: types.ContextOutline, Tokens: 30, Score: 0.3},
+		{Path: "d.go", Mode: types.ContextDropped, Score: 0.1},
+	}
+	if len(total) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(total), len(want), total)
+	}
+	for i := range want {
+		if total[i] != want[i] {
+			t.Errorf("entry %d: got %+v, want %+v", i, total[i], want[i])
+		}
+	}
+	if got := contextTokens(total); got != 190 {
+		t.Errorf("contextTokens = %d, want 190", got)
+	}
+}
+
+func TestMergeUsagePathless(t *testing.T) {
+	var total []types.ContextUsage
+	total = mergeUsage(total, []types.ContextUsage{
+		{Label: "$ git log", Mode: types.ContextFull, Tokens: 50},
+		{Label: "$ go env", Mode: types.ContextFull, Tokens: 10},
+	})
+	total = mergeUsage(total, []types.ContextUsage{
+		{Label: "$ git log", Mode: types.ContextFull, Tokens: 50},
+		{Label: "$ go env", Mode: types.ContextDropped},
+	})
+
+	want := []types.ContextUsage{
+		{Label: "$ git log", Mode: types.ContextFull, Tokens: 100},
+		{Label: "$ go env", Mode: types.ContextFull, Tokens: 10},
+	}
+	if len(total) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(total), len(want), total)
+	}
+	for i := range want {
+		if total[i] != want[i] {
+			t.Errorf("entry %d: got %+v, want %+v", i, total[i], want[i])
+		}
+	}
+}
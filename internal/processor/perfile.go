@@ -0,0 +1,239 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/language"
+	"github.com/Zachacious/presto/internal/textfile"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/internal/utils"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// generateFile runs one request of a per-file generate: the input is sent as
+// context and the response becomes a new file at the output template's path.
+// An output that already exists is handled by the OnExists policy.
+func (p *Processor) generateFile(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) *types.ProcessingResult {
+	startTime := time.Now()
+	outputPath := p.generatedPath(file, opts)
+
+	result := &types.ProcessingResult{
+		InputFile:  file.Path,
+		OutputFile: outputPath,
+		Mode:       types.ModeGenerate,
+	}
+
+	p.ui.FileProcessing(filepath.Base(file.Path))
+
+	// Check the existing output first, so a skip costs nothing
+	existing, existingContent, skipReason, err := p.readExistingOutput(outputPath, opts)
+	if err == nil && skipReason == "" {
+		var contentStr string
+		contentStr, skipReason, err = p.readSourceFile(file)
+		if err == nil && skipReason == "" {
+			err = p.generateOutput(file, contentStr, existing, existingContent, opts, contextFiles, result)
+		}
+	}
+
+	result.Duration = time.Since(startTime)
+	switch {
+	case err != nil:
+		result.Error = err
+		result.Conflict = errors.Is(err, types.ErrFileChanged)
+		p.ui.FileError(file.Path, err)
+	case skipReason != "":
+		result.Skipped = true
+		result.SkipReason = skipReason
+		p.ui.FileSkipped(file.Path, skipReason)
+	default:
+		p.ui.FileSuccess(file.Path, result.OutputFile, result.Duration, result.AITokensUsed)
+		p.ui.FileNormalized(result.OutputFile, result.Normalizations)
+	}
+	return result
+}
+
+// generateOutput sends the request for one input and writes the response
+func (p *Processor) generateOutput(file *types.FileInfo, content string, existing *types.FileInfo, existingContent string, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, result *types.ProcessingResult) error {
+	outputPath := result.OutputFile
+
+	prompt, err := p.perFilePrompt(opts, outputPath, existing != nil)
+	if err != nil {
+		return fmt.Errorf("failed to get system prompt: %w", err)
+	}
+
+	// The input, and the output being merged into, are always sent in full;
+	// the rest of the context is packed around them
+	fixedTokens := tokens.CountAll(p.config.AI.Provider, prompt, content, existingContent) + promptOverheadTokens
+	var candidates []*types.ContextFile
+	for _, cf := range p.candidateContext(file, content, opts, contextFiles) {
+		if existing == nil || !utils.SamePath(cf.Path, outputPath) {
+			candidates = append(candidates, cf)
+		}
+	}
+	packed, usage := p.packContext(context.Target{Path: file.Path, Content: content}, fixedTokens, opts, candidates)
+	result.Context = usage
+	p.ui.FileContext(file.Path, usage)
+
+	sources := []*types.ContextFile{{
+		Path:     file.Path,
+		Language: file.Language,
+		Content:  content,
+		Label:    "Input: " + file.Path,
+		Pinned:   true,
+	}}
+	if existing != nil {
+		sources = append(sources, &types.ContextFile{
+			Path:     outputPath,
+			Language: existing.Language,
+			Content:  existingContent,
+			Label:    "Existing output: " + outputPath,
+			Pinned:   true,
+		})
+	}
+
+	outputLang := language.DetectLanguage(outputPath)
+	aiResp, err := p.aiClient.ProcessContent(types.AIRequest{
+		Model:       opts.Model,
+		Prompt:      prompt,
+		FileName:    outputPath,
+		Language:    outputLang,
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		Mode:        types.ModeGenerate,
+	}, append(sources, packed...))
+	if err != nil {
+		return fmt.Errorf("AI processing failed: %w", err)
+	}
+	p.recordUsage(result, aiResp)
+
+	output := p.aiClient.CleanOutput(aiResp.Content, outputLang)
+
+	// An existing output keeps its own conventions; a new one follows the
+	// input's encoding and line endings but not its permissions, and one
+	// being overwritten keeps its permissions
+	format := file.Format
+	format.Mode = 0
+	if info, err := os.Stat(outputPath); err == nil {
+		format.Mode = info.Mode().Perm()
+	}
+	if existing != nil {
+		format = existing.Format
+		output, result.Normalizations = textfile.Restore(output, format)
+
+		// Don't clobber edits made to the output while we were waiting
+		resolved, err := p.resolveConflict(existing, output, opts)
+		if err != nil {
+			return err
+		}
+		output = resolved
+	} else {
+		output, _ = textfile.Restore(output, format)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := p.writeTextFile(outputPath, output, format); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	result.Success = true
+	result.BytesChanged = len(output) - len(existingContent)
+	return nil
+}
+
+// readExistingOutput applies the OnExists policy to an output path. For a
+// merge it returns the existing file and its content; a skip is returned as
+// a reason. A missing output returns nothing.
+func (p *Processor) readExistingOutput(outputPath string, opts *types.ProcessingOptions) (*types.FileInfo, string, string, error) {
+	if !utils.FileExists(outputPath) {
+		return nil, "", "", nil
+	}
+
+	switch opts.OnExists {
+	case types.ExistsOverwrite:
+		return nil, "", "", nil
+	case types.ExistsMerge:
+		existing := &types.FileInfo{
+			Path:         outputPath,
+			OriginalPath: outputPath,
+			Language:     language.DetectLanguage(outputPath),
+		}
+		content, skipReason, err := p.readSourceFile(existing)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to read existing output: %w", err)
+		}
+		if skipReason != "" {
+			return nil, "", "existing output " + skipReason, nil
+		}
+		return existing, content, "", nil
+	default:
+		return nil, "", "output exists: " + outputPath, nil
+	}
+}
+
+// perFilePrompt builds the prompt for one per-file generate request. As in
+// single-output generate, the system prompt is only sent when overridden.
+func (p *Processor) perFilePrompt(opts *types.ProcessingOptions, outputPath string, merging bool) (string, error) {
+	prompt := opts.AIPrompt
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", err
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+
+	prompt += fmt.Sprintf("\n\nWrite the file %s for the input file above. Return only the file's content, without markdown code fences or commentary.", outputPath)
+	if merging {
+		prompt += " The file already exists and is included above; return the complete updated file, keeping its existing content unless asked to change it."
+	}
+	return prompt, nil
+}
+
+// generatedPath expands the output template for one input file
+func (p *Processor) generatedPath(file *types.FileInfo, opts *types.ProcessingOptions) string {
+	// The template was validated before the run started
+	path, _ := utils.ExpandPathTemplate(opts.OutputTemplate, file.Path, inputRoot(opts))
+	return path
+}
+
+// checkGeneratedPaths expands the output template for every input before
+// any request is sent. Two inputs writing the same output would race on it,
+// and an output that is an input would overwrite it.
+func (p *Processor) checkGeneratedPaths(files []*types.FileInfo, opts *types.ProcessingOptions) error {
+	inputs := make(map[string]string, len(files))
+	for _, file := range files {
+		inputs[absPath(file.Path)] = file.Path
+	}
+
+	outputs := make(map[string]string, len(files))
+	for _, file := range files {
+		outputPath := p.generatedPath(file, opts)
+		abs := absPath(outputPath)
+		if input, ok := inputs[abs]; ok {
+			if input == file.Path {
+				return fmt.Errorf("output template writes %s over its own input", outputPath)
+			}
+			return fmt.Errorf("output template writes %s for %s over the input %s", outputPath, file.Path, input)
+		}
+		if other, ok := outputs[abs]; ok {
+			return fmt.Errorf("output template writes %s for both %s and %s", outputPath, other, file.Path)
+		}
+		outputs[abs] = file.Path
+	}
+	return nil
+}
+
+// inputRoot is the directory the run's input paths are relative to
+func inputRoot(opts *types.ProcessingOptions) string {
+	if info, err := os.Stat(opts.InputPath); err == nil && !info.IsDir() {
+		return filepath.Dir(opts.InputPath)
+	}
+	return opts.InputPath
+}
@@ -0,0 +1,34 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func TestCheckGeneratedPaths(t *testing.T) {
+	files := []*types.FileInfo{{Path: "src/a/x.go"}, {Path: "src/b/x.go"}, {Path: "src/b/y.go"}}
+	tests := []struct {
+		template string
+		err      string
+	}{
+		{"docs/{{relpath}}.md", ""},
+		{"{{dir}}/{{stem}}_test{{ext}}", ""},
+		{"docs/{{stem}}.md", "for both src/a/x.go and src/b/x.go"},
+		{"{{path}}", "over its own input"},
+		{"src/b/y.go", "for src/a/x.go over the input src/b/y.go"},
+		{"{{dir}}/y.go", "for src/b/x.go over the input src/b/y.go"},
+	}
+	p := &Processor{}
+	for _, tt := range tests {
+		opts := &types.ProcessingOptions{InputPath: "src", OutputTemplate: tt.template}
+		err := p.checkGeneratedPaths(files, opts)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.template, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want one containing %q", tt.template, err, tt.err)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package processor
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -13,8 +17,17 @@ import (
 	"github.com/Zachacious/presto/internal/ai"
 	"github.com/Zachacious/presto/internal/comments"
 	"github.com/Zachacious/presto/internal/config"
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/filecontext"
+	"github.com/Zachacious/presto/internal/gitdiff"
 	"github.com/Zachacious/presto/internal/language"
+	"github.com/Zachacious/presto/internal/merge"
+	"github.com/Zachacious/presto/internal/redact"
+	"github.com/Zachacious/presto/internal/repomap"
+	"github.com/Zachacious/presto/internal/textfile"
+	"github.com/Zachacious/presto/internal/tokens"
 	"github.com/Zachacious/presto/internal/ui"
+	"github.com/Zachacious/presto/internal/utils"
 	"github.com/Zachacious/presto/pkg/types"
 )
 
@@ -35,6 +48,11 @@ type Processor struct {
 	aiClient       *ai.Client
 	commentRemover *comments.Remover
 	config         *config.Config
+	redactor       *redact.Redactor
+	fileContext    *filecontext.Builder
+	contextLoader  *context.Handler
+	packer         *context.Packer
+	deps           *context.Resolver
 	ui             *ui.UI
 }
 
@@ -51,35 +69,105 @@ func New(cfg *config.Config) (*Processor, error) {
 		return nil, fmt.Errorf("invalid AI configuration: %w", err)
 	}
 
+	redactor, err := newRedactor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	aiClient.SetRedactor(redactor)
+
+	fileContext, err := newFileContext(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Processor{
 		aiClient:       aiClient,
 		commentRemover: comments.New(),
 		config:         cfg,
+		redactor:       redactor,
+		fileContext:    fileContext,
+		contextLoader:  context.New(),
+		packer:         context.NewPacker(cfg.AI.Provider),
+		deps:           context.NewResolver(cfg.Filters.MaxFileSize),
 	}, nil
 }
 
+// newFileContext builds the file context renderer described by the config,
+// or nil when the block is switched off
+func newFileContext(cfg *config.Config) (*filecontext.Builder, error) {
+	if !cfg.FileContext.Enabled {
+		return nil, nil
+	}
+	return filecontext.New(cfg.FileContext.Fields, cfg.FileContext.Template)
+}
+
+// renderFileContext describes a file for its transform prompt; a render
+// failure is reported once per file and the block is left out
+func (p *Processor) renderFileContext(file *types.FileInfo, content string) string {
+	if p.fileContext == nil {
+		return ""
+	}
+	block, err := p.fileContext.Build(file.Path, content, file.Language)
+	if err != nil {
+		if p.ui != nil {
+			p.ui.Warning(fmt.Sprintf("%s: %v", file.Path, err))
+		}
+		return ""
+	}
+	return block
+}
+
+// newRedactor builds the redactor described by the config, or nil when
+// redaction is disabled
+func newRedactor(cfg *config.Config) (*redact.Redactor, error) {
+	if !cfg.Redaction.Enabled {
+		return nil, nil
+	}
+
+	redactor, err := redact.New(cfg.Redaction.Detectors, cfg.Redaction.Patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redaction configuration: %w", err)
+	}
+	return redactor, nil
+}
+
 // ProcessPath processes files based on the given options
 func (p *Processor) ProcessPath(opts *types.ProcessingOptions) ([]*types.ProcessingResult, error) {
 	// Update UI verbose setting
 	p.ui = ui.New(opts.Verbose)
 
 	// Load prompt from file if specified
-	if opts.PromptFile != "" {
-		content, err := os.ReadFile(opts.PromptFile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read prompt file: %w", err)
-		}
-		opts.AIPrompt = string(content)
+	if err := p.loadPromptFile(opts); err != nil {
+		return nil, err
 	}
-
-	// Find files to process
-	files, err := p.findFiles(opts)
+	if err := p.checkBudget(opts); err != nil {
+		return nil, err
+	}
+	query, err := p.runQuery(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find files: %w", err)
+		return nil, err
 	}
 
-	if len(files) == 0 {
-		return nil, fmt.Errorf("no files found to process")
+	// Find files to process; single-output generate works from context alone,
+	// and inputs are optional for multi-file and map-reduce runs
+	var files []*types.FileInfo
+	perFile := opts.Mode == types.ModeTransform || opts.Mode == types.ModeReview || opts.Mode == types.ModeExtract || opts.Mode == types.ModeClassify || opts.Mode == types.ModeRecords || opts.OutputTemplate != ""
+	optionalInputs := opts.Mode == types.ModeMultiFile || opts.MapPrompt != ""
+	if perFile || (optionalInputs && opts.InputPath != "") {
+		var err error
+		files, err = p.findFiles(opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find files: %w", err)
+		}
+
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no files found to process")
+		}
+	}
+	if opts.Mode == types.ModeGenerate && opts.OutputTemplate != "" {
+		if err := p.checkGeneratedPaths(files, opts); err != nil {
+			return nil, err
+		}
 	}
 
 	// Load context files
@@ -91,7 +179,7 @@ func (p *Processor) ProcessPath(opts *types.ProcessingOptions) ([]*types.Process
 	if opts.Verbose {
 		fmt.Printf("📁 Found %d files to process\n", len(files))
 		if len(contextFiles) > 0 {
-			fmt.Printf("📋 Loaded %d context files\n", len(contextFiles))
+			fmt.Printf("📋 %s\n", p.contextLoader.SummarizeContext(contextFiles))
 		}
 	}
 
@@ -101,34 +189,82 @@ func (p *Processor) ProcessPath(opts *types.ProcessingOptions) ([]*types.Process
 	// Process files
 	switch opts.Mode {
 	case types.ModeGenerate:
+		if perFile {
+			return p.processFiles(opts, files, contextFiles, nil)
+		}
+		if opts.MapPrompt != "" {
+			return p.processMapReduce(opts, files, contextFiles)
+		}
 		return p.processGenerate(opts, contextFiles)
-	case types.ModeTransform:
-		return p.processTransform(opts, files, contextFiles)
+	case types.ModeTransform, types.ModeReview, types.ModeExtract, types.ModeClassify:
+		return p.processFiles(opts, files, contextFiles, query)
+	case types.ModeMultiFile:
+		return p.processMultiFile(opts, files, contextFiles)
+	case types.ModeRecords:
+		return p.processRecords(opts, files, contextFiles)
 	default:
 		return nil, fmt.Errorf("unknown processing mode: %s", opts.Mode)
 	}
 }
 
-// processTransform processes files in transform mode
-func (p *Processor) processTransform(opts *types.ProcessingOptions, files []*types.FileInfo, contextFiles []*types.ContextFile) ([]*types.ProcessingResult, error) {
+// loadPromptFile replaces the prompt with the prompt file's content, if one is set
+func (p *Processor) loadPromptFile(opts *types.ProcessingOptions) error {
+	if opts.PromptFile == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(opts.PromptFile)
+	if err != nil {
+		return fmt.Errorf("failed to read prompt file: %w", err)
+	}
+	opts.AIPrompt = string(content)
+	return nil
+}
+
+// processFiles sends each input file through its own request: transform,
+// generate with an output template, or query for review, extract and
+// classify runs
+func (p *Processor) processFiles(opts *types.ProcessingOptions, files []*types.FileInfo, contextFiles []*types.ContextFile, query *fileQuery) ([]*types.ProcessingResult, error) {
 	if opts.DryRun {
-		return p.simulateTransform(opts, files), nil
+		return p.simulateFiles(opts, files), nil
 	}
 
-	// Create channels for jobs and results
-	jobs := make(chan *types.FileInfo, len(files))
+	// Jobs are unbuffered so each one is checked against the budget only
+	// when a worker is ready for it
+	jobs := make(chan *fileJob)
 	results := make(chan *types.ProcessingResult, len(files))
 
+	limits := p.newBudget(opts)
+	promptTokens := 0
+	if limits != nil {
+		var err error
+		if promptTokens, err = p.countPromptTokens(opts); err != nil {
+			return nil, err
+		}
+	}
+
 	// Start workers
 	var wg sync.WaitGroup
 	for i := 0; i < opts.MaxConcurrent; i++ {
 		wg.Add(1)
-		go p.transformWorker(&wg, jobs, results, opts, contextFiles)
+		go p.fileWorker(&wg, jobs, results, opts, contextFiles, query, limits)
 	}
 
-	// Send jobs
+	// Send jobs, stopping once the budget would be exceeded
 	for _, file := range files {
-		jobs <- file
+		job := &fileJob{file: file}
+		if limits != nil {
+			// Files that will be skipped anyway (binary, unreadable) don't count
+			var sendable bool
+			job.inputTokens, job.outputTokens, sendable = p.estimateInput(file, opts, promptTokens, contextFiles, query)
+			if sendable && !limits.reserve(job.inputTokens, job.outputTokens) {
+				result := budgetSkipped(file.Path, opts.Mode, limits.stopReason())
+				p.ui.FileSkipped(file.Path, result.SkipReason)
+				results <- result
+				continue
+			}
+		}
+		jobs <- job
 	}
 	close(jobs)
 
@@ -152,15 +288,38 @@ func (p *Processor) processTransform(opts *types.ProcessingOptions, files []*typ
 		}
 	}
 
+	if query != nil && query.write != nil {
+		if err := query.write(allResults); err != nil {
+			return nil, err
+		}
+	}
 	return allResults, nil
 }
 
-// transformWorker processes individual files
-func (p *Processor) transformWorker(wg *sync.WaitGroup, jobs <-chan *types.FileInfo, results chan<- *types.ProcessingResult, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) {
+// fileJob is a file queued for processing along with its budget reservation
+type fileJob struct {
+	file         *types.FileInfo
+	inputTokens  int
+	outputTokens int
+}
+
+// fileWorker processes individual files
+func (p *Processor) fileWorker(wg *sync.WaitGroup, jobs <-chan *fileJob, results chan<- *types.ProcessingResult, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, query *fileQuery, limits *budget) {
 	defer wg.Done()
 
-	for file := range jobs {
-		result := p.processFile(file, opts, contextFiles)
+	for job := range jobs {
+		var result *types.ProcessingResult
+		switch {
+		case query != nil:
+			result = p.queryFile(job.file, opts, contextFiles, *query)
+		case opts.Mode == types.ModeGenerate:
+			result = p.generateFile(job.file, opts, contextFiles)
+		default:
+			result = p.processFile(job.file, opts, contextFiles)
+		}
+		if limits != nil {
+			limits.settle(job.inputTokens, job.outputTokens, result)
+		}
 		results <- result
 	}
 }
@@ -186,6 +345,19 @@ func (p *Processor) getSystemPrompt(opts *types.ProcessingOptions) (string, erro
 
 // Update the processFile function to pass the file name
 func (p *Processor) processFile(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) *types.ProcessingResult {
+	if len(opts.Selectors) > 0 {
+		return p.processSelected(file, opts, contextFiles)
+	}
+	if len(opts.Sections) > 0 {
+		return p.processSections(file, opts, contextFiles)
+	}
+	if len(opts.Symbols) > 0 || len(opts.LineRanges) > 0 {
+		return p.processRegions(file, opts, contextFiles)
+	}
+	if file.Language == types.LangNotebook {
+		return p.processNotebook(file, opts, contextFiles)
+	}
+
 	startTime := time.Now()
 
 	result := &types.ProcessingResult{
@@ -197,15 +369,21 @@ func (p *Processor) processFile(file *types.FileInfo, opts *types.ProcessingOpti
 	// Show processing status
 	p.ui.FileProcessing(filepath.Base(file.Path))
 
-	// Read file content
-	content, err := os.ReadFile(file.Path)
+	// Read and decode file content
+	contentStr, skipReason, err := p.readSourceFile(file)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to read file: %w", err)
+		result.Error = err
 		result.Duration = time.Since(startTime)
+		p.ui.FileError(file.Path, result.Error)
+		return result
+	}
+	if skipReason != "" {
+		result.Skipped = true
+		result.SkipReason = skipReason
+		result.Duration = time.Since(startTime)
+		p.ui.FileSkipped(file.Path, skipReason)
 		return result
 	}
-
-	contentStr := string(content)
 
 	// Remove comments if requested
 	if opts.RemoveComments {
@@ -230,8 +408,15 @@ func (p *Processor) processFile(file *types.FileInfo, opts *types.ProcessingOpti
 		finalPrompt = opts.AIPrompt
 	}
 
+	// Fit the most relevant context into what's left of the model window
+	fixedTokens := p.transformFixedTokens(file, finalPrompt, contentStr)
+	candidates := p.candidateContext(file, contentStr, opts, contextFiles)
+	packed, usage := p.packContext(context.Target{Path: file.Path, Content: contentStr}, fixedTokens, opts, candidates)
+	result.Context = usage
+	p.ui.FileContext(file.Path, usage)
+
 	// Process with AI - WITH UI UPDATES
-	_, totalTokens, err := p.processWithContinuationAndUI(file, finalPrompt, contentStr, opts, contextFiles)
+	aiResp, err := p.processWithContinuationAndUI(file, finalPrompt, contentStr, opts, packed)
 	if err != nil {
 		result.Error = fmt.Errorf("AI processing failed: %w", err)
 		result.Duration = time.Since(startTime)
@@ -239,55 +424,42 @@ func (p *Processor) processFile(file *types.FileInfo, opts *types.ProcessingOpti
 		return result
 	}
 
-	result.AITokensUsed = totalTokens
+	p.recordUsage(result, aiResp)
 
-	// Create AI request
-	aiReq := types.AIRequest{
-		Prompt:      finalPrompt,
-		Content:     contentStr,
-		FileName:    file.Path,
-		Language:    file.Language,
-		MaxTokens:   opts.MaxTokens,
-		Temperature: opts.Temperature,
-		Mode:        opts.Mode,
-	}
-
-	// Process with AI
-	aiResp, err := p.aiClient.ProcessContent(aiReq, contextFiles)
-	if err != nil {
-		result.Error = fmt.Errorf("AI processing failed: %w", err)
-		result.Duration = time.Since(startTime)
-		return result
-	}
-
-	result.AITokensUsed = aiResp.TokensUsed
+	// Match the source file's line endings and final newline
+	output, notes := textfile.Restore(aiResp.Content, file.Format)
+	result.Normalizations = notes
 
 	// Handle output
-	outputFile, err := p.handleOutput(file.Path, aiResp.Content, opts)
+	outputFile, err := p.handleOutput(file, output, opts)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to write output: %w", err)
+		result.Conflict = errors.Is(err, types.ErrFileChanged)
 		result.Duration = time.Since(startTime)
+		p.ui.FileError(file.Path, result.Error)
 		return result
 	}
 
 	result.OutputFile = outputFile
 	result.Success = true
-	result.BytesChanged = len(aiResp.Content) - len(contentStr)
+	result.BytesChanged = len(output) - len(contentStr)
 	result.Duration = time.Since(startTime)
 
 	// Show success
 	p.ui.FileSuccess(file.Path, outputFile, result.Duration, result.AITokensUsed)
+	p.ui.FileNormalized(file.Path, result.Normalizations)
 
 	return result
 }
 
 // NEW: Process with continuation and UI updates
-func (p *Processor) processWithContinuationAndUI(file *types.FileInfo, prompt, originalContent string, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) (string, int, error) {
+func (p *Processor) processWithContinuationAndUI(file *types.FileInfo, prompt, originalContent string, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) (*types.AIResponse, error) {
 	const MAX_CONTINUATIONS = 5
 
 	var fullContent strings.Builder
-	var totalTokens int
+	usage := &types.AIResponse{}
 	currentPrompt := prompt
+	fileContext := p.renderFileContext(file, originalContent)
 
 	for attempt := 0; attempt < MAX_CONTINUATIONS; attempt++ {
 		// Update UI for continuation attempts
@@ -297,9 +469,11 @@ func (p *Processor) processWithContinuationAndUI(file *types.FileInfo, prompt, o
 
 		// Create AI request
 		aiReq := types.AIRequest{
+			Model:       opts.Model,
 			Prompt:      currentPrompt,
 			Content:     originalContent,
 			FileName:    file.Path,
+			FileContext: fileContext,
 			Language:    file.Language,
 			MaxTokens:   opts.MaxTokens,
 			Temperature: opts.Temperature,
@@ -309,10 +483,17 @@ func (p *Processor) processWithContinuationAndUI(file *types.FileInfo, prompt, o
 		// Process with AI
 		aiResp, err := p.aiClient.ProcessContent(aiReq, contextFiles)
 		if err != nil {
-			return "", totalTokens, err
+			return nil, err
 		}
 
-		totalTokens += aiResp.TokensUsed
+		usage.Model = aiResp.Model
+		usage.FinishReason = aiResp.FinishReason
+		usage.Truncated = aiResp.Truncated
+		usage.TokensUsed += aiResp.TokensUsed
+		usage.InputTokens += aiResp.InputTokens
+		usage.OutputTokens += aiResp.OutputTokens
+		usage.CachedTokens += aiResp.CachedTokens
+		usage.Redactions += aiResp.Redactions
 
 		// First response - add everything
 		if attempt == 0 {
@@ -348,7 +529,21 @@ func (p *Processor) processWithContinuationAndUI(file *types.FileInfo, prompt, o
 		}
 	}
 
-	return fullContent.String(), totalTokens, nil
+	usage.Content = fullContent.String()
+	return usage, nil
+}
+
+// recordUsage copies token usage from a response into a result and prices it
+func (p *Processor) recordUsage(result *types.ProcessingResult, resp *types.AIResponse) {
+	result.AITokensUsed += resp.TokensUsed
+	result.InputTokens += resp.InputTokens
+	result.OutputTokens += resp.OutputTokens
+	result.CachedTokens += resp.CachedTokens
+	result.Redactions += resp.Redactions
+
+	if price, ok := p.config.PriceFor(resp.Model); ok {
+		result.Cost += price.Cost(resp.InputTokens, resp.OutputTokens, resp.CachedTokens)
+	}
 }
 
 // processGenerate processes files in generate mode
@@ -383,8 +578,26 @@ func (p *Processor) processGenerate(opts *types.ProcessingOptions, contextFiles
 		finalPrompt = systemPrompt + "\n\n" + opts.AIPrompt
 	}
 
+	// Fit the context most relevant to the prompt into the model window
+	promptTokens := tokens.Count(finalPrompt, p.config.AI.Provider)
+	packed, usage := p.packContext(context.Target{Content: finalPrompt}, promptTokens, opts, contextFiles)
+	result.Context = usage
+	p.ui.FileContext(opts.OutputPath, usage)
+
+	// Check the request against the run budget
+	if limits := p.newBudget(opts); limits != nil {
+		input := promptTokens + contextTokens(usage)
+		if !limits.reserve(input, capTokens(generateOutputTokens, opts.MaxTokens)) {
+			skipped := budgetSkipped(result.InputFile, types.ModeGenerate, limits.stopReason())
+			skipped.OutputFile = opts.OutputPath
+			p.ui.FileSkipped(opts.OutputPath, skipped.SkipReason)
+			return []*types.ProcessingResult{skipped}, nil
+		}
+	}
+
 	// Create AI request for generation
 	aiReq := types.AIRequest{
+		Model:       opts.Model,
 		Prompt:      finalPrompt,
 		Content:     "",
 		Language:    types.LangText,
@@ -394,14 +607,14 @@ func (p *Processor) processGenerate(opts *types.ProcessingOptions, contextFiles
 	}
 
 	// Process with AI
-	aiResp, err := p.aiClient.ProcessContent(aiReq, contextFiles)
+	aiResp, err := p.aiClient.ProcessContent(aiReq, packed)
 	if err != nil {
 		result.Error = fmt.Errorf("AI processing failed: %w", err)
 		result.Duration = time.Since(startTime)
 		return []*types.ProcessingResult{result}, nil
 	}
 
-	result.AITokensUsed = aiResp.TokensUsed
+	p.recordUsage(result, aiResp)
 
 	// Write output file
 	if err := os.WriteFile(opts.OutputPath, []byte(aiResp.Content), 0644); err != nil {
@@ -420,6 +633,27 @@ func (p *Processor) processGenerate(opts *types.ProcessingOptions, contextFiles
 
 func (p *Processor) findFiles(opts *types.ProcessingOptions) ([]*types.FileInfo, error) {
 	var files []*types.FileInfo
+	var err error
+	if opts.ChangedSince != "" {
+		files, err = p.findChangedFiles(opts)
+	} else {
+		files, err = p.walkFiles(opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if opts.Mode == types.ModeRecords {
+		files = p.withoutRecordOutputs(files, opts)
+	}
+	if len(opts.Tagged) == 0 {
+		return files, nil
+	}
+	return filterTagged(files, opts)
+}
+
+// walkFiles lists the files under opts.InputPath that pass the filters
+func (p *Processor) walkFiles(opts *types.ProcessingOptions) ([]*types.FileInfo, error) {
+	var files []*types.FileInfo
 
 	err := filepath.Walk(opts.InputPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -456,6 +690,43 @@ func (p *Processor) findFiles(opts *types.ProcessingOptions) ([]*types.FileInfo,
 	return files, err
 }
 
+// findChangedFiles returns the files changed since opts.ChangedSince, limited
+// to opts.InputPath when one is given and filtered like a directory walk
+func (p *Processor) findChangedFiles(opts *types.ProcessingOptions) ([]*types.FileInfo, error) {
+	changed, err := gitdiff.ChangedFiles(opts.ChangedSince)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*types.FileInfo
+	for _, abs := range changed {
+		path := relativePath(abs)
+		if opts.InputPath != "" && !utils.SamePath(path, opts.InputPath) && !isBelow(abs, absPath(opts.InputPath), opts.Recursive) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || p.shouldSkipFile(path, opts) {
+			continue
+		}
+		files = append(files, &types.FileInfo{
+			Path:         path,
+			OriginalPath: path,
+			Language:     language.DetectLanguage(path),
+			Size:         info.Size(),
+		})
+	}
+	return files, nil
+}
+
+// isBelow reports whether path is inside dir, directly unless recursive
+func isBelow(path, dir string, recursive bool) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return recursive || !strings.Contains(rel, string(filepath.Separator))
+}
+
 func (p *Processor) shouldSkipFile(path string, opts *types.ProcessingOptions) bool {
 	// Check file size limit
 	if info, err := os.Stat(path); err == nil {
@@ -489,63 +760,94 @@ func (p *Processor) shouldSkipFile(path string, opts *types.ProcessingOptions) b
 	return false
 }
 
+// loadContextFiles loads the run's shared context through the context handler
 func (p *Processor) loadContextFiles(opts *types.ProcessingOptions) ([]*types.ContextFile, error) {
-	var contextFiles []*types.ContextFile
-
-	// Load individual context files
-	for _, file := range opts.ContextFiles {
-		content, err := os.ReadFile(file)
-		if err != nil {
-			continue // Skip files that can't be read
+	// Per-input templates are expanded later, file by file; catch typos now
+	for _, tmpl := range opts.ContextTemplates {
+		if err := utils.ValidatePathTemplate(tmpl); err != nil {
+			return nil, fmt.Errorf("invalid context template: %w", err)
 		}
+	}
 
-		lang := language.DetectLanguage(file)
-		contextFile := &types.ContextFile{
-			Path:     file,
-			Language: lang,
-			Content:  string(content),
-			Label:    filepath.Base(file),
-		}
-		contextFiles = append(contextFiles, contextFile)
+	contextFiles, err := p.contextLoader.LoadContext(opts.ContextPatterns, opts.ContextFiles, ".", p.config.Filters.MaxFileSize)
+	if err != nil {
+		return nil, err
 	}
 
-	// Load files matching context patterns
-	for _, pattern := range opts.ContextPatterns {
-		matches, err := filepath.Glob(pattern)
-		if err != nil {
+	timeout := time.Duration(p.config.Context.CommandTimeout) * time.Second
+	for _, command := range opts.ContextCommands {
+		// Commands can have side effects; dry runs and estimates only name them
+		if opts.DryRun {
+			p.ui.Info(fmt.Sprintf("Not running context command %q; its output is not counted", command))
+			contextFiles = append(contextFiles, &types.ContextFile{Language: types.LangText, Label: "$ " + command + " (not run)"})
 			continue
 		}
+		output, err := p.contextLoader.LoadCommand(command, timeout, p.config.Context.CommandMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		contextFiles = append(contextFiles, output)
+	}
 
-		for _, match := range matches {
-			content, err := os.ReadFile(match)
-			if err != nil {
-				continue
-			}
-
-			lang := language.DetectLanguage(match)
-			contextFile := &types.ContextFile{
-				Path:     match,
-				Language: lang,
-				Content:  string(content),
-				Label:    filepath.Base(match),
-			}
-			contextFiles = append(contextFiles, contextFile)
+	if opts.ContextRepoMap {
+		repoMap, err := p.buildRepoMap()
+		if err != nil {
+			return nil, err
 		}
+		contextFiles = append(contextFiles, repoMap)
 	}
 
 	return contextFiles, nil
 }
 
-// simulateTransform simulates transform mode for dry runs
-func (p *Processor) simulateTransform(opts *types.ProcessingOptions, files []*types.FileInfo) []*types.ProcessingResult {
+// buildRepoMap outlines the project around the working directory as a
+// context file
+func (p *Processor) buildRepoMap() (*types.ContextFile, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	root := utils.ProjectRoot(wd)
+
+	generator := repomap.New(repomap.Options{
+		ExcludeDirs: p.config.Filters.ExcludeDirs,
+		ExcludeExts: p.config.Filters.ExcludeExts,
+	})
+	content, err := generator.Build(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build repo map: %w", err)
+	}
+
+	return &types.ContextFile{
+		Path:     root,
+		Language: types.LangText,
+		Content:  content,
+		Label:    "Repository map of " + filepath.Base(root),
+		Pinned:   true,
+	}, nil
+}
+
+// simulateFiles simulates per-file processing for dry runs
+func (p *Processor) simulateFiles(opts *types.ProcessingOptions, files []*types.FileInfo) []*types.ProcessingResult {
 	var results []*types.ProcessingResult
 
 	for _, file := range files {
 		outputFile := file.Path
-		switch opts.OutputMode {
-		case types.OutputModeSeparate:
+		switch {
+		case opts.Mode == types.ModeReview:
+			outputFile = "(review)"
+		case opts.Mode == types.ModeClassify:
+			outputFile = "(classify)"
+		case opts.Mode == types.ModeExtract:
+			outputFile = opts.OutputPath
+		case opts.OutputTemplate != "":
+			outputFile = p.generatedPath(file, opts)
+			if utils.FileExists(outputFile) {
+				outputFile += fmt.Sprintf(" (exists: %s)", opts.OnExists)
+			}
+		case opts.OutputMode == types.OutputModeSeparate:
 			outputFile = file.Path + opts.OutputSuffix
-		case types.OutputModeStdout:
+		case opts.OutputMode == types.OutputModeStdout:
 			outputFile = "stdout"
 		}
 
@@ -566,31 +868,38 @@ func (p *Processor) simulateTransform(opts *types.ProcessingOptions, files []*ty
 }
 
 // handleOutput processes the AI response and saves it according to output mode
-func (p *Processor) handleOutput(inputFile, content string, opts *types.ProcessingOptions) (string, error) {
+func (p *Processor) handleOutput(file *types.FileInfo, content string, opts *types.ProcessingOptions) (string, error) {
 	switch opts.OutputMode {
 	case types.OutputModeInPlace:
-		return p.handleInPlaceOutput(inputFile, content, opts)
+		return p.handleInPlaceOutput(file, content, opts)
 	case types.OutputModeDirectory:
-		return p.handleDirectoryOutput(inputFile, content, opts)
+		return p.handleDirectoryOutput(file, content, opts)
 	case types.OutputModeSeparate:
-		return p.handleSeparateOutput(inputFile, content, opts)
+		return p.handleSeparateOutput(file, content, opts)
 	case types.OutputModeFile:
-		return p.handleFileOutput(content, opts)
+		return p.handleFileOutput(file, content, opts)
 	case types.OutputModeStdout:
 		return p.handleStdoutOutput(content)
 	case types.OutputModePreview:
-		return p.handlePreviewOutput(inputFile, content, opts)
+		return p.handlePreviewOutput(file, content, opts)
 	default:
 		return "", fmt.Errorf("unsupported output mode: %s", opts.OutputMode)
 	}
 }
 
 // handleInPlaceOutput modifies the original file (with backup if requested)
-func (p *Processor) handleInPlaceOutput(inputFile, content string, opts *types.ProcessingOptions) (string, error) {
+func (p *Processor) handleInPlaceOutput(file *types.FileInfo, content string, opts *types.ProcessingOptions) (string, error) {
+	inputFile := file.Path
 	if opts.DryRun {
 		return inputFile + " (dry-run)", nil
 	}
 
+	// Make sure nobody else edited the file while we were waiting on the AI
+	content, err := p.resolveConflict(file, content, opts)
+	if err != nil {
+		return "", err
+	}
+
 	// Create backup if requested
 	if opts.BackupOriginal {
 		backupFile := inputFile + ".backup"
@@ -600,15 +909,16 @@ func (p *Processor) handleInPlaceOutput(inputFile, content string, opts *types.P
 	}
 
 	// Write new content to original file
-	if err := os.WriteFile(inputFile, []byte(content), 0644); err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+	if err := p.writeTextFile(inputFile, content, file.Format); err != nil {
+		return "", err
 	}
 
 	return inputFile, nil
 }
 
 // handleDirectoryOutput creates parallel directory structure
-func (p *Processor) handleDirectoryOutput(inputFile, content string, opts *types.ProcessingOptions) (string, error) {
+func (p *Processor) handleDirectoryOutput(file *types.FileInfo, content string, opts *types.ProcessingOptions) (string, error) {
+	inputFile := file.Path
 	if opts.OutputDir == "" {
 		return "", fmt.Errorf("output directory not specified")
 	}
@@ -638,15 +948,16 @@ func (p *Processor) handleDirectoryOutput(inputFile, content string, opts *types
 	}
 
 	// Write content
-	if err := os.WriteFile(outputFile, []byte(content), 0644); err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+	if err := p.writeTextFile(outputFile, content, file.Format); err != nil {
+		return "", err
 	}
 
 	return outputFile, nil
 }
 
 // handleSeparateOutput creates new file with smart suffix
-func (p *Processor) handleSeparateOutput(inputFile, content string, opts *types.ProcessingOptions) (string, error) {
+func (p *Processor) handleSeparateOutput(file *types.FileInfo, content string, opts *types.ProcessingOptions) (string, error) {
+	inputFile := file.Path
 	var outputFile string
 
 	if opts.SmartSuffix {
@@ -662,15 +973,15 @@ func (p *Processor) handleSeparateOutput(inputFile, content string, opts *types.
 	}
 
 	// Write content to new file
-	if err := os.WriteFile(outputFile, []byte(content), 0644); err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+	if err := p.writeTextFile(outputFile, content, file.Format); err != nil {
+		return "", err
 	}
 
 	return outputFile, nil
 }
 
 // handleFileOutput writes to a specific output file
-func (p *Processor) handleFileOutput(content string, opts *types.ProcessingOptions) (string, error) {
+func (p *Processor) handleFileOutput(file *types.FileInfo, content string, opts *types.ProcessingOptions) (string, error) {
 	if opts.OutputPath == "" {
 		return "", fmt.Errorf("output file path not specified")
 	}
@@ -686,8 +997,8 @@ func (p *Processor) handleFileOutput(content string, opts *types.ProcessingOptio
 	}
 
 	// Write content
-	if err := os.WriteFile(opts.OutputPath, []byte(content), 0644); err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+	if err := p.writeTextFile(opts.OutputPath, content, file.Format); err != nil {
+		return "", err
 	}
 
 	return opts.OutputPath, nil
@@ -700,7 +1011,9 @@ func (p *Processor) handleStdoutOutput(content string) (string, error) {
 }
 
 // handlePreviewOutput shows diff and asks for confirmation
-func (p *Processor) handlePreviewOutput(inputFile, newContent string, opts *types.ProcessingOptions) (string, error) {
+func (p *Processor) handlePreviewOutput(file *types.FileInfo, newContent string, opts *types.ProcessingOptions) (string, error) {
+	inputFile := file.Path
+
 	// Read original content
 	originalContent, err := os.ReadFile(inputFile)
 	if err != nil {
@@ -737,16 +1050,18 @@ func (p *Processor) handlePreviewOutput(inputFile, newContent string, opts *type
 	choice := strings.TrimSpace(scanner.Text())
 	switch choice {
 	case "1":
-		return p.handleInPlaceOutput(inputFile, newContent, &types.ProcessingOptions{
-			DryRun: opts.DryRun,
+		return p.handleInPlaceOutput(file, newContent, &types.ProcessingOptions{
+			DryRun:     opts.DryRun,
+			OnConflict: opts.OnConflict,
 		})
 	case "2":
-		return p.handleInPlaceOutput(inputFile, newContent, &types.ProcessingOptions{
+		return p.handleInPlaceOutput(file, newContent, &types.ProcessingOptions{
 			BackupOriginal: true,
 			DryRun:         opts.DryRun,
+			OnConflict:     opts.OnConflict,
 		})
 	case "3":
-		return p.handleSeparateOutput(inputFile, newContent, &types.ProcessingOptions{
+		return p.handleSeparateOutput(file, newContent, &types.ProcessingOptions{
 			OutputSuffix: ".presto",
 			SmartSuffix:  true,
 			DryRun:       opts.DryRun,
@@ -757,7 +1072,7 @@ func (p *Processor) handlePreviewOutput(inputFile, newContent string, opts *type
 			return "", fmt.Errorf("failed to read file path")
 		}
 		customPath := strings.TrimSpace(scanner.Text())
-		return p.handleFileOutput(newContent, &types.ProcessingOptions{
+		return p.handleFileOutput(file, newContent, &types.ProcessingOptions{
 			OutputPath: customPath,
 			DryRun:     opts.DryRun,
 		})
@@ -781,12 +1096,186 @@ func (p *Processor) addSmartSuffix(filename, suffix string) string {
 	return base + suffix + ext
 }
 
-// copyFile creates a copy of the source file
+// resolveConflict checks whether a file changed on disk since it was read and
+// applies the configured conflict strategy. It returns the content to write in
+// place; a result saved elsewhere comes back as an ErrFileChanged error.
+func (p *Processor) resolveConflict(file *types.FileInfo, content string, opts *types.ProcessingOptions) (string, error) {
+	if file.Snapshot == nil {
+		return content, nil
+	}
+
+	current, changed, err := p.readIfChanged(file)
+	if err != nil {
+		return "", err
+	}
+	if !changed {
+		return content, nil
+	}
+
+	switch opts.OnConflict {
+	case types.ConflictSibling:
+		conflictFile := file.Path + ".presto-conflict"
+		if err := p.writeTextFile(conflictFile, content, file.Format); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: result saved to %s", types.ErrFileChanged, conflictFile)
+
+	case types.ConflictMerge:
+		merged := merge.ThreeWay(file.Snapshot.Content, content, current)
+		if merged.Conflicts == 0 {
+			p.ui.Warning(fmt.Sprintf("%s changed during processing; merged concurrent edits", file.Path))
+			return merged.Content, nil
+		}
+
+		conflictFile := file.Path + ".presto-conflict"
+		if err := p.writeTextFile(conflictFile, merged.Content, file.Format); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %d merge conflicts, result with markers saved to %s",
+			types.ErrFileChanged, merged.Conflicts, conflictFile)
+
+	default:
+		return "", fmt.Errorf("%w: left untouched", types.ErrFileChanged)
+	}
+}
+
+// readIfChanged compares a file against its snapshot and returns the decoded
+// current content when it differs
+func (p *Processor) readIfChanged(file *types.FileInfo) (string, bool, error) {
+	stat, err := os.Stat(file.Path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if stat.ModTime().Equal(file.Snapshot.ModTime) {
+		return "", false, nil
+	}
+
+	// The mtime moved; only the content decides whether it really changed
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to re-read file: %w", err)
+	}
+	if hashBytes(data) == file.Snapshot.Hash {
+		return "", false, nil
+	}
+
+	sniffed := textfile.Sniff(data)
+	current, err := textfile.Decode(data, sniffed.Format)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to decode changed file: %w", err)
+	}
+
+	return current, true, nil
+}
+
+// hashBytes returns the hex-encoded SHA-256 of data
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readSourceFile reads and decodes an input file. Binary files are not an
+// error; they are reported through the returned skip reason instead.
+func (p *Processor) readSourceFile(file *types.FileInfo) (string, string, error) {
+	// The budget estimate reads each file before it is dispatched; reuse
+	// that read while the file is unchanged
+	if file.Snapshot != nil {
+		if stat, err := os.Stat(file.Path); err == nil && stat.ModTime().Equal(file.Snapshot.ModTime) {
+			return p.checkSource(file, file.Snapshot.Content)
+		}
+	}
+
+	// Stat before reading: an edit in between then leaves an mtime older
+	// than the content, which only costs a reread, never a stale snapshot
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read file: %w", err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read file: %w", err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	info := textfile.Sniff(data)
+	if info.Binary {
+		return "", "binary file", nil
+	}
+
+	content, err := textfile.Decode(data, info.Format)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode file: %w", err)
+	}
+
+	file.Format = info.Format
+	textfile.DetectFormat(content, &file.Format)
+	file.Format.Mode = stat.Mode().Perm()
+	file.Snapshot = &types.FileSnapshot{
+		Hash:    hashBytes(data),
+		ModTime: stat.ModTime(),
+		Content: content,
+	}
+
+	if file.Language == types.LangUnknown {
+		file.Language = types.LangText
+	}
+
+	return p.checkSource(file, content)
+}
+
+// checkSource returns a skip reason for content that must not be sent
+func (p *Processor) checkSource(file *types.FileInfo, content string) (string, string, error) {
+	if p.redactor != nil && p.config.Redaction.SkipFilesWithSecrets {
+		if secrets := p.redactor.Secrets(content, file.Path); len(secrets) > 0 {
+			return "", fmt.Sprintf("contains secrets (%s)", strings.Join(secrets, ", ")), nil
+		}
+	}
+
+	return content, "", nil
+}
+
+// writeTextFile encodes content back to the source file's format and writes it
+func (p *Processor) writeTextFile(path, content string, format types.FileFormat) error {
+	data, err := textfile.Encode(content, format)
+	if err != nil {
+		return fmt.Errorf("failed to encode output as %s: %w", format.Encoding, err)
+	}
+
+	mode := format.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	// WriteFile only applies the mode to newly created files
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+
+	return nil
+}
+
+// copyFile creates a copy of the source file, keeping its permission bits
 func (p *Processor) copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
 	sourceContent, err := os.ReadFile(src)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(dst, sourceContent, 0644)
+	if err := os.WriteFile(dst, sourceContent, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chmod(dst, info.Mode().Perm())
 }
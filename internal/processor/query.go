@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// fileQuery describes a per-file request answered with a JSON object instead
+// of new file content: review, extract and classify. The file is never
+// written; the answer is stored on the result.
+type fileQuery struct {
+	mode    types.ProcessingMode
+	prompt  func(opts *types.ProcessingOptions) (string, error)
+	label   string                      // Label of the pinned input, before its path
+	input   func(content string) string // What is sent of the file; nil sends it as is
+	schema  []byte                      // Response schema, for providers that enforce one
+	retries int                         // Times a rejected response is sent back with the error
+	invalid string                      // Error prefix once the last response is rejected
+	parse   func(response, input string, result *types.ProcessingResult) error
+	summary func(result *types.ProcessingResult) string
+	output  int                                           // Assumed response size, capped by the request's max tokens
+	write   func(results []*types.ProcessingResult) error // Writes the run's answers once every file is done; nil when the caller reports them
+}
+
+// runQuery describes the per-file request of a review, extract or classify
+// run, loading what it needs once for the whole run. Other modes have none.
+func (p *Processor) runQuery(opts *types.ProcessingOptions) (*fileQuery, error) {
+	var q fileQuery
+	var err error
+	switch opts.Mode {
+	case types.ModeReview:
+		q = p.reviewQuery()
+	case types.ModeExtract:
+		q, err = p.extractQuery(opts)
+	case types.ModeClassify:
+		q, err = p.classifyQuery(opts)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// queryFile reads one file, sends it with q's prompt and stores the parsed
+// answer. A response that fails to parse is sent back with the error.
+func (p *Processor) queryFile(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, q fileQuery) *types.ProcessingResult {
+	startTime := time.Now()
+
+	result := &types.ProcessingResult{
+		InputFile: file.Path,
+		Mode:      q.mode,
+	}
+
+	p.ui.FileProcessing(filepath.Base(file.Path))
+
+	content, skipReason, err := p.readSourceFile(file)
+	if err == nil && skipReason == "" {
+		err = p.queryContent(file, content, opts, contextFiles, q, result)
+	}
+
+	result.Duration = time.Since(startTime)
+	switch {
+	case err != nil:
+		result.Error = err
+		p.ui.FileError(file.Path, err)
+	case skipReason != "":
+		result.Skipped = true
+		result.SkipReason = skipReason
+		p.ui.FileSkipped(file.Path, skipReason)
+	default:
+		result.Success = true
+		p.ui.FileSuccess(file.Path, q.summary(result), result.Duration, result.AITokensUsed)
+	}
+	return result
+}
+
+// queryContent sends the request for one file and parses the answer
+func (p *Processor) queryContent(file *types.FileInfo, content string, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, q fileQuery, result *types.ProcessingResult) error {
+	prompt, input, fixedTokens, err := p.queryRequest(content, opts, q)
+	if err != nil {
+		return err
+	}
+	candidates := p.candidateContext(file, content, opts, contextFiles)
+	packed, usage := p.packContext(context.Target{Path: file.Path, Content: content}, fixedTokens, opts, candidates)
+	result.Context = usage
+	p.ui.FileContext(file.Path, usage)
+
+	sources := append([]*types.ContextFile{{
+		Path:     file.Path,
+		Language: file.Language,
+		Content:  input,
+		Label:    q.label + ": " + file.Path,
+		Pinned:   true,
+	}}, packed...)
+
+	req := types.AIRequest{
+		Model:          opts.Model,
+		Prompt:         prompt,
+		FileName:       file.Path,
+		Language:       file.Language,
+		MaxTokens:      opts.MaxTokens,
+		Temperature:    opts.Temperature,
+		Mode:           q.mode,
+		ResponseSchema: q.schema,
+	}
+
+	for attempt := 0; ; attempt++ {
+		aiResp, err := p.aiClient.ProcessContent(req, sources)
+		if err != nil {
+			return fmt.Errorf("AI processing failed: %w", err)
+		}
+		p.recordUsage(result, aiResp)
+		if aiResp.Truncated {
+			return fmt.Errorf("response was cut off (%s); raise --max-tokens", aiResp.FinishReason)
+		}
+
+		err = q.parse(aiResp.Content, input, result)
+		if err == nil {
+			return nil
+		}
+		if attempt == q.retries {
+			return fmt.Errorf("%s: %w", q.invalid, err)
+		}
+		req.Prompt = prompt + fmt.Sprintf("\n\nYour previous response was rejected: %v\nRespond again with only the JSON object.", err)
+	}
+}
+
+// queryRequest builds the prompt and the input text of a query, and counts
+// the tokens they take
+func (p *Processor) queryRequest(content string, opts *types.ProcessingOptions, q fileQuery) (string, string, int, error) {
+	prompt, err := q.prompt(opts)
+	if err != nil {
+		return "", "", 0, err
+	}
+	input := content
+	if q.input != nil {
+		input = q.input(content)
+	}
+	return prompt, input, tokens.CountAll(p.config.AI.Provider, prompt, input) + promptOverheadTokens, nil
+}
+
+// estimateQuery projects input and output tokens for querying one file
+func (p *Processor) estimateQuery(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, q fileQuery) (int, int, bool) {
+	content, skipReason, err := p.readSourceFile(file)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	_, _, fixedTokens, err := p.queryRequest(content, opts, q)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	candidates := p.candidateContext(file, content, opts, contextFiles)
+	_, usage := p.packContext(context.Target{Path: file.Path, Content: content}, fixedTokens, opts, candidates)
+
+	return fixedTokens + contextTokens(usage), capTokens(q.output, opts.MaxTokens), true
+}
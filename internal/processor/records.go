@@ -0,0 +1,366 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/records"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// recordOutputTokens is the assumed result size of one record, capped per
+// request by the request's max tokens
+const recordOutputTokens = 64
+
+// recordBatch is one request's worth of pending records
+type recordBatch struct {
+	records []*records.Record
+	inputs  []json.RawMessage
+	keys    []string
+}
+
+// recordRun is one input file of a records run
+type recordRun struct {
+	file       *records.File
+	outputPath string
+	journal    *records.Journal
+	prompt     string
+	batches    []recordBatch
+	done       int // Records answered by an earlier run
+}
+
+// processRecords runs the prompt over the records of each input file in
+// batches and writes every file back with the results in a new field
+func (p *Processor) processRecords(opts *types.ProcessingOptions, files []*types.FileInfo, contextFiles []*types.ContextFile) ([]*types.ProcessingResult, error) {
+	if opts.OutputPath != "" && len(files) > 1 {
+		return nil, fmt.Errorf("--output-file takes a single input file; %d files found", len(files))
+	}
+
+	limits := p.newBudget(opts)
+	var results []*types.ProcessingResult
+	for _, file := range files {
+		results = append(results, p.recordsFile(file, opts, contextFiles, limits))
+	}
+	return results, nil
+}
+
+// recordsFile processes the records of one file. Results are saved to a
+// progress journal as they arrive, so a failed or interrupted run resumes
+// with the records still missing.
+func (p *Processor) recordsFile(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, limits *budget) *types.ProcessingResult {
+	startTime := time.Now()
+	result := &types.ProcessingResult{
+		InputFile: file.Path,
+		Mode:      types.ModeRecords,
+	}
+	fail := func(err error) *types.ProcessingResult {
+		result.Error = err
+		result.OverBudget = errors.Is(err, types.ErrBudgetExceeded)
+		result.Duration = time.Since(startTime)
+		p.ui.FileError(file.Path, err)
+		return result
+	}
+
+	run, skipReason, err := p.recordRun(file, opts)
+	if err != nil {
+		return fail(err)
+	}
+	if skipReason != "" {
+		result.Skipped = true
+		result.SkipReason = skipReason
+		p.ui.FileSkipped(file.Path, skipReason)
+		return result
+	}
+	result.OutputFile = run.outputPath
+
+	pending := 0
+	for _, batch := range run.batches {
+		pending += len(batch.records)
+	}
+	if opts.DryRun {
+		fmt.Printf("Would process %d of %d records of %s in %d requests (%d already done) into %s\n",
+			pending, len(run.file.Records), file.Path, len(run.batches), run.done, run.outputPath)
+		result.Success = true
+		return result
+	}
+
+	// The file counts against --max-files once; each batch reserves its tokens
+	if limits != nil && len(run.batches) > 0 && !limits.reserve(0, 0) {
+		skipped := budgetSkipped(file.Path, opts.Mode, limits.stopReason())
+		skipped.OutputFile = run.outputPath
+		p.ui.FileSkipped(file.Path, skipped.SkipReason)
+		return skipped
+	}
+
+	p.ui.FileProcessing(filepath.Base(file.Path))
+	failed, firstErr := p.runRecordBatches(run, opts, contextFiles, limits, result)
+
+	// The output keeps the input's encoding and byte order mark
+	data, err := run.file.Write()
+	if err == nil {
+		err = p.writeTextFile(run.outputPath, string(data), file.Format)
+	}
+	if closeErr := run.journal.Close(err == nil && failed == 0); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to write output file: %w", err))
+	}
+	result.BytesChanged = len(data)
+
+	if failed > 0 {
+		return fail(fmt.Errorf("%d of %d records failed (%w); rerun to resume", failed, len(run.file.Records), firstErr))
+	}
+	result.Success = true
+	result.Duration = time.Since(startTime)
+	p.ui.FileSuccess(file.Path, fmt.Sprintf("%s (%d records)", run.outputPath, len(run.file.Records)), result.Duration, result.AITokensUsed)
+	return result
+}
+
+// recordRun reads one file's records, fills in results saved by earlier
+// runs and batches the rest. Files readSourceFile would skip are skipped.
+func (p *Processor) recordRun(file *types.FileInfo, opts *types.ProcessingOptions) (*recordRun, string, error) {
+	format, err := records.Detect(file.Path, opts.RecordFormat)
+	if err != nil {
+		return nil, "", err
+	}
+	content, skipReason, err := p.readSourceFile(file)
+	if err != nil || skipReason != "" {
+		return nil, skipReason, err
+	}
+	f, err := records.Parse(content, format)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", file.Path, err)
+	}
+	if len(opts.RecordFields) > 0 && format != records.FormatLog {
+		known := f.Fields()
+		for _, field := range opts.RecordFields {
+			if !slices.Contains(known, field) {
+				return nil, "", fmt.Errorf("no field %q in %s (fields: %s)", field, file.Path, strings.Join(known, ", "))
+			}
+		}
+	}
+	f.Output(opts.OutputField)
+
+	prompt, err := p.recordsPrompt(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	outputPath := p.recordsOutputPath(file, format, opts)
+	journal, err := records.OpenJournal(records.JournalPath(outputPath))
+	if err != nil {
+		return nil, "", err
+	}
+
+	run := &recordRun{file: f, outputPath: outputPath, journal: journal, prompt: prompt}
+	batchSize := max(opts.BatchSize, 1)
+	var batch recordBatch
+	for _, r := range f.Records {
+		input := f.Input(r, opts.RecordFields)
+		key := p.taskKey(opts, "record", prompt, opts.OutputField, string(input))
+		if value, ok := journal.Get(key); ok {
+			f.Set(r, value)
+			run.done++
+			continue
+		}
+		batch.records = append(batch.records, r)
+		batch.inputs = append(batch.inputs, input)
+		batch.keys = append(batch.keys, key)
+		if len(batch.records) == batchSize {
+			run.batches = append(run.batches, batch)
+			batch = recordBatch{}
+		}
+	}
+	if len(batch.records) > 0 {
+		run.batches = append(run.batches, batch)
+	}
+	return run, "", nil
+}
+
+// runRecordBatches sends the batches of one file with the worker pool. It
+// returns how many records were left without a result, and why.
+func (p *Processor) runRecordBatches(run *recordRun, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, limits *budget, result *types.ProcessingResult) (int, error) {
+	jobs := make(chan int)
+	var mu sync.Mutex
+	failed, completed := 0, 0
+	var firstErr error
+
+	p.ui.StartSpinner(fmt.Sprintf("Records 0/%d batches...", len(run.batches)))
+	defer p.ui.StopSpinner()
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(opts.MaxConcurrent, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				batch := run.batches[index]
+				batchResult := &types.ProcessingResult{}
+				values, err := p.recordBatchValues(run, batch, opts, contextFiles, limits, batchResult)
+
+				mu.Lock()
+				result.AITokensUsed += batchResult.AITokensUsed
+				result.InputTokens += batchResult.InputTokens
+				result.OutputTokens += batchResult.OutputTokens
+				result.CachedTokens += batchResult.CachedTokens
+				result.Redactions += batchResult.Redactions
+				result.Cost += batchResult.Cost
+				if err == nil {
+					saved := make(map[string]string, len(values))
+					for i, value := range values {
+						run.file.Set(batch.records[i], value)
+						saved[batch.keys[i]] = value
+					}
+					err = run.journal.Append(saved)
+				}
+				if err != nil {
+					failed += len(batch.records)
+					if firstErr == nil {
+						firstErr = err
+					}
+				}
+				completed++
+				p.ui.UpdateSpinner(fmt.Sprintf("Records %d/%d batches...", completed, len(run.batches)))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range run.batches {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return failed, firstErr
+}
+
+// recordBatchValues gets the results of one batch, retrying once when the
+// response doesn't answer every record
+func (p *Processor) recordBatchValues(run *recordRun, batch recordBatch, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, limits *budget, result *types.ProcessingResult) ([]string, error) {
+	content := records.Batch(batch.inputs)
+	fixedTokens := tokens.CountAll(p.config.AI.Provider, run.prompt, content) + promptOverheadTokens
+	packed, usage := p.packContext(context.Target{Content: content}, fixedTokens, opts, contextFiles)
+
+	output := capTokens(recordOutputTokens*len(batch.records), opts.MaxTokens)
+	input := fixedTokens + contextTokens(usage)
+	if limits != nil {
+		if !limits.reserveTokens(input, output) {
+			return nil, fmt.Errorf("%w: %s", types.ErrBudgetExceeded, limits.stopReason())
+		}
+		defer limits.settle(input, output, result)
+	}
+
+	sources := append([]*types.ContextFile{{
+		Language: types.LangText,
+		Content:  content,
+		Label:    "Records",
+		Pinned:   true,
+	}}, packed...)
+
+	req := types.AIRequest{
+		Model:       opts.Model,
+		Prompt:      run.prompt,
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		Mode:        types.ModeRecords,
+		PerItem:     true,
+	}
+
+	for attempt := 0; ; attempt++ {
+		aiResp, err := p.aiClient.ProcessContent(req, sources)
+		if err != nil {
+			return nil, fmt.Errorf("AI processing failed: %w", err)
+		}
+		p.recordUsage(result, aiResp)
+		if aiResp.Truncated {
+			return nil, fmt.Errorf("response was cut off (%s); lower --batch or raise --max-tokens", aiResp.FinishReason)
+		}
+
+		values, err := records.ParseResults(aiResp.Content, len(batch.records))
+		if err == nil {
+			return values, nil
+		}
+		if attempt > 0 {
+			return nil, fmt.Errorf("invalid records response: %w", err)
+		}
+		req.Prompt = run.prompt + fmt.Sprintf("\n\nYour previous response was rejected: %v\nRespond again with only the JSON object.", err)
+	}
+}
+
+// recordsPrompt builds the prompt of a batch request. As in review, the
+// system prompt is only sent when overridden.
+func (p *Processor) recordsPrompt(opts *types.ProcessingOptions) (string, error) {
+	prompt := opts.AIPrompt
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", fmt.Errorf("failed to get system prompt: %w", err)
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+	return prompt + "\n\n" + records.Instructions(), nil
+}
+
+// recordsOutputPath is --output-file, or else the input with the output
+// suffix before its extension: tickets.csv becomes tickets.presto.csv
+func (p *Processor) recordsOutputPath(file *types.FileInfo, format string, opts *types.ProcessingOptions) string {
+	if opts.OutputPath != "" {
+		return opts.OutputPath
+	}
+	stem := strings.TrimSuffix(file.Path, filepath.Ext(file.Path))
+	return stem + opts.OutputSuffix + records.OutputExt(format, file.Path)
+}
+
+// withoutRecordOutputs drops the outputs and progress journals records runs
+// write next to their inputs, so a rerun over the same directory doesn't
+// send its own results back as new records
+func (p *Processor) withoutRecordOutputs(files []*types.FileInfo, opts *types.ProcessingOptions) []*types.FileInfo {
+	outputs := make(map[string]string) // Output or journal path -> its input
+	for _, file := range files {
+		format, err := records.Detect(file.Path, opts.RecordFormat)
+		if err != nil {
+			return files
+		}
+		output := absPath(p.recordsOutputPath(file, format, opts))
+		outputs[output] = absPath(file.Path)
+		outputs[records.JournalPath(output)] = absPath(file.Path)
+	}
+
+	var kept []*types.FileInfo
+	for _, file := range files {
+		path := absPath(file.Path)
+		if input, ok := outputs[path]; ok && input != path {
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
+
+// estimateRecords projects input and output tokens for the records of one
+// file still missing a result
+func (p *Processor) estimateRecords(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) (int, int, bool) {
+	run, skipReason, err := p.recordRun(file, opts)
+	if err != nil || skipReason != "" || len(run.batches) == 0 {
+		return 0, 0, false
+	}
+
+	input, output := 0, 0
+	for _, batch := range run.batches {
+		content := records.Batch(batch.inputs)
+		fixedTokens := tokens.CountAll(p.config.AI.Provider, run.prompt, content) + promptOverheadTokens
+		_, usage := p.packContext(context.Target{Content: content}, fixedTokens, opts, contextFiles)
+		input += fixedTokens + contextTokens(usage)
+		output += capTokens(recordOutputTokens*len(batch.records), opts.MaxTokens)
+	}
+	return input, output, true
+}
@@ -0,0 +1,36 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func TestWithoutRecordOutputs(t *testing.T) {
+	files := []*types.FileInfo{
+		{Path: "data/tickets.csv"},
+		{Path: "data/tickets.presto.csv"},
+		{Path: "data/tickets.presto.csv.progress"},
+		{Path: "data/app.log"},
+		{Path: "data/app.presto.jsonl.progress"},
+		{Path: "data/other.presto.csv"},
+	}
+	p := &Processor{}
+	kept := p.withoutRecordOutputs(files, &types.ProcessingOptions{OutputSuffix: ".presto"})
+
+	want := []string{"data/tickets.csv", "data/app.log", "data/other.presto.csv"}
+	if len(kept) != len(want) {
+		t.Fatalf("got %d files, want %v", len(kept), want)
+	}
+	for i, path := range want {
+		if kept[i].Path != path {
+			t.Errorf("file %d: got %s, want %s", i, kept[i].Path, path)
+		}
+	}
+
+	// Without a suffix records are written in place; the input stays
+	kept = p.withoutRecordOutputs(files[:1], &types.ProcessingOptions{})
+	if len(kept) != 1 {
+		t.Errorf("in-place run dropped its input")
+	}
+}
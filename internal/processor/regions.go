@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/region"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// regionMarker stands in for the region being transformed in the copy of
+// the file sent as context
+const regionMarker = ">>> %s, the content being transformed, goes here <<<"
+
+// processRegions transforms only the symbols and line ranges of a file
+// given with --symbol and --lines, one request each. The rest of the file
+// is sent as read-only context, and each result is spliced back in place.
+func (p *Processor) processRegions(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) *types.ProcessingResult {
+	return p.rewriteFile(file, opts, func(content string, result *types.ProcessingResult) (string, string, error) {
+		regions, skipReason, err := selectRegions(file, content, opts)
+		if err != nil || skipReason != "" {
+			return "", skipReason, err
+		}
+		output, err := p.transformRegions(file, content, regions, opts, contextFiles, result)
+		return output, "", err
+	})
+}
+
+// selectRegions finds the parts of a file --symbol and --lines select. A
+// file with none of the symbols is skipped; a file with only some of them
+// is an error, as its result would be incomplete.
+func selectRegions(file *types.FileInfo, content string, opts *types.ProcessingOptions) ([]*region.Region, string, error) {
+	var regions []*region.Region
+	if len(opts.Symbols) > 0 {
+		if file.Language != types.LangGo {
+			return nil, "--symbol only supports Go files; use --lines", nil
+		}
+		symbols, missing, err := region.GoSymbols(content, opts.Symbols)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(symbols) == 0 {
+			return nil, "no symbol matches --symbol", nil
+		}
+		if len(missing) > 0 {
+			return nil, "", fmt.Errorf("symbols not found: %s", strings.Join(missing, ", "))
+		}
+		regions = append(regions, symbols...)
+	}
+	for _, spec := range opts.LineRanges {
+		lines, err := region.ParseLines(spec)
+		if err != nil {
+			return nil, "", err
+		}
+		r, err := region.Lines(content, lines)
+		if err != nil {
+			return nil, "", err
+		}
+		regions = append(regions, r)
+	}
+
+	regions, err := region.Sort(regions)
+	if err != nil {
+		return nil, "", err
+	}
+	return regions, "", nil
+}
+
+// transformRegions sends each region as the content to transform, with the
+// rest of the file around it, and returns the file with the results in place
+func (p *Processor) transformRegions(file *types.FileInfo, content string, regions []*region.Region, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, result *types.ProcessingResult) (string, error) {
+	systemPrompt, err := p.getSystemPrompt(opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to get system prompt: %w", err)
+	}
+
+	texts := make([]string, len(regions))
+	for i, r := range regions {
+		prompt, rest := regionRequest(file, content, r, systemPrompt, opts)
+		text := r.Text(content)
+
+		fixedTokens := p.transformFixedTokens(file, prompt, text) + tokens.Count(rest, p.config.AI.Provider)
+		candidates := p.candidateContext(file, content, opts, contextFiles)
+		packed, usage := p.packContext(context.Target{Path: file.Path, Content: text}, fixedTokens, opts, candidates)
+		result.Context = mergeUsage(result.Context, usage)
+		p.ui.FileContext(file.Path, usage)
+
+		sources := append([]*types.ContextFile{{
+			Path:     file.Path,
+			Language: file.Language,
+			Content:  rest,
+			Label:    "Rest of " + file.Path + " (read-only)",
+			Pinned:   true,
+		}}, packed...)
+
+		aiResp, err := p.processWithContinuationAndUI(file, prompt, text, opts, sources)
+		if err != nil {
+			return "", fmt.Errorf("%s: AI processing failed: %w", r, err)
+		}
+		p.recordUsage(result, aiResp)
+
+		texts[i] = regionOutput(text, aiResp.Content, file.Format.LineEnding)
+	}
+
+	output := region.Replace(content, regions, texts)
+	if file.Language == types.LangGo && region.CheckGo(content) == nil {
+		if err := region.CheckGo(output); err != nil {
+			return "", err
+		}
+	}
+	return output, nil
+}
+
+// regionOutput fits a response to the region it replaces. Responses come
+// back trimmed: keep the region's leading blank lines and indentation, end
+// it without its last newline, and match the file's line endings.
+func regionOutput(text, response, lineEnding string) string {
+	output := strings.TrimSpace(strings.ReplaceAll(response, "\r\n", "\n"))
+	if lineEnding == "\r\n" {
+		output = strings.ReplaceAll(output, "\n", "\r\n")
+	}
+	return text[:len(text)-len(strings.TrimLeft(text, " \t\r\n"))] + output
+}
+
+// regionRequest builds the prompt for one region and the rest of the file
+// it is sent with
+func regionRequest(file *types.FileInfo, content string, r *region.Region, systemPrompt string, opts *types.ProcessingOptions) (string, string) {
+	prompt := systemPrompt + "\n\n" + opts.AIPrompt + "\n\n" + fmt.Sprintf(
+		"The content is only %s of %s. The rest of the file is given as read-only context, with a marker where the content goes. Return only the new version of the content, not the rest of the file.",
+		r, file.Path)
+	rest := r.Surroundings(content, fmt.Sprintf(regionMarker, r))
+	return prompt, rest
+}
+
+// estimateRegions projects input and output tokens for transforming the
+// selected regions of one file
+func (p *Processor) estimateRegions(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) (int, int, bool) {
+	content, skipReason, err := p.readSourceFile(file)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	regions, skipReason, err := selectRegions(file, content, opts)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	systemPrompt, err := p.getSystemPrompt(opts)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	input, output := 0, 0
+	for _, r := range regions {
+		prompt, rest := regionRequest(file, content, r, systemPrompt, opts)
+		text := r.Text(content)
+		fixedTokens := p.transformFixedTokens(file, prompt, text) + tokens.Count(rest, p.config.AI.Provider)
+		candidates := p.candidateContext(file, content, opts, contextFiles)
+		_, usage := p.packContext(context.Target{Path: file.Path, Content: text}, fixedTokens, opts, candidates)
+		input += fixedTokens + contextTokens(usage)
+		output += int(float64(tokens.Count(text, p.config.AI.Provider)) * transformOutputRatio)
+	}
+	return input, output, true
+}
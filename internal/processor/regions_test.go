@@ -0,0 +1,24 @@
+package processor
+
+import "testing"
+
+func TestRegionOutput(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		response   string
+		lineEnding string
+		want       string
+	}{
+		{"plain", "func A() {}", "func A() { a() }\n", "\n", "func A() { a() }"},
+		{"leading indentation kept", "\t\treturn x", "return y", "\n", "\t\treturn y"},
+		{"leading blank lines kept", "\n\tx := 1", "\n\nx := 2\n\n", "\n", "\n\tx := 2"},
+		{"CRLF file", "\tif a {\r\n\t\tb()\r\n\t}", "if a {\n\t\tc()\n\t}\n", "\r\n", "\tif a {\r\n\t\tc()\r\n\t}"},
+		{"CRLF response in LF file", "x", "y\r\nz\r\n", "\n", "y\nz"},
+	}
+	for _, tt := range tests {
+		if got := regionOutput(tt.text, tt.response, tt.lineEnding); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/review"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// reviewOutputTokens is the assumed response size of one review request,
+// capped by the request's max tokens
+const reviewOutputTokens = 1024
+
+// reviewQuery describes the request and answer of a review. The file is
+// sent with line numbers; a response that doesn't match the findings schema
+// is retried once with the validation error.
+func (p *Processor) reviewQuery() fileQuery {
+	return fileQuery{
+		mode:    types.ModeReview,
+		prompt:  p.reviewPrompt,
+		label:   "Under review",
+		input:   context.NumberLines,
+		retries: 1,
+		invalid: "invalid review response",
+		parse: func(response, input string, result *types.ProcessingResult) error {
+			findings, err := review.Parse(response, result.InputFile, strings.Count(input, "\n"))
+			result.Findings = findings
+			return err
+		},
+		summary: func(result *types.ProcessingResult) string {
+			return fmt.Sprintf("%d findings", len(result.Findings))
+		},
+		output: reviewOutputTokens,
+	}
+}
+
+// reviewPrompt builds the prompt of a review request. The system prompt is
+// only sent when overridden, since the default one asks for file content.
+func (p *Processor) reviewPrompt(opts *types.ProcessingOptions) (string, error) {
+	prompt := opts.AIPrompt
+	if prompt == "" {
+		prompt = review.DefaultPrompt
+	}
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", fmt.Errorf("failed to get system prompt: %w", err)
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+	return prompt + "\n\n" + review.Instructions(), nil
+}
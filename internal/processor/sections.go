@@ -0,0 +1,162 @@
+package processor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/markdown"
+	"github.com/Zachacious/presto/internal/region"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// sectionNote tells the model it is rewriting part of a document
+const sectionNote = "The content is one section of a longer Markdown document, from its heading up to the next heading of the same level. Return only that section, starting with its heading line."
+
+// processSections transforms the sections of a Markdown file whose heading
+// matches --section, one request each, and splices the results back in.
+// Front matter, code blocks and the other sections are kept byte for byte.
+func (p *Processor) processSections(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) *types.ProcessingResult {
+	return p.rewriteFile(file, opts, func(content string, result *types.ProcessingResult) (string, string, error) {
+		sections, skipReason, err := selectSections(file, content, opts)
+		if err != nil || skipReason != "" {
+			return "", skipReason, err
+		}
+		output, err := p.transformSections(file, content, sections, opts, contextFiles, result)
+		return output, "", err
+	})
+}
+
+// selectSections finds the sections of a file that --section selects.
+// Files that aren't Markdown, or have no matching heading, are skipped.
+func selectSections(file *types.FileInfo, content string, opts *types.ProcessingOptions) ([]*markdown.Section, string, error) {
+	if file.Language != types.LangMarkdown {
+		return nil, "--section only applies to Markdown files", nil
+	}
+	patterns, err := parseSectionPatterns(opts.Sections)
+	if err != nil {
+		return nil, "", err
+	}
+	sections := markdown.Sections(content, patterns)
+	if len(sections) == 0 {
+		return nil, "no heading matches --section", nil
+	}
+	return sections, "", nil
+}
+
+// transformSections sends each section on its own, with code blocks masked,
+// and returns the document with the rewritten sections in place
+func (p *Processor) transformSections(file *types.FileInfo, content string, sections []*markdown.Section, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, result *types.ProcessingResult) (string, error) {
+	systemPrompt, err := p.getSystemPrompt(opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to get system prompt: %w", err)
+	}
+	prompt := systemPrompt + "\n\n" + opts.AIPrompt + "\n\n" + sectionNote
+
+	masked := make([]string, len(sections))
+	blocks := make([][]string, len(sections))
+	largest := ""
+	for i, s := range sections {
+		masked[i], blocks[i] = s.Masked(content)
+		if len(masked[i]) > len(largest) {
+			largest = masked[i]
+		}
+	}
+
+	// One set of context serves every section, ranked against all of them
+	fixedTokens := p.transformFixedTokens(file, prompt, largest)
+	candidates := p.candidateContext(file, content, opts, contextFiles)
+	packed, usage := p.packContext(context.Target{Path: file.Path, Content: strings.Join(masked, "\n\n")}, fixedTokens, opts, candidates)
+	result.Context = usage
+	p.ui.FileContext(file.Path, usage)
+
+	texts := make([]string, len(sections))
+	for i, s := range sections {
+		sectionPrompt := prompt
+		if len(blocks[i]) > 0 {
+			sectionPrompt += " " + markdown.PlaceholderNote()
+		}
+		text, err := p.transformSection(file, sectionPrompt, masked[i], blocks[i], opts, packed, result)
+		if err != nil {
+			return "", fmt.Errorf("section %q: %w", s.Heading, err)
+		}
+		texts[i] = text
+	}
+	return region.Replace(content, sections, texts), nil
+}
+
+// transformSection rewrites one masked section and puts its code blocks
+// back, retrying once when the response lost or repeated one
+func (p *Processor) transformSection(file *types.FileInfo, prompt, masked string, blocks []string, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, result *types.ProcessingResult) (string, error) {
+	currentPrompt := prompt
+	for attempt := 0; ; attempt++ {
+		aiResp, err := p.processWithContinuationAndUI(file, currentPrompt, masked, opts, contextFiles)
+		if err != nil {
+			return "", fmt.Errorf("AI processing failed: %w", err)
+		}
+		p.recordUsage(result, aiResp)
+
+		// Match the file's line endings before the original code goes back in
+		text := strings.TrimSpace(strings.ReplaceAll(aiResp.Content, "\r\n", "\n"))
+		if file.Format.LineEnding == "\r\n" {
+			text = strings.ReplaceAll(text, "\n", "\r\n")
+		}
+		text, err = markdown.Unmask(text, blocks)
+		if err == nil {
+			return text, nil
+		}
+		if attempt > 0 {
+			return "", err
+		}
+		currentPrompt = prompt + fmt.Sprintf("\n\nYour previous response was rejected: %v\nRespond again with the whole section.", err)
+	}
+}
+
+// estimateSections projects input and output tokens for transforming the
+// selected sections of one file
+func (p *Processor) estimateSections(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) (int, int, bool) {
+	content, skipReason, err := p.readSourceFile(file)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	sections, skipReason, err := selectSections(file, content, opts)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	systemPrompt, err := p.getSystemPrompt(opts)
+	if err != nil {
+		return 0, 0, false
+	}
+	prompt := systemPrompt + "\n\n" + opts.AIPrompt + "\n\n" + sectionNote
+
+	input, output := 0, 0
+	var masked []string
+	largest := 0
+	for _, s := range sections {
+		text, _ := s.Masked(content)
+		masked = append(masked, text)
+		fixedTokens := p.transformFixedTokens(file, prompt, text)
+		input += fixedTokens
+		largest = max(largest, fixedTokens)
+		output += int(float64(tokens.Count(text, p.config.AI.Provider)) * transformOutputRatio)
+	}
+
+	candidates := p.candidateContext(file, content, opts, contextFiles)
+	_, usage := p.packContext(context.Target{Path: file.Path, Content: strings.Join(masked, "\n\n")}, largest, opts, candidates)
+	return input + contextTokens(usage)*len(sections), output, true
+}
+
+// parseSectionPatterns compiles --section regexes
+func parseSectionPatterns(exprs []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --section %q: %w", expr, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
@@ -0,0 +1,209 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/Zachacious/presto/internal/context"
+	"github.com/Zachacious/presto/internal/records"
+	"github.com/Zachacious/presto/internal/structured"
+	"github.com/Zachacious/presto/internal/textfile"
+	"github.com/Zachacious/presto/internal/tokens"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// selectedOutputTokens is the assumed size of one rewritten value, capped
+// by the request's max tokens
+const selectedOutputTokens = 128
+
+// processSelected transforms only the string values of a JSON or YAML file
+// that the selectors match. The model sees each value with its path and the
+// document for reference, and answers per value; the values are written
+// back into the parsed document so keys, order and comments stay as they were.
+func (p *Processor) processSelected(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) *types.ProcessingResult {
+	return p.rewriteFile(file, opts, func(content string, result *types.ProcessingResult) (string, string, error) {
+		doc, skipReason, err := p.selectValues(file, content, opts)
+		if err != nil || skipReason != "" {
+			return "", skipReason, err
+		}
+		output, err := p.transformSelected(file, content, doc, opts, contextFiles, result)
+		return output, "", err
+	})
+}
+
+// rewriteFile runs a transform that rewrites only part of a file. rewrite
+// gets the file's content and returns the new content or a reason to skip
+// the file; the output is written and reported as processFile does.
+func (p *Processor) rewriteFile(file *types.FileInfo, opts *types.ProcessingOptions, rewrite func(content string, result *types.ProcessingResult) (string, string, error)) *types.ProcessingResult {
+	startTime := time.Now()
+
+	result := &types.ProcessingResult{
+		InputFile: file.Path,
+		Mode:      opts.Mode,
+	}
+
+	p.ui.FileProcessing(filepath.Base(file.Path))
+
+	content, skipReason, err := p.readSourceFile(file)
+	var output string
+	if err == nil && skipReason == "" {
+		output, skipReason, err = rewrite(content, result)
+	}
+	if err == nil && skipReason == "" {
+		var outputFile string
+		output, result.Normalizations = textfile.Restore(output, file.Format)
+		outputFile, err = p.handleOutput(file, output, opts)
+		if err != nil {
+			err = fmt.Errorf("failed to write output: %w", err)
+			result.Conflict = errors.Is(err, types.ErrFileChanged)
+		}
+		result.OutputFile = outputFile
+		result.BytesChanged = len(output) - len(content)
+	}
+
+	result.Duration = time.Since(startTime)
+	switch {
+	case err != nil:
+		result.Error = err
+		p.ui.FileError(file.Path, err)
+	case skipReason != "":
+		result.Skipped = true
+		result.SkipReason = skipReason
+		p.ui.FileSkipped(file.Path, skipReason)
+	default:
+		result.Success = true
+		p.ui.FileSuccess(file.Path, result.OutputFile, result.Duration, result.AITokensUsed)
+		p.ui.FileNormalized(file.Path, result.Normalizations)
+	}
+	return result
+}
+
+// selectValues parses a file and finds the values its selectors match.
+// Files that aren't JSON or YAML, or have nothing selected, are skipped.
+func (p *Processor) selectValues(file *types.FileInfo, content string, opts *types.ProcessingOptions) (*structured.Document, string, error) {
+	if !structured.Supported(file.Language) {
+		return nil, "--select only applies to JSON and YAML files", nil
+	}
+	selectors, err := parseSelectors(opts.Selectors)
+	if err != nil {
+		return nil, "", err
+	}
+	doc, err := structured.Load(content, file.Language, selectors)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(doc.Values()) == 0 {
+		return nil, "no string values match --select", nil
+	}
+	return doc, "", nil
+}
+
+// transformSelected sends the selected values in one request and returns
+// the document with the answers written back
+func (p *Processor) transformSelected(file *types.FileInfo, content string, doc *structured.Document, opts *types.ProcessingOptions, contextFiles []*types.ContextFile, result *types.ProcessingResult) (string, error) {
+	prompt, items, fixedTokens, err := p.selectedRequest(content, doc, opts)
+	if err != nil {
+		return "", err
+	}
+	candidates := p.candidateContext(file, content, opts, contextFiles)
+	packed, usage := p.packContext(context.Target{Path: file.Path, Content: content}, fixedTokens, opts, candidates)
+	result.Context = usage
+	p.ui.FileContext(file.Path, usage)
+
+	sources := append([]*types.ContextFile{
+		{Path: file.Path, Language: file.Language, Content: content, Label: "Document (for reference): " + file.Path, Pinned: true},
+		{Language: types.LangText, Content: items, Label: "Selected values", Pinned: true},
+	}, packed...)
+
+	req := types.AIRequest{
+		Model:       opts.Model,
+		Prompt:      prompt,
+		FileName:    file.Path,
+		Language:    file.Language,
+		MaxTokens:   opts.MaxTokens,
+		Temperature: opts.Temperature,
+		Mode:        types.ModeTransform,
+		PerItem:     true,
+	}
+
+	count := len(doc.Values())
+	for attempt := 0; ; attempt++ {
+		aiResp, err := p.aiClient.ProcessContent(req, sources)
+		if err != nil {
+			return "", fmt.Errorf("AI processing failed: %w", err)
+		}
+		p.recordUsage(result, aiResp)
+		if aiResp.Truncated {
+			return "", fmt.Errorf("response was cut off (%s); narrow --select or raise --max-tokens", aiResp.FinishReason)
+		}
+
+		texts, err := records.ParseResults(aiResp.Content, count)
+		if err == nil {
+			return doc.Apply(texts)
+		}
+		if attempt > 0 {
+			return "", fmt.Errorf("invalid response for the selected values: %w", err)
+		}
+		req.Prompt = prompt + fmt.Sprintf("\n\nYour previous response was rejected: %v\nRespond again with only the JSON object.", err)
+	}
+}
+
+// selectedRequest builds the prompt and the numbered value list of a
+// selected-values request, and counts the tokens they take
+func (p *Processor) selectedRequest(content string, doc *structured.Document, opts *types.ProcessingOptions) (string, string, int, error) {
+	prompt := opts.AIPrompt + "\n\nOnly the selected values are changed; each record gives a value and its path in the document. Answer with the new text of every value, unquoted and without its key."
+	if opts.SystemPrompt != "" || opts.SystemPromptFile != "" {
+		systemPrompt, err := p.getSystemPrompt(opts)
+		if err != nil {
+			return "", "", 0, fmt.Errorf("failed to get system prompt: %w", err)
+		}
+		prompt = systemPrompt + "\n\n" + prompt
+	}
+	prompt += "\n\n" + records.Instructions()
+
+	inputs := make([]json.RawMessage, len(doc.Values()))
+	for i, v := range doc.Values() {
+		inputs[i], _ = json.Marshal(map[string]string{"path": v.Path.String(), "value": v.Text})
+	}
+	items := records.Batch(inputs)
+
+	fixedTokens := tokens.CountAll(p.config.AI.Provider, prompt, content, items) + promptOverheadTokens
+	return prompt, items, fixedTokens, nil
+}
+
+// estimateSelected projects input and output tokens for transforming the
+// selected values of one file
+func (p *Processor) estimateSelected(file *types.FileInfo, opts *types.ProcessingOptions, contextFiles []*types.ContextFile) (int, int, bool) {
+	content, skipReason, err := p.readSourceFile(file)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	doc, skipReason, err := p.selectValues(file, content, opts)
+	if err != nil || skipReason != "" {
+		return 0, 0, false
+	}
+	_, _, fixedTokens, err := p.selectedRequest(content, doc, opts)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	candidates := p.candidateContext(file, content, opts, contextFiles)
+	_, usage := p.packContext(context.Target{Path: file.Path, Content: content}, fixedTokens, opts, candidates)
+	return fixedTokens + contextTokens(usage), capTokens(selectedOutputTokens*len(doc.Values()), opts.MaxTokens), true
+}
+
+// parseSelectors reads --select expressions
+func parseSelectors(exprs []string) ([]*structured.Selector, error) {
+	selectors := make([]*structured.Selector, 0, len(exprs))
+	for _, expr := range exprs {
+		s, err := structured.ParseSelector(expr)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, s)
+	}
+	return selectors, nil
+}
@@ -0,0 +1,125 @@
+package records
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Journal records each finished result as soon as it arrives, so a run that
+// stops early resumes where it left off. Entries are keyed by a hash of
+// everything that produced them; a changed prompt or record is redone.
+type Journal struct {
+	path    string
+	done    map[string]string
+	partial bool // The file ends in a line cut off by an interrupted write
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+type journalEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// JournalPath is where the progress of a run writing outputPath is kept
+func JournalPath(outputPath string) string {
+	return outputPath + ".progress"
+}
+
+// OpenJournal loads the results saved at path by earlier runs. A line cut
+// off by an interrupted write is ignored.
+func OpenJournal(path string) (*Journal, error) {
+	j := &Journal{path: path, done: make(map[string]string)}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read progress: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	scanner.Split(scanLines(&j.partial))
+	for scanner.Scan() {
+		var entry journalEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Key != "" {
+			j.done[entry.Key] = entry.Value
+		}
+	}
+	return j, scanner.Err()
+}
+
+// scanLines splits like bufio.ScanLines, noting whether the last line had
+// no newline
+func scanLines(partial *bool) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if atEOF && token != nil && advance == len(data) && data[len(data)-1] != '\n' {
+			*partial = true
+		}
+		return advance, token, err
+	}
+}
+
+// Get returns the saved result for key
+func (j *Journal) Get(key string) (string, bool) {
+	value, ok := j.done[key]
+	return value, ok
+}
+
+// Len is how many results have been saved
+func (j *Journal) Len() int {
+	return len(j.done)
+}
+
+// Append saves results. It is safe for concurrent use.
+func (j *Journal) Append(results map[string]string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		file, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to save progress: %w", err)
+		}
+		j.file = file
+	}
+
+	var data []byte
+	if j.partial {
+		data = append(data, '\n') // Keep the first entry off the cut-off line
+		j.partial = false
+	}
+	for key, value := range results {
+		line, _ := json.Marshal(journalEntry{Key: key, Value: value})
+		data = append(append(data, line...), '\n')
+	}
+	if _, err := j.file.Write(data); err != nil {
+		return fmt.Errorf("failed to save progress: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal, deleting it when the run is complete
+func (j *Journal) Close(complete bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	if complete {
+		if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
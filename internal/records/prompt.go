@@ -0,0 +1,91 @@
+package records
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/schema"
+)
+
+// resultsSchema is the response every batch request must match
+var resultsSchema = schema.MustParse(`{
+	"type": "object",
+	"required": ["results"],
+	"properties": {
+		"results": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["id", "value"],
+				"properties": {
+					"id": {"type": "integer", "minimum": 1},
+					"value": {"type": "string"}
+				}
+			}
+		}
+	}
+}`)
+
+// Batch renders records for one request, one JSON line each, numbered from 1
+func Batch(inputs []json.RawMessage) string {
+	var buf bytes.Buffer
+	for i, input := range inputs {
+		fmt.Fprintf(&buf, `{"id":%d,"record":%s}`+"\n", i+1, input)
+	}
+	return buf.String()
+}
+
+// Instructions describes the response format to the model
+func Instructions() string {
+	return `=== OUTPUT FORMAT ===
+The records are JSON lines, each with an id. Apply the instruction to every record on its own and respond with a single JSON object and nothing else:
+
+{"results": [{"id": 1, "value": "..."}, {"id": 2, "value": "..."}]}
+
+Rules:
+- Give exactly one result per id, for every id
+- value is a string holding only the result for that record, with no labels or commentary`
+}
+
+// ParseResults reads the results of one batch of n records, in record order.
+// A response that doesn't match the schema or misses an id is an error.
+func ParseResults(response string, n int) ([]string, error) {
+	_, data, err := resultsSchema.DecodeObject(response)
+	if err != nil {
+		return nil, err
+	}
+	var parsed struct {
+		Results []struct {
+			ID    int    `json:"id"`
+			Value string `json:"value"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	values := make([]string, n)
+	seen := make([]bool, n)
+	for _, r := range parsed.Results {
+		if r.ID > n {
+			return nil, fmt.Errorf("unknown id %d; ids run from 1 to %d", r.ID, n)
+		}
+		if seen[r.ID-1] {
+			return nil, fmt.Errorf("id %d answered twice", r.ID)
+		}
+		seen[r.ID-1] = true
+		values[r.ID-1] = r.Value
+	}
+	var missing []string
+	for i, ok := range seen {
+		if !ok {
+			missing = append(missing, fmt.Sprint(i+1))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no result for ids %s", strings.Join(missing, ", "))
+	}
+	return values, nil
+}
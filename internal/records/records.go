@@ -0,0 +1,282 @@
+package records
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatLog   = "log"
+)
+
+// Detect picks the format of path: the one asked for, or else the one its
+// extension names. Anything unrecognized is read as a log.
+func Detect(path, format string) (string, error) {
+	switch format {
+	case FormatCSV, FormatJSONL, FormatLog:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown record format %q (use csv, jsonl or log)", format)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".jsonl", ".ndjson":
+		return FormatJSONL, nil
+	}
+	return FormatLog, nil
+}
+
+// OutputExt is the extension a file of records is written with. Logs have
+// no room for a new field, so they are written as JSONL.
+func OutputExt(format, inputPath string) string {
+	if format == FormatLog {
+		return ".jsonl"
+	}
+	return filepath.Ext(inputPath)
+}
+
+// Record is one row, line or log entry
+type Record struct {
+	Line int // Line the record starts on
+
+	values []string // CSV: one value per header column
+	object *object  // JSONL
+	entry  string   // Log
+	result string   // Log: the value written next to the entry
+}
+
+// File is a file of records, kept so it can be written back unchanged
+// apart from the new field
+type File struct {
+	Format  string
+	Header  []string // CSV
+	Records []*Record
+
+	field  string // The field results go to
+	column int    // CSV: index of field in Header
+}
+
+// Parse reads the records of a decoded file in the given format
+func Parse(content, format string) (*File, error) {
+	data := []byte(content)
+	f := &File{Format: format}
+	var err error
+	switch format {
+	case FormatCSV:
+		err = f.readCSV(data)
+	case FormatJSONL:
+		err = f.readJSONL(data)
+	default:
+		f.readLog(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) readCSV(data []byte) error {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	first := true
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := r.FieldPos(0)
+		if first {
+			f.Header = row
+			first = false
+			continue
+		}
+		f.Records = append(f.Records, &Record{Line: line, values: row})
+	}
+	if first {
+		return fmt.Errorf("no header row")
+	}
+	return nil
+}
+
+func (f *File) readJSONL(data []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		obj, err := parseObject([]byte(text))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		f.Records = append(f.Records, &Record{Line: line, object: obj})
+	}
+	return scanner.Err()
+}
+
+// readLog splits a log into entries. A line that starts with whitespace
+// continues the entry above it, as stack traces and wrapped messages do.
+func (f *File) readLog(data []byte) {
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	var current *Record
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if current != nil && line != "" && (line[0] == ' ' || line[0] == '\t') {
+			current.entry += "\n" + line
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			current = nil
+			continue
+		}
+		current = &Record{Line: i + 1, entry: line}
+		f.Records = append(f.Records, current)
+	}
+}
+
+// Output sets the field results are written to. An existing CSV column or
+// JSON key of that name is overwritten.
+func (f *File) Output(field string) {
+	f.field = field
+	if f.Format != FormatCSV {
+		return
+	}
+	f.column = -1
+	for i, name := range f.Header {
+		if name == field {
+			f.column = i
+		}
+	}
+	if f.column < 0 {
+		f.Header = append(f.Header, field)
+		f.column = len(f.Header) - 1
+	}
+}
+
+// Fields lists the field names the records have, for validating a selection
+func (f *File) Fields() []string {
+	switch f.Format {
+	case FormatCSV:
+		return f.Header
+	case FormatJSONL:
+		seen := make(map[string]bool)
+		var names []string
+		for _, r := range f.Records {
+			for _, key := range r.object.keys {
+				if !seen[key] {
+					seen[key] = true
+					names = append(names, key)
+				}
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// Input renders what is sent to the model for r: a JSON object with the
+// fields named, or else all but the output field. Log entries are sent as
+// one string.
+func (f *File) Input(r *Record, fields []string) json.RawMessage {
+	include := func(name string) bool {
+		if len(fields) > 0 {
+			return slices.Contains(fields, name)
+		}
+		return name != f.field // An earlier result isn't input
+	}
+
+	selected := &object{values: make(map[string]json.RawMessage)}
+	switch f.Format {
+	case FormatCSV:
+		for i, name := range f.Header {
+			value := ""
+			if i < len(r.values) {
+				value = r.values[i]
+			}
+			if include(name) {
+				data, _ := marshal(value)
+				selected.set(name, data)
+			}
+		}
+	case FormatJSONL:
+		for _, key := range r.object.keys {
+			if include(key) {
+				selected.set(key, r.object.values[key])
+			}
+		}
+	default:
+		data, _ := marshal(r.entry)
+		return data
+	}
+	return selected.marshal()
+}
+
+// Set stores the result for r in the output field
+func (f *File) Set(r *Record, value string) {
+	switch f.Format {
+	case FormatCSV:
+		for len(r.values) <= f.column {
+			r.values = append(r.values, "")
+		}
+		r.values[f.column] = value
+	case FormatJSONL:
+		data, _ := marshal(value)
+		r.object.set(f.field, data)
+	default:
+		r.result = value
+	}
+}
+
+// Write renders the file with its results. Logs become JSONL with the entry,
+// its line number and the output field.
+func (f *File) Write() ([]byte, error) {
+	var buf bytes.Buffer
+	switch f.Format {
+	case FormatCSV:
+		w := csv.NewWriter(&buf)
+		w.Write(f.Header)
+		for _, r := range f.Records {
+			row := r.values
+			for len(row) < len(f.Header) {
+				row = append(row, "")
+			}
+			w.Write(row)
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	case FormatJSONL:
+		for _, r := range f.Records {
+			buf.Write(r.object.marshal())
+			buf.WriteByte('\n')
+		}
+	default:
+		for _, r := range f.Records {
+			obj := &object{values: make(map[string]json.RawMessage)}
+			line, _ := marshal(r.Line)
+			entry, _ := marshal(r.entry)
+			result, _ := marshal(r.result)
+			obj.set("line", line)
+			obj.set("entry", entry)
+			obj.set(f.field, result)
+			buf.Write(obj.marshal())
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,227 @@
+package records
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		field   string
+		inputs  []string // What Input sends for each record
+		want    string
+	}{
+		{
+			name:    "csv with a new column",
+			format:  FormatCSV,
+			content: "id,text\n1,hello\n" + `2,"a, b"` + "\n",
+			field:   "label",
+			inputs:  []string{`{"id":"1","text":"hello"}`, `{"id":"2","text":"a, b"}`},
+			want:    "id,text,label\n1,hello,r1\n" + `2,"a, b",r2` + "\n",
+		},
+		{
+			name:    "csv overwriting an existing column",
+			format:  FormatCSV,
+			content: "id,label,text\n1,old,hello\n2,,bye\n",
+			field:   "label",
+			inputs:  []string{`{"id":"1","text":"hello"}`, `{"id":"2","text":"bye"}`},
+			want:    "id,label,text\n1,r1,hello\n2,r2,bye\n",
+		},
+		{
+			name:    "csv with a short row",
+			format:  FormatCSV,
+			content: "id,text\n1\n",
+			field:   "label",
+			inputs:  []string{`{"id":"1","text":""}`},
+			want:    "id,text,label\n1,,r1\n",
+		},
+		{
+			name:    "jsonl keeps key order",
+			format:  FormatJSONL,
+			content: `{"z":1,"a":"<x>"}` + "\n\n" + `{"a":2}` + "\n",
+			field:   "label",
+			inputs:  []string{`{"z":1,"a":"<x>"}`, `{"a":2}`},
+			want:    `{"z":1,"a":"<x>","label":"r1"}` + "\n" + `{"a":2,"label":"r2"}` + "\n",
+		},
+		{
+			name:    "jsonl overwriting an existing key in place",
+			format:  FormatJSONL,
+			content: `{"label":"old","a":1}` + "\n",
+			field:   "label",
+			inputs:  []string{`{"a":1}`},
+			want:    `{"label":"r1","a":1}` + "\n",
+		},
+		{
+			name:    "log with continuation lines",
+			format:  FormatLog,
+			content: "ERROR boom\n  at main.go:1\n\nINFO ok\n",
+			field:   "cause",
+			inputs:  []string{`"ERROR boom\n  at main.go:1"`, `"INFO ok"`},
+			want: `{"line":1,"entry":"ERROR boom\n  at main.go:1","cause":"r1"}` + "\n" +
+				`{"line":4,"entry":"INFO ok","cause":"r2"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(tt.content, tt.format)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			f.Output(tt.field)
+			if len(f.Records) != len(tt.inputs) {
+				t.Fatalf("got %d records, want %d", len(f.Records), len(tt.inputs))
+			}
+			for i, r := range f.Records {
+				if got := string(f.Input(r, nil)); got != tt.inputs[i] {
+					t.Errorf("record %d input: got %s, want %s", i+1, got, tt.inputs[i])
+				}
+				f.Set(r, "r"+string(rune('1'+i)))
+			}
+			data, err := f.Write()
+			if err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputFields(t *testing.T) {
+	f, err := Parse("id,text,extra\n1,hello,x\n", FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Output("label")
+	if got, want := string(f.Input(f.Records[0], []string{"text"})), `{"text":"hello"}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse("", FormatCSV); err == nil {
+		t.Error("csv without a header accepted")
+	}
+	if _, err := Parse(`{"a":1}`+"\n[1]\n", FormatJSONL); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("got %v, want an error on line 2", err)
+	}
+}
+
+func TestParseResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		n        int
+		want     []string
+		err      string
+	}{
+		{
+			name:     "in order",
+			response: `{"results": [{"id": 1, "value": "a"}, {"id": 2, "value": "b"}]}`,
+			n:        2,
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "out of order in a code fence",
+			response: "```json\n{\"results\": [{\"id\": 2, \"value\": \"b\"}, {\"id\": 1, \"value\": \"a\"}]}\n```",
+			n:        2,
+			want:     []string{"a", "b"},
+		},
+		{
+			name:     "missing ids",
+			response: `{"results": [{"id": 2, "value": "b"}]}`,
+			n:        3,
+			err:      "no result for ids 1, 3",
+		},
+		{
+			name:     "duplicate id",
+			response: `{"results": [{"id": 1, "value": "a"}, {"id": 1, "value": "b"}]}`,
+			n:        2,
+			err:      "id 1 answered twice",
+		},
+		{
+			name:     "id out of range",
+			response: `{"results": [{"id": 1, "value": "a"}, {"id": 3, "value": "c"}]}`,
+			n:        2,
+			err:      "unknown id 3",
+		},
+		{
+			name:     "id below range",
+			response: `{"results": [{"id": 0, "value": "a"}]}`,
+			n:        1,
+			err:      "at least 1",
+		},
+		{
+			name:     "value not a string",
+			response: `{"results": [{"id": 1, "value": 5}]}`,
+			n:        1,
+			err:      "value",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseResults(tt.response, tt.n)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv.progress")
+
+	// An interrupted write leaves a partial last line
+	if err := os.WriteFile(path, []byte(`{"key":"a","value":"1"}`+"\n"+`{"key":"b","val`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	if value, ok := j.Get("a"); !ok || value != "1" {
+		t.Errorf("Get(a) = %q, %v; want 1, true", value, ok)
+	}
+	if _, ok := j.Get("b"); ok {
+		t.Error("truncated entry b was loaded")
+	}
+
+	if err := j.Append(map[string]string{"c": "3"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.Append(map[string]string{"d": "4"}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := j.Close(false); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if j.Len() != 3 {
+		t.Errorf("resumed %d results, want 3", j.Len())
+	}
+	if err := j.Close(true); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("journal kept after a complete run")
+	}
+}
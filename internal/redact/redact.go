@@ -0,0 +1,317 @@
+package redact
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// placeholderPrefix starts every placeholder
+const placeholderPrefix = "__PRESTO_REDACTED_"
+
+// placeholderPattern matches placeholders produced by a Redactor
+var placeholderPattern = regexp.MustCompile(`__PRESTO_REDACTED_[A-Z0-9_]+?_\d+__`)
+
+// kindPattern matches the characters of a detector name a placeholder can't hold
+var kindPattern = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Detector finds one kind of sensitive value
+type Detector struct {
+	Name       string
+	Pattern    *regexp.Regexp
+	Group      int  // Submatch holding the sensitive value; 0 for the whole match
+	Secret     bool // Credentials rather than personal data; used when skipping files
+	ConfigOnly bool // Runs only on .env and config files, as it also matches ordinary code
+}
+
+// configExtensions are the file types config-only detectors run on
+var configExtensions = map[string]bool{
+	".env":        true,
+	".yaml":       true,
+	".yml":        true,
+	".json":       true,
+	".toml":       true,
+	".ini":        true,
+	".cfg":        true,
+	".conf":       true,
+	".properties": true,
+}
+
+// Finding reports how many values a detector matched
+type Finding struct {
+	Detector string
+	Count    int
+	Secret   bool
+}
+
+// BuiltinDetectors returns the detectors shipped with presto
+func BuiltinDetectors() []Detector {
+	detectors := []Detector{
+		{
+			Name:    "private_key",
+			Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+			Secret:  true,
+		},
+		{
+			Name:    "aws_access_key",
+			Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+			Secret:  true,
+		},
+		{
+			Name:    "aws_secret_key",
+			Pattern: regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|private).{0,20}?[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`),
+			Group:   1,
+			Secret:  true,
+		},
+		{
+			Name:    "api_token",
+			Pattern: regexp.MustCompile(`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}|gh[pousr]_[A-Za-z0-9]{36,}|xox[baprs]-[A-Za-z0-9-]{10,})`),
+			Secret:  true,
+		},
+		{
+			Name:    "jwt",
+			Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}`),
+			Secret:  true,
+		},
+		{
+			// Assignments such as `password = getPassword()` are common in
+			// code, so this only runs on .env and config files
+			Name:       "env_secret",
+			Pattern:    regexp.MustCompile(`(?m)^[ \t]*(?:export[ \t]+)?[A-Za-z0-9_]*(?i:secret|token|password|passwd|pwd|api_?key|access_?key|private_?key|credentials?)[A-Za-z0-9_]*[ \t]*[:=][ \t]*["']?([^\s"'#]{4,})`),
+			Group:      1,
+			Secret:     true,
+			ConfigOnly: true,
+		},
+		{
+			Name:    "email",
+			Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+		},
+	}
+
+	// Absolute paths under the user's home directory reveal the username
+	if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+		detectors = append(detectors, Detector{
+			Name:    "home_path",
+			Pattern: regexp.MustCompile(regexp.QuoteMeta(home) + `\b`),
+		})
+	}
+
+	return detectors
+}
+
+// Redactor replaces sensitive values with stable placeholders and restores
+// them later. The same value always maps to the same placeholder for the
+// lifetime of the Redactor, so prompts stay consistent across files.
+type Redactor struct {
+	detectors []Detector
+
+	mu           sync.Mutex
+	placeholders map[string]string // original -> placeholder
+	originals    map[string]string // placeholder -> original
+	counters     map[string]int
+}
+
+// New creates a redactor using the named built-in detectors (all of them
+// when names is empty) plus custom patterns keyed by name
+func New(names []string, custom map[string]string) (*Redactor, error) {
+	enabled := make(map[string]bool)
+	for _, name := range names {
+		enabled[name] = true
+	}
+
+	var detectors []Detector
+	for _, d := range BuiltinDetectors() {
+		if len(names) == 0 || enabled[d.Name] {
+			detectors = append(detectors, d)
+			delete(enabled, d.Name)
+		}
+	}
+	for name := range enabled {
+		return nil, fmt.Errorf("unknown redaction detector: %s", name)
+	}
+
+	// Sort custom patterns so detector order is deterministic
+	customNames := make([]string, 0, len(custom))
+	for name := range custom {
+		customNames = append(customNames, name)
+	}
+	sort.Strings(customNames)
+
+	for _, name := range customNames {
+		re, err := regexp.Compile(custom[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %w", name, err)
+		}
+		group := 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+		detectors = append(detectors, Detector{Name: name, Pattern: re, Group: group, Secret: true})
+	}
+
+	return &Redactor{
+		detectors:    detectors,
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		counters:     make(map[string]int),
+	}, nil
+}
+
+// ConfigFile reports whether path is a .env or config file, which
+// config-only detectors run on
+func ConfigFile(path string) bool {
+	base := strings.ToLower(filepath.Base(path))
+	return strings.HasPrefix(base, ".env") || configExtensions[filepath.Ext(base)]
+}
+
+// Redact replaces every detected value in text with its placeholder. It
+// returns the redacted text and the number of values replaced. Config-only
+// detectors are left out; use RedactFile for text from a known file.
+func (r *Redactor) Redact(text string) (string, int) {
+	return r.RedactFile(text, "")
+}
+
+// RedactFile is Redact for the content of the file at path, adding the
+// config-only detectors when it is a .env or config file
+func (r *Redactor) RedactFile(text, path string) (string, int) {
+	config := ConfigFile(path)
+	total := 0
+	for _, d := range r.detectors {
+		if d.ConfigOnly && !config {
+			continue
+		}
+		var n int
+		text, n = r.apply(text, d)
+		total += n
+	}
+	return text, total
+}
+
+// Restore replaces placeholders in text with the original values
+func (r *Redactor) Restore(text string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if original, ok := r.originals[placeholder]; ok {
+			return original
+		}
+		return placeholder
+	})
+}
+
+// Pending returns where a placeholder that may still be incomplete starts at
+// the end of text, or len(text) if there is none. Streamed output holds that
+// tail back until more arrives, so every placeholder is restored whole.
+func Pending(text string) int {
+	// Everything up to the end of the last complete placeholder is ready;
+	// its closing underscores must not be mistaken for the start of another
+	done := 0
+	if locs := placeholderPattern.FindAllStringIndex(text, -1); len(locs) > 0 {
+		done = locs[len(locs)-1][1]
+	}
+	tail := text[done:]
+	if i := strings.Index(tail, placeholderPrefix); i >= 0 {
+		return done + i
+	}
+	for n := min(len(placeholderPrefix)-1, len(tail)); n > 0; n-- {
+		if strings.HasSuffix(tail, placeholderPrefix[:n]) {
+			return len(text) - n
+		}
+	}
+	return len(text)
+}
+
+// Scan reports what the detectors find in the content of the file at path
+// without redacting it
+func (r *Redactor) Scan(text, path string) []Finding {
+	config := ConfigFile(path)
+	var findings []Finding
+	for _, d := range r.detectors {
+		if d.ConfigOnly && !config {
+			continue
+		}
+		count := 0
+		for _, m := range d.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[2*d.Group], m[2*d.Group+1]
+			if start >= 0 && !placeholderPattern.MatchString(text[start:end]) {
+				count++
+			}
+		}
+		if count > 0 {
+			findings = append(findings, Finding{Detector: d.Name, Count: count, Secret: d.Secret})
+		}
+	}
+	return findings
+}
+
+// Secrets returns the names of secret detectors that match the content of
+// the file at path
+func (r *Redactor) Secrets(text, path string) []string {
+	var names []string
+	for _, f := range r.Scan(text, path) {
+		if f.Secret {
+			names = append(names, f.Detector)
+		}
+	}
+	return names
+}
+
+// Instructions explains placeholders to the model; it is appended to prompts
+// that contain redacted values
+func Instructions() string {
+	return "NOTE: Values of the form __PRESTO_REDACTED_<KIND>_<N>__ are placeholders for sensitive data. " +
+		"Keep every placeholder exactly as written wherever it appears in your output."
+}
+
+// apply redacts all matches of a single detector
+func (r *Redactor) apply(text string, d Detector) (string, int) {
+	matches := d.Pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, 0
+	}
+
+	var out strings.Builder
+	last, count := 0, 0
+	for _, m := range matches {
+		start, end := m[2*d.Group], m[2*d.Group+1]
+		if start < 0 || start < last {
+			continue
+		}
+
+		value := text[start:end]
+		if placeholderPattern.MatchString(value) {
+			continue
+		}
+
+		out.WriteString(text[last:start])
+		out.WriteString(r.placeholderFor(d.Name, value))
+		last = end
+		count++
+	}
+	out.WriteString(text[last:])
+
+	return out.String(), count
+}
+
+// placeholderFor returns the stable placeholder for a value, creating one if needed
+func (r *Redactor) placeholderFor(kind, value string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if placeholder, ok := r.placeholders[value]; ok {
+		return placeholder
+	}
+
+	kind = strings.ToUpper(kindPattern.ReplaceAllString(kind, "_"))
+	r.counters[kind]++
+	placeholder := fmt.Sprintf("__PRESTO_REDACTED_%s_%d__", kind, r.counters[kind])
+
+	r.placeholders[value] = placeholder
+	r.originals[placeholder] = value
+	return placeholder
+}
@@ -0,0 +1,254 @@
+package region
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Region is a part of a file: a declaration named by --symbol or a line
+// range given with --lines
+type Region struct {
+	Symbol    string // Empty for a line range
+	StartLine int
+	EndLine   int
+
+	start, end int // Byte span, from the start of the first line to the end of the last, without its newline
+}
+
+// LineRange is a 1-based, inclusive range of lines
+type LineRange struct {
+	Start, End int
+}
+
+// ParseLines reads a --lines range: "120-180", or "120" for one line
+func ParseLines(spec string) (LineRange, error) {
+	from, to, found := strings.Cut(strings.TrimSpace(spec), "-")
+	start, err := strconv.Atoi(strings.TrimSpace(from))
+	end := start
+	if err == nil && found {
+		end, err = strconv.Atoi(strings.TrimSpace(to))
+	}
+	if err != nil || start < 1 || end < start {
+		return LineRange{}, fmt.Errorf("invalid line range %q: use START-END, e.g. 120-180", spec)
+	}
+	return LineRange{Start: start, End: end}, nil
+}
+
+// Lines returns the region of content covering r. A range running past the
+// end of the file stops at its last line.
+func Lines(content string, r LineRange) (*Region, error) {
+	offsets := lineOffsets(content)
+	if r.Start > len(offsets) {
+		return nil, fmt.Errorf("lines %d-%d: the file has %d lines", r.Start, r.End, len(offsets))
+	}
+	end := min(r.End, len(offsets))
+	return spanOf(content, offsets, "", r.Start, end), nil
+}
+
+// GoSymbols returns the regions of the Go declarations names refers to, with
+// their doc comments. "Type.Method" names a method, with or without a
+// pointer receiver; a bare name matches every function, method, type,
+// variable or constant of that name. Names matching nothing are returned
+// as missing.
+func GoSymbols(content string, names []string) ([]*Region, []string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse Go file: %w", err)
+	}
+	offsets := lineOffsets(content)
+
+	found := make(map[string]bool)
+	var regions []*Region
+	add := func(name string, doc *ast.CommentGroup, node ast.Node) {
+		var match string
+		for _, n := range names {
+			if n == name || (!strings.Contains(n, ".") && n == name[strings.LastIndex(name, ".")+1:]) {
+				match = n
+				break
+			}
+		}
+		if match == "" {
+			return
+		}
+		found[match] = true
+		pos := node.Pos()
+		if doc != nil {
+			pos = doc.Pos()
+		}
+		start, end := fset.Position(pos).Line, fset.Position(node.End()).Line
+		regions = append(regions, spanOf(content, offsets, name, start, end))
+	}
+
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name = receiverName(d.Recv.List[0].Type) + "." + name
+			}
+			add(name, d.Doc, d)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				// A single unparenthesized declaration takes its keyword along
+				var node ast.Node = spec
+				doc := d.Doc
+				if d.Lparen.IsValid() {
+					doc = specDoc(spec)
+				} else {
+					node = d
+				}
+				for _, name := range specNames(spec) {
+					add(name, doc, node)
+				}
+			}
+		}
+	}
+
+	var missing []string
+	for _, n := range names {
+		if !found[n] {
+			missing = append(missing, n)
+		}
+	}
+	return regions, missing, nil
+}
+
+// CheckGo reports whether content still parses as Go
+func CheckGo(content string) error {
+	if _, err := parser.ParseFile(token.NewFileSet(), "", content, parser.ParseComments); err != nil {
+		return fmt.Errorf("result is not valid Go: %w", err)
+	}
+	return nil
+}
+
+// Sort orders regions by position and rejects overlapping ones; the same
+// region named twice is kept once
+func Sort(regions []*Region) ([]*Region, error) {
+	sort.Slice(regions, func(i, j int) bool { return regions[i].start < regions[j].start })
+	var out []*Region
+	for _, r := range regions {
+		if len(out) > 0 {
+			last := out[len(out)-1]
+			if r.start == last.start && r.end == last.end {
+				continue
+			}
+			if r.start < last.end {
+				return nil, fmt.Errorf("%s overlaps %s", r, last)
+			}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// String describes the region, e.g. "Processor.processFile (lines 340-440)"
+func (r *Region) String() string {
+	if r.Symbol == "" {
+		return fmt.Sprintf("lines %d-%d", r.StartLine, r.EndLine)
+	}
+	return fmt.Sprintf("%s (lines %d-%d)", r.Symbol, r.StartLine, r.EndLine)
+}
+
+// Text returns the region's content
+func (r *Region) Text(content string) string {
+	return content[r.start:r.end]
+}
+
+// Surroundings returns content with the region replaced by marker, for
+// sending the rest of a file as context
+func (r *Region) Surroundings(content, marker string) string {
+	return content[:r.start] + marker + content[r.end:]
+}
+
+// Span is a part of a file given by its byte offsets
+type Span interface {
+	Span() (start, end int)
+}
+
+// Span returns the byte offsets of the region
+func (r *Region) Span() (int, int) {
+	return r.start, r.end
+}
+
+// Replace returns content with each span, in order and not overlapping,
+// replaced by the text at the same index. Everything outside the spans is
+// kept byte for byte.
+func Replace[S Span](content string, spans []S, texts []string) string {
+	var b strings.Builder
+	pos := 0
+	for i, s := range spans {
+		start, end := s.Span()
+		b.WriteString(content[pos:start])
+		b.WriteString(texts[i])
+		pos = end
+	}
+	b.WriteString(content[pos:])
+	return b.String()
+}
+
+// lineOffsets returns the byte offset at which each line starts
+func lineOffsets(content string) []int {
+	offsets := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' && i+1 < len(content) {
+			offsets = append(offsets, i+1)
+		}
+	}
+	return offsets
+}
+
+// spanOf builds the region of lines start to end
+func spanOf(content string, offsets []int, symbol string, start, end int) *Region {
+	endOffset := len(content)
+	if end < len(offsets) {
+		endOffset = offsets[end]
+	}
+	endOffset = offsets[start-1] + len(strings.TrimRight(content[offsets[start-1]:endOffset], "\r\n"))
+	return &Region{Symbol: symbol, StartLine: start, EndLine: end, start: offsets[start-1], end: endOffset}
+}
+
+// receiverName returns the type name of a method receiver: T for *T, T[K]
+// and so on
+func receiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(t.X)
+	case *ast.IndexExpr:
+		return receiverName(t.X)
+	case *ast.IndexListExpr:
+		return receiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+func specNames(spec ast.Spec) []string {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return []string{s.Name.Name}
+	case *ast.ValueSpec:
+		var names []string
+		for _, n := range s.Names {
+			names = append(names, n.Name)
+		}
+		return names
+	}
+	return nil
+}
+
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package region
+
+import (
+	"strings"
+	"testing"
+)
+
+// goSource declares one of everything GoSymbols finds; line numbers matter
+const goSource = `package p
+
+// Server serves.
+type Server struct{}
+
+// Start starts the server.
+func (s *Server) Start() {}
+
+func (s Server) Stop() {}
+
+func Start() {}
+
+type List[T any] struct{}
+
+func (l *List[T]) Len() int { return 0 }
+
+type Map[K comparable, V any] struct{}
+
+func (m Map[K, V]) Len() int { return 0 }
+
+// Limit caps things.
+const Limit = 10
+
+var (
+	// Name is a name.
+	Name = "x"
+	Other, Third = 1, 2
+)
+`
+
+func TestGoSymbols(t *testing.T) {
+	tests := []struct {
+		name    string
+		symbols []string
+		want    []string // Region strings, in file order
+		missing []string
+	}{
+		{"pointer receiver", []string{"Server.Start"}, []string{"Server.Start (lines 6-7)"}, nil},
+		{"value receiver", []string{"Server.Stop"}, []string{"Server.Stop (lines 9-9)"}, nil},
+		{"generic receiver", []string{"List.Len"}, []string{"List.Len (lines 15-15)"}, nil},
+		{"generic receiver with two parameters", []string{"Map.Len"}, []string{"Map.Len (lines 19-19)"}, nil},
+		{"bare name matches functions and methods", []string{"Start"}, []string{"Server.Start (lines 6-7)", "Start (lines 11-11)"}, nil},
+		{"type with doc comment", []string{"Server"}, []string{"Server (lines 3-4)"}, nil},
+		{"single GenDecl takes keyword and doc", []string{"Limit"}, []string{"Limit (lines 21-22)"}, nil},
+		{"parenthesized GenDecl takes the spec and its doc", []string{"Name"}, []string{"Name (lines 25-26)"}, nil},
+		{"spec with several names", []string{"Third"}, []string{"Third (lines 27-27)"}, nil},
+		{"missing names", []string{"Limit", "Nope", "Server.Nope"}, []string{"Limit (lines 21-22)"}, []string{"Nope", "Server.Nope"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regions, missing, err := GoSymbols(goSource, tt.symbols)
+			if err != nil {
+				t.Fatalf("GoSymbols: %v", err)
+			}
+			regions, err = Sort(regions)
+			if err != nil {
+				t.Fatalf("Sort: %v", err)
+			}
+			var got []string
+			for _, r := range regions {
+				got = append(got, r.String())
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if strings.Join(missing, "|") != strings.Join(tt.missing, "|") {
+				t.Errorf("missing %q, want %q", missing, tt.missing)
+			}
+		})
+	}
+}
+
+func TestGoSymbolText(t *testing.T) {
+	regions, _, err := GoSymbols(goSource, []string{"Name", "Limit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions, _ = Sort(regions)
+	if got, want := regions[0].Text(goSource), "// Limit caps things.\nconst Limit = 10"; got != want {
+		t.Errorf("Limit: got %q, want %q", got, want)
+	}
+	if got, want := regions[1].Text(goSource), "\t// Name is a name.\n\tName = \"x\""; got != want {
+		t.Errorf("Name: got %q, want %q", got, want)
+	}
+}
+
+func TestGoSymbolsInvalid(t *testing.T) {
+	if _, _, err := GoSymbols("package p\nfunc {", []string{"A"}); err == nil {
+		t.Error("unparsable file accepted")
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    LineRange
+		wantErr bool
+	}{
+		{"120-180", LineRange{120, 180}, false},
+		{" 5 - 7 ", LineRange{5, 7}, false},
+		{"42", LineRange{42, 42}, false},
+		{"", LineRange{}, true},
+		{"0-3", LineRange{}, true},
+		{"9-3", LineRange{}, true},
+		{"a-b", LineRange{}, true},
+		{"3-", LineRange{}, true},
+		{"-3", LineRange{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLines(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLines(%q) = %v, %v; want %v, error %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	content := "one\ntwo\r\nthree\nfour\n"
+	tests := []struct {
+		name    string
+		r       LineRange
+		want    string
+		wantErr bool
+	}{
+		{"single line", LineRange{1, 1}, "one", false},
+		{"CRLF line ending left out", LineRange{2, 2}, "two", false},
+		{"range", LineRange{2, 3}, "two\r\nthree", false},
+		{"past the end stops at the last line", LineRange{3, 99}, "three\nfour", false},
+		{"starting past the end", LineRange{5, 6}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := Lines(content, tt.r)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got region %s, want an error", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lines: %v", err)
+			}
+			if got := r.Text(content); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	content := "a\nb\nc\nd\ne\n"
+	lines := func(start, end int) *Region {
+		r, err := Lines(content, LineRange{start, end})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	tests := []struct {
+		name    string
+		regions []*Region
+		want    string
+		err     string
+	}{
+		{"ordered", []*Region{lines(4, 5), lines(1, 2)}, "lines 1-2|lines 4-5", ""},
+		{"adjacent", []*Region{lines(3, 3), lines(1, 2)}, "lines 1-2|lines 3-3", ""},
+		{"duplicate kept once", []*Region{lines(2, 3), lines(2, 3)}, "lines 2-3", ""},
+		{"overlap", []*Region{lines(1, 3), lines(3, 4)}, "", "overlaps"},
+		{"nested", []*Region{lines(1, 5), lines(2, 2)}, "", "overlaps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regions, err := Sort(tt.regions)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Sort: %v", err)
+			}
+			var got []string
+			for _, r := range regions {
+				got = append(got, r.String())
+			}
+			if strings.Join(got, "|") != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	content := "package p\n\nfunc A() {}\n\nfunc B() {}\n\nfunc C() {}\n"
+	regions, missing, err := GoSymbols(content, []string{"C", "A"})
+	if err != nil || len(missing) > 0 {
+		t.Fatalf("GoSymbols: %v, missing %v", err, missing)
+	}
+	regions, err = Sort(regions)
+	if err != nil {
+		t.Fatalf("Sort: %v", err)
+	}
+	got := Replace(content, regions, []string{"func A() { a() }", "func C() {\n\tc()\n}"})
+	want := "package p\n\nfunc A() { a() }\n\nfunc B() {}\n\nfunc C() {\n\tc()\n}\n"
+	if got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestSurroundings(t *testing.T) {
+	content := "a\nb\nc\n"
+	r, err := Lines(content, LineRange{2, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.Surroundings(content, "<here>"), "a\n<here>\nc\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,274 @@
+package repomap
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Zachacious/presto/internal/language"
+	"github.com/Zachacious/presto/internal/outline"
+	"github.com/Zachacious/presto/internal/textfile"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+const (
+	// maxSymbolsPerFile keeps one large file from dominating the map
+	maxSymbolsPerFile = 40
+
+	// maxFileSize skips generated or vendored blobs that slipped past the filters
+	maxFileSize = 512 * 1024
+)
+
+// importLinePattern matches outline lines that are imports rather than symbols
+var importLinePattern = regexp.MustCompile(`^\s*(import|from|require|#include|use|using|package)\b`)
+
+// Options controls which files appear in the map
+type Options struct {
+	ExcludeDirs []string // Directory names to skip, in addition to hidden ones
+	ExcludeExts []string
+}
+
+// Generator builds compact repository maps: the file tree plus the exported
+// types and function signatures of each source file
+type Generator struct {
+	opts Options
+}
+
+// New creates a repo map generator
+func New(opts Options) *Generator {
+	return &Generator{opts: opts}
+}
+
+// Build walks root and renders its map. Paths are relative to root.
+func (g *Generator) Build(root string) (string, error) {
+	files, err := g.collect(root)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	currentDir := ""
+	for _, rel := range files {
+		dir := filepath.ToSlash(filepath.Dir(rel))
+		if dir != currentDir {
+			currentDir = dir
+			if dir != "." {
+				out.WriteString(dir + "/\n")
+			}
+		}
+
+		indent := "  "
+		if dir == "." {
+			indent = ""
+		}
+		out.WriteString(indent + filepath.Base(rel) + "\n")
+
+		for _, symbol := range g.symbols(filepath.Join(root, rel)) {
+			out.WriteString(indent + "  " + symbol + "\n")
+		}
+	}
+
+	return out.String(), nil
+}
+
+// collect lists the text files under root, sorted, relative to root
+func (g *Generator) collect(root string) ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip unreadable entries
+		}
+
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || g.excludedDir(name)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(name, ".") || g.excludedExt(name) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxFileSize {
+			return nil
+		}
+		if !textfile.IsText(path) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		di, dj := filepath.Dir(files[i]), filepath.Dir(files[j])
+		if di != dj {
+			return di < dj
+		}
+		return files[i] < files[j]
+	})
+	return files, nil
+}
+
+// symbols returns the notable declarations of a file, one line each
+func (g *Generator) symbols(path string) []string {
+	lang := language.DetectLanguage(path)
+	switch lang {
+	case types.LangUnknown, types.LangText, types.LangJSON, types.LangYAML, types.LangXML, types.LangCSS, types.LangHTML, types.LangNotebook:
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	info := textfile.Sniff(data)
+	if info.Binary {
+		return nil
+	}
+	content, err := textfile.Decode(data, info.Format)
+	if err != nil {
+		return nil
+	}
+
+	var symbols []string
+	if lang == types.LangGo {
+		symbols = goSymbols(content)
+	} else {
+		for _, line := range strings.Split(outline.Outline(content, lang), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !importLinePattern.MatchString(line) {
+				symbols = append(symbols, line)
+			}
+		}
+	}
+
+	if len(symbols) > maxSymbolsPerFile {
+		more := len(symbols) - maxSymbolsPerFile
+		symbols = append(symbols[:maxSymbolsPerFile], fmt.Sprintf("... %d more", more))
+	}
+	return symbols
+}
+
+// goSymbols lists exported types, functions and methods of a Go file
+func goSymbols(content string) []string {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	var symbols []string
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() || (d.Recv != nil && !exportedReceiver(d.Recv)) {
+				continue
+			}
+			d.Body = nil
+			d.Doc = nil
+			var buf bytes.Buffer
+			if outline.GofmtConfig.Fprint(&buf, fset, d) == nil {
+				symbols = append(symbols, strings.Join(strings.Fields(buf.String()), " "))
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() {
+						symbols = append(symbols, fmt.Sprintf("type %s %s", s.Name.Name, typeKind(s.Type)))
+					}
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						if name.IsExported() {
+							symbols = append(symbols, fmt.Sprintf("%s %s", d.Tok, name.Name))
+						}
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+// exportedReceiver reports whether a method's receiver type is exported
+func exportedReceiver(recv *ast.FieldList) bool {
+	if len(recv.List) == 0 {
+		return false
+	}
+	expr := recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch index := expr.(type) {
+	case *ast.IndexExpr:
+		expr = index.X
+	case *ast.IndexListExpr:
+		expr = index.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.IsExported()
+	}
+	return false
+}
+
+// typeKind names the shape of a type declaration
+func typeKind(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	case *ast.FuncType:
+		return "func"
+	case *ast.MapType:
+		return "map"
+	case *ast.ArrayType:
+		if t.Len != nil {
+			return "array"
+		}
+		return "slice"
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok {
+			return pkg.Name + "." + t.Sel.Name
+		}
+	}
+	return ""
+}
+
+func (g *Generator) excludedDir(name string) bool {
+	for _, dir := range g.opts.ExcludeDirs {
+		if name == dir {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Generator) excludedExt(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, excluded := range g.opts.ExcludeExts {
+		if ext == excluded {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package review
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// Report formats
+const (
+	FormatTerminal = "terminal"
+	FormatSARIF    = "sarif"
+	FormatGitHub   = "github"
+)
+
+// sarifSchema identifies the SARIF version written
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// SARIF renders findings as a SARIF 2.1.0 log, as read by code scanning tools
+func SARIF(findings []types.Finding, toolVersion string) ([]byte, error) {
+	type region struct {
+		StartLine int `json:"startLine"`
+		EndLine   int `json:"endLine"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region region `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	type message struct {
+		Text string `json:"text"`
+	}
+	type result struct {
+		RuleID    string     `json:"ruleId"`
+		Level     string     `json:"level"`
+		Message   message    `json:"message"`
+		Locations []location `json:"locations"`
+	}
+	type rule struct {
+		ID string `json:"id"`
+	}
+
+	results := make([]result, 0, len(findings))
+	rules := []rule{}
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		var loc location
+		loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(f.Path)
+		loc.PhysicalLocation.Region = region{StartLine: f.StartLine, EndLine: f.EndLine}
+
+		results = append(results, result{
+			RuleID:    f.Category,
+			Level:     string(f.Severity),
+			Message:   message{Text: f.Message},
+			Locations: []location{loc},
+		})
+		if !seen[f.Category] {
+			seen[f.Category] = true
+			rules = append(rules, rule{ID: f.Category})
+		}
+	}
+
+	log := map[string]any{
+		"$schema": sarifSchema,
+		"version": "2.1.0",
+		"runs": []any{map[string]any{
+			"tool": map[string]any{
+				"driver": map[string]any{
+					"name":           "presto",
+					"version":        toolVersion,
+					"informationUri": "https://github.com/Zachacious/presto",
+					"rules":          rules,
+				},
+			},
+			"results": results,
+		}},
+	}
+	return json.MarshalIndent(log, "", "  ")
+}
+
+// GitHub renders findings as GitHub Actions workflow commands, which show up
+// as annotations on the pull request
+func GitHub(findings []types.Finding) string {
+	var out strings.Builder
+	for _, f := range findings {
+		level := "notice"
+		switch f.Severity {
+		case types.SeverityError:
+			level = "error"
+		case types.SeverityWarning:
+			level = "warning"
+		}
+		fmt.Fprintf(&out, "::%s file=%s,line=%d,endLine=%d,title=%s::%s\n",
+			level, escapeProperty(filepath.ToSlash(f.Path)), f.StartLine, f.EndLine,
+			escapeProperty(f.Category), escapeData(f.Message))
+	}
+	return out.String()
+}
+
+// escapeData escapes a workflow command message
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a workflow command property value
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,33 @@
+package review
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSARIFNoFindings(t *testing.T) {
+	data, err := SARIF(nil, "test")
+	if err != nil {
+		t.Fatalf("SARIF: %v", err)
+	}
+	var log struct {
+		Runs []struct {
+			Tool struct {
+				Driver struct {
+					Rules json.RawMessage `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results json.RawMessage `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("runs = %d, want 1", len(log.Runs))
+	}
+	run := log.Runs[0]
+	if string(run.Tool.Driver.Rules) != "[]" || string(run.Results) != "[]" {
+		t.Errorf("rules = %s, results = %s; want empty arrays", run.Tool.Driver.Rules, run.Results)
+	}
+}
@@ -0,0 +1,98 @@
+package review
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Zachacious/presto/internal/schema"
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// DefaultPrompt is used when a review has no prompt of its own
+const DefaultPrompt = "Review this file. Report bugs, security issues, error handling gaps, performance problems and hard-to-maintain code. Skip formatting nitpicks."
+
+// findingsSchema is the response every review request must match
+var findingsSchema = schema.MustParse(`{
+	"type": "object",
+	"required": ["findings"],
+	"additionalProperties": false,
+	"properties": {
+		"findings": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["start_line", "end_line", "severity", "category", "message"],
+				"additionalProperties": false,
+				"properties": {
+					"start_line": {"type": "integer", "minimum": 1},
+					"end_line": {"type": "integer", "minimum": 1},
+					"severity": {"type": "string", "enum": ["error", "warning", "note"]},
+					"category": {"type": "string", "minLength": 1},
+					"message": {"type": "string", "minLength": 1}
+				}
+			}
+		}
+	}
+}`)
+
+// Instructions describes the response format to the model
+func Instructions() string {
+	return `=== OUTPUT FORMAT ===
+Respond with a single JSON object and nothing else:
+
+{"findings": [{"start_line": 12, "end_line": 14, "severity": "warning", "category": "error-handling", "message": "..."}]}
+
+Rules:
+- Line numbers refer to the numbered lines of the file under review
+- severity is "error" (bugs, security holes, data loss), "warning" (likely problems) or "note" (suggestions)
+- category is one short lowercase word or hyphenated phrase, e.g. bug, security, performance, error-handling, maintainability
+- message says what is wrong and how to fix it, in one or two sentences
+- Report each issue once; return {"findings": []} if there is nothing worth reporting`
+}
+
+// Parse reads the findings of one review response for the file at path,
+// which has lineCount lines. Anything that doesn't match the schema is an
+// error.
+func Parse(response, path string, lineCount int) ([]types.Finding, error) {
+	_, data, err := findingsSchema.DecodeObject(response)
+	if err != nil {
+		return nil, err
+	}
+	var parsed struct {
+		Findings []types.Finding `json:"findings"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	findings := parsed.Findings
+	for i := range findings {
+		f := &findings[i]
+		if f.EndLine < f.StartLine {
+			return nil, fmt.Errorf("finding %d: end_line %d is before start_line %d", i+1, f.EndLine, f.StartLine)
+		}
+		if f.StartLine > lineCount {
+			return nil, fmt.Errorf("finding %d: line %d is past the end of the file (%d lines)", i+1, f.StartLine, lineCount)
+		}
+		f.EndLine = min(f.EndLine, lineCount)
+		f.Path = path
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].StartLine < findings[j].StartLine
+	})
+	return findings, nil
+}
+
+// Collect gathers the findings of a run in file order
+func Collect(results []*types.ProcessingResult) []types.Finding {
+	var findings []types.Finding
+	for _, result := range results {
+		findings = append(findings, result.Findings...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Path < findings[j].Path
+	})
+	return findings
+}
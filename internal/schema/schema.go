@@ -0,0 +1,300 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxErrors caps how many violations one validation reports
+const maxErrors = 10
+
+// Schema is the subset of JSON Schema that model responses are checked
+// against: types, object properties, required keys, arrays, enums and
+// numeric and length bounds. Unsupported keywords are ignored.
+type Schema struct {
+	Type                 Types              `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+
+	// Order lists the property names as they appear in the schema document
+	Order []string `json:"-"`
+}
+
+// UnmarshalJSON decodes a schema and records the order of its properties
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var aux struct {
+		plain
+		RawProperties json.RawMessage `json:"properties,omitempty"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	*s = Schema(aux.plain)
+
+	if len(aux.RawProperties) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(aux.RawProperties, &s.Properties); err != nil {
+		return err
+	}
+	order, err := objectKeys(aux.RawProperties)
+	if err != nil {
+		return err
+	}
+	s.Order = order
+	return nil
+}
+
+// objectKeys returns the keys of a JSON object in document order
+func objectKeys(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("properties must be an object")
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, tok.(string))
+
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// Types is the "type" keyword, which may be one name or a list of names
+type Types []string
+
+// UnmarshalJSON accepts both "string" and ["string", "null"]
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = list
+	return nil
+}
+
+// MarshalJSON writes a single type as a plain string
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// Parse reads a schema from JSON
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &s, nil
+}
+
+// MustParse is Parse for schemas built into the program
+func MustParse(data string) *Schema {
+	s, err := Parse([]byte(data))
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Decode parses a JSON document and validates it against s
+func (s *Schema) Decode(data []byte) (any, error) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the value")
+	}
+	return v, s.Validate(v)
+}
+
+// DecodeObject finds the JSON object in a model response and validates it
+// against s. A stray code fence or text around the object is tolerated. It
+// returns the decoded value and the object's JSON, for unmarshaling into a
+// struct.
+func (s *Schema) DecodeObject(response string) (any, []byte, error) {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return nil, nil, fmt.Errorf("response contains no JSON object")
+	}
+	data := []byte(response[start : end+1])
+
+	v, err := s.Decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, data, nil
+}
+
+// Validate checks a decoded JSON value against s. The error lists every
+// violation found, up to a limit, each prefixed with its location.
+func (s *Schema) Validate(v any) error {
+	var problems []string
+	s.check(v, "$", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	if len(problems) > maxErrors {
+		problems = append(problems[:maxErrors], fmt.Sprintf("... and %d more", len(problems)-maxErrors))
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func (s *Schema) check(v any, path string, problems *[]string) {
+	fail := func(format string, args ...any) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Type) > 0 && !s.Type.allows(v) {
+		fail("expected %s, got %s", strings.Join(s.Type, " or "), typeOf(v))
+		return
+	}
+
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		fail("must be one of %s", enumList(s.Enum))
+	}
+
+	switch value := v.(type) {
+	case map[string]any:
+		for _, key := range s.Required {
+			if _, ok := value[key]; !ok {
+				fail("missing required property %q", key)
+			}
+		}
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := s.Properties[key]; ok {
+				prop.check(value[key], path+"."+key, problems)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				fail("unexpected property %q", key)
+			}
+		}
+
+	case []any:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range value {
+				s.Items.check(item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+
+	case string:
+		n := len([]rune(value))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+
+	case float64:
+		if s.Minimum != nil && value < *s.Minimum {
+			fail("must be at least %g", *s.Minimum)
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			fail("must be at most %g", *s.Maximum)
+		}
+	}
+}
+
+// allows reports whether v has one of the listed types
+func (t Types) allows(v any) bool {
+	for _, name := range t {
+		switch name {
+		case "integer":
+			if n, ok := v.(float64); ok && n == math.Trunc(n) {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		default:
+			if typeOf(v) == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Schema) inEnum(v any) bool {
+	for _, allowed := range s.Enum {
+		if reflect.DeepEqual(allowed, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf names the JSON type of a decoded value
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func enumList(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		data, _ := json.Marshal(v)
+		parts[i] = string(data)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,38 @@
+package schema
+
+import "testing"
+
+func TestDecodeObject(t *testing.T) {
+	s := MustParse(`{"type": "object", "properties": {"name": {"type": "string"}}, "required": ["name"]}`)
+
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{"bare object", `{"name": "presto"}`, false},
+		{"code fence", "```json\n{\"name\": \"presto\"}\n```", false},
+		{"surrounding text", "Here it is: {\"name\": \"presto\"} Done.", false},
+		{"no object", "I could not find anything.", true},
+		{"schema violation", `{"name": 42}`, true},
+		{"missing key", `{}`, true},
+		{"two objects", `{"name": "a"} {"name": "b"}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, data, err := s.DecodeObject(tt.response)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeObject: %v", err)
+			}
+			if v.(map[string]any)["name"] != "presto" || string(data) != `{"name": "presto"}` {
+				t.Errorf("got %v from %s", v, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// Value is one selected string value
+type Value struct {
+	Path Path
+	Text string
+
+	start, end int // Byte span of the literal in the source
+
+	node   *yaml.Node // YAML
+	indent int        // YAML: indentation of a block scalar's lines
+	flow   bool       // YAML: inside a flow collection, where block scalars can't go
+}
+
+// Document is a parsed JSON or YAML file whose selected string values can
+// be replaced without touching anything else
+type Document struct {
+	lang    types.Language
+	content string
+	match   func(Path) bool
+	values  []*Value
+}
+
+// Supported reports whether documents of lang can be loaded
+func Supported(lang types.Language) bool {
+	return lang == types.LangJSON || lang == types.LangYAML
+}
+
+// Load parses content and collects the string values any selector matches,
+// in document order. Numbers, booleans and nulls are never selected.
+func Load(content string, lang types.Language, selectors []*Selector) (*Document, error) {
+	d := &Document{lang: lang, content: content}
+	d.match = func(path Path) bool {
+		for _, s := range selectors {
+			if s.Match(path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var err error
+	switch lang {
+	case types.LangJSON:
+		err = d.loadJSON(d.match)
+	case types.LangYAML:
+		err = d.loadYAML()
+	default:
+		err = fmt.Errorf("%s files have no structure to select from", lang)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Values returns the selected values
+func (d *Document) Values() []*Value {
+	return d.values
+}
+
+// loadJSON collects the selected strings of a JSON document with their
+// byte spans, so they can be replaced in place
+func (d *Document) loadJSON(match func(Path) bool) error {
+	return walkJSON(d.content, func(path Path, start, end int, tok json.Token) {
+		if text, ok := tok.(string); ok && match(path) {
+			d.values = append(d.values, &Value{Path: path, Text: text, start: start, end: end})
+		}
+	})
+}
+
+// Span is where a JSON value of any kind sits in its document
+type Span struct {
+	Path       Path
+	Start, End int
+}
+
+// Spans finds the byte spans of the JSON values sel matches, objects and
+// arrays included, in document order
+func Spans(content string, sel *Selector) ([]Span, error) {
+	var spans []Span
+	err := walkJSON(content, func(path Path, start, end int, _ json.Token) {
+		if sel.Match(path) {
+			spans = append(spans, Span{Path: path, Start: start, End: end})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	return spans, nil
+}
+
+// walkJSON walks the tokens of a JSON document and calls visit with the
+// path and byte span of every value. Objects and arrays are visited when
+// they close, with a nil token.
+func walkJSON(content string, visit func(path Path, start, end int, tok json.Token)) error {
+	type frame struct {
+		object    bool
+		expectKey bool
+		key       string
+		index     int
+		path      Path // Of the object or array itself
+		start     int
+	}
+	var stack []*frame
+	path := func() Path {
+		p := make(Path, len(stack))
+		for i, f := range stack {
+			if f.object {
+				p[i] = Elem{Key: f.key, IsKey: true}
+			} else {
+				p[i] = Elem{Index: f.index}
+			}
+		}
+		return p
+	}
+	// Between tokens there is only whitespace and separators
+	valueStart := func(offset int) int {
+		for offset < len(content) && strings.IndexByte(" \t\r\n:,", content[offset]) >= 0 {
+			offset++
+		}
+		return offset
+	}
+	afterValue := func() {
+		if len(stack) == 0 {
+			return
+		}
+		if top := stack[len(stack)-1]; top.object {
+			top.expectKey = true
+		} else {
+			top.index++
+		}
+	}
+	closeFrame := func(end int) {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		visit(top.path, top.start, end, nil)
+		afterValue()
+	}
+
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	for {
+		before := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			if len(stack) > 0 {
+				return fmt.Errorf("invalid JSON: unexpected end of input")
+			}
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		end := int(dec.InputOffset())
+
+		if len(stack) > 0 {
+			if top := stack[len(stack)-1]; top.object && top.expectKey {
+				if tok == json.Delim('}') {
+					closeFrame(end)
+				} else {
+					top.key, top.expectKey = tok.(string), false
+				}
+				continue
+			}
+		}
+
+		switch t := tok.(type) {
+		case json.Delim:
+			switch t {
+			case '{', '[':
+				stack = append(stack, &frame{object: t == '{', expectKey: t == '{', path: path(), start: valueStart(before)})
+			default:
+				closeFrame(end)
+			}
+		default:
+			visit(path(), valueStart(before), end, tok)
+			afterValue()
+		}
+	}
+	return nil
+}
+
+// Apply replaces the selected values with texts, in the order of Values,
+// and renders the document. Only the selected literals change; the rest of
+// the file is kept byte for byte.
+func (d *Document) Apply(texts []string) (string, error) {
+	if len(texts) != len(d.values) {
+		return "", fmt.Errorf("got %d values for %d selected", len(texts), len(d.values))
+	}
+
+	want := make([]string, len(texts))
+	rendered := make([]string, len(texts))
+	for i, v := range d.values {
+		if d.lang == types.LangJSON {
+			want[i], rendered[i] = texts[i], quoteJSON(texts[i])
+		} else {
+			want[i] = keepChomping(v, texts[i])
+			rendered[i] = d.renderYAML(v, want[i])
+		}
+	}
+
+	// Splice from the end so earlier spans stay valid
+	order := make([]int, len(d.values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return d.values[order[a]].start > d.values[order[b]].start })
+	out := d.content
+	for _, i := range order {
+		v := d.values[i]
+		out = out[:v.start] + rendered[i] + out[v.end:]
+	}
+
+	if d.lang == types.LangYAML {
+		if err := d.verifyYAML(out, want); err != nil {
+			return "", err
+		}
+	}
+	return out, nil
+}
+
+// quoteJSON renders s as a JSON string literal, leaving HTML characters as
+// they are
+func quoteJSON(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
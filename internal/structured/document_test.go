@@ -0,0 +1,232 @@
+package structured
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func load(t *testing.T, content string, lang types.Language, exprs ...string) *Document {
+	t.Helper()
+	var selectors []*Selector
+	for _, expr := range exprs {
+		sel, err := ParseSelector(expr)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", expr, err)
+		}
+		selectors = append(selectors, sel)
+	}
+	doc, err := Load(content, lang, selectors)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return doc
+}
+
+func texts(doc *Document) []string {
+	var out []string
+	for _, v := range doc.Values() {
+		out = append(out, v.Text)
+	}
+	return out
+}
+
+func TestSpans(t *testing.T) {
+	content := `{"a": {"b": [1, {"c": "x"}], "d": true}, "e": "y"}`
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"$.a", []string{`{"b": [1, {"c": "x"}], "d": true}`}},
+		{"$.a.b", []string{`[1, {"c": "x"}]`}},
+		{"$.a.b[*]", []string{`1`, `{"c": "x"}`}},
+		{"$..c", []string{`"x"`}},
+		{"$.*", []string{`{"b": [1, {"c": "x"}], "d": true}`, `"y"`}},
+		{"$.missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			sel, err := ParseSelector(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spans, err := Spans(content, sel)
+			if err != nil {
+				t.Fatalf("Spans: %v", err)
+			}
+			var got []string
+			for _, s := range spans {
+				got = append(got, content[s.Start:s.End])
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpansInvalidJSON(t *testing.T) {
+	sel, _ := ParseSelector("$.a")
+	if _, err := Spans(`{"a": `, sel); err == nil {
+		t.Error("expected an error for truncated JSON")
+	}
+}
+
+func TestApplyJSON(t *testing.T) {
+	content := "{\n  \"name\": \"old\",\n  \"count\": 3,\n  \"items\": [\"a\", \"b\"], \"html\": \"<b>\"\n}\n"
+	doc := load(t, content, types.LangJSON, "$.name", "$.items[1]", "$.count")
+	if got := strings.Join(texts(doc), ","); got != "old,b" {
+		t.Fatalf("selected %q; numbers must not be selected", got)
+	}
+	out, err := doc.Apply([]string{"new \"quoted\" <i>", "B"})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want := "{\n  \"name\": \"new \\\"quoted\\\" <i>\",\n  \"count\": 3,\n  \"items\": [\"a\", \"B\"], \"html\": \"<b>\"\n}\n"
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestApplyCount(t *testing.T) {
+	doc := load(t, `{"a": "x"}`, types.LangJSON, "$.a")
+	if _, err := doc.Apply(nil); err == nil {
+		t.Error("expected an error for a missing value")
+	}
+}
+
+func TestApplyYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		expr    string
+		texts   []string
+		want    string
+	}{
+		{
+			name:    "plain keeps comments and layout",
+			content: "# Config\nname: old   # trailing\nport: 8080\nlist:\n    - x\n",
+			expr:    "$.name",
+			texts:   []string{"new"},
+			want:    "# Config\nname: new   # trailing\nport: 8080\nlist:\n    - x\n",
+		},
+		{
+			name:    "plain that needs quotes",
+			content: "a: old\nb: 1\n",
+			expr:    "$.a",
+			texts:   []string{"key: value #1"},
+			want:    "a: \"key: value #1\"\nb: 1\n",
+		},
+		{
+			name:    "plain that would read as a number",
+			content: "version: v1\n",
+			expr:    "$.version",
+			texts:   []string{"2"},
+			want:    "version: \"2\"\n",
+		},
+		{
+			name:    "single quoted",
+			content: "a: 'it''s'\n",
+			expr:    "$.a",
+			texts:   []string{"don't"},
+			want:    "a: 'don''t'\n",
+		},
+		{
+			name:    "double quoted",
+			content: "a: \"x\\ty\" # c\nb: z\n",
+			expr:    "$.a",
+			texts:   []string{"tab\there"},
+			want:    "a: \"tab\\there\" # c\nb: z\n",
+		},
+		{
+			name:    "literal block",
+			content: "a: |\n  line one\n  line two\nb: x\n",
+			expr:    "$.a",
+			texts:   []string{"first\nsecond\nthird"},
+			want:    "a: |\n  first\n  second\n  third\nb: x\n",
+		},
+		{
+			name:    "folded block",
+			content: "a: >-\n    some folded\n    text\nb: x\n",
+			expr:    "$.a",
+			texts:   []string{"short"},
+			want:    "a: >-\n    short\nb: x\n",
+		},
+		{
+			name:    "plain becomes a block",
+			content: "a:\n  desc: one line\n  n: 1\n",
+			expr:    "$.a.desc",
+			texts:   []string{"two\nlines"},
+			want:    "a:\n  desc: |-\n    two\n    lines\n  n: 1\n",
+		},
+		{
+			name:    "multi-line plain",
+			content: "a: a long\n  folded value\nb: x\n",
+			expr:    "$.a",
+			texts:   []string{"short"},
+			want:    "a: short\nb: x\n",
+		},
+		{
+			name:    "sequence items and anchors",
+			content: "items:\n  - &first one\n  - 'two'\nref: *first\n",
+			expr:    "$.items[*]",
+			texts:   []string{"uno", "dos"},
+			want:    "items:\n  - &first uno\n  - 'dos'\nref: *first\n",
+		},
+		{
+			name:    "flow collection",
+			content: "tags: [alpha, \"beta\"]\n",
+			expr:    "$.tags[*]",
+			texts:   []string{"a, b", "c"},
+			want:    "tags: [\"a, b\", \"c\"]\n",
+		},
+		{
+			name:    "several documents",
+			content: "---\nname: a\n---\nname: b\n",
+			expr:    "$.name",
+			texts:   []string{"A", "B"},
+			want:    "---\nname: A\n---\nname: B\n",
+		},
+		{
+			name:    "crlf",
+			content: "a: |\r\n  x\r\n  y\r\nb: old\r\n",
+			expr:    "$..*",
+			texts:   []string{"1\n2\n3\n", "new"},
+			want:    "a: |\r\n  1\r\n  2\r\n  3\r\nb: new\r\n",
+		},
+		{
+			name:    "block at the end without a newline",
+			content: "a: x\nb: |\n  one\n  two",
+			expr:    "$.b",
+			texts:   []string{"three"},
+			want:    "a: x\nb: |-\n  three",
+		},
+		{
+			name:    "block in a sequence keeps its final newline",
+			content: "steps:\n  - run: |\n      make\n      make test\n  - name: done\n",
+			expr:    "$.steps[0].run",
+			texts:   []string{"go build\ngo test"},
+			want:    "steps:\n  - run: |\n      go build\n      go test\n  - name: done\n",
+		},
+		{
+			name:    "non-ascii column",
+			content: "{ü: ä, k: old}\n",
+			expr:    "$.k",
+			texts:   []string{"new"},
+			want:    "{ü: ä, k: new}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := load(t, tt.content, types.LangYAML, tt.expr)
+			out, err := doc.Apply(tt.texts)
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if out != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", out, tt.want)
+			}
+		})
+	}
+}
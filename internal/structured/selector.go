@@ -0,0 +1,214 @@
+package structured
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Elem is one step of a value's location: an object key or an array index
+type Elem struct {
+	Key   string
+	Index int
+	IsKey bool
+}
+
+// Path is the location of a value in a document
+type Path []Elem
+
+// String renders p as a JSONPath, e.g. $.services[0].description
+func (p Path) String() string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, e := range p {
+		switch {
+		case !e.IsKey:
+			fmt.Fprintf(&b, "[%d]", e.Index)
+		case isIdentifier(e.Key):
+			b.WriteString("." + e.Key)
+		default:
+			b.WriteString("[" + strconv.Quote(e.Key) + "]")
+		}
+	}
+	return b.String()
+}
+
+// step is one part of a selector
+type step struct {
+	descend  bool // ".." matches at any depth below
+	wildcard bool // "*" or "[*]"
+	key      string
+	index    int
+	isKey    bool
+}
+
+// Selector is a JSONPath subset: $ for the root, .key or ['key'] for an
+// object member, [n] for an array element, * or [*] for any member or
+// element, and .. to match at any depth. "$..description" selects every
+// description field. A selector without the leading $ starts at the root.
+type Selector struct {
+	expr  string
+	steps []step
+}
+
+// ParseSelector reads a selector expression
+func ParseSelector(expr string) (*Selector, error) {
+	s := strings.TrimSpace(expr)
+	if s == "" {
+		return nil, fmt.Errorf("empty selector")
+	}
+	if strings.HasPrefix(s, "$") {
+		s = s[1:]
+	} else if !strings.HasPrefix(s, ".") && !strings.HasPrefix(s, "[") {
+		s = "." + s
+	}
+
+	sel := &Selector{expr: expr}
+	for s != "" {
+		var st step
+		switch {
+		case strings.HasPrefix(s, ".."):
+			st.descend = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				break
+			}
+			name, rest := cutName(s)
+			if name == "" {
+				return nil, fmt.Errorf("invalid selector %q: expected a name after ..", expr)
+			}
+			st.setName(name)
+			s = rest
+			sel.steps = append(sel.steps, st)
+			continue
+		case strings.HasPrefix(s, "."):
+			name, rest := cutName(s[1:])
+			if name == "" {
+				return nil, fmt.Errorf("invalid selector %q: expected a name after .", expr)
+			}
+			st.setName(name)
+			s = rest
+			sel.steps = append(sel.steps, st)
+			continue
+		case !strings.HasPrefix(s, "["):
+			return nil, fmt.Errorf("invalid selector %q at %q", expr, s)
+		}
+
+		// Bracket step, possibly after ".."
+		end := bracketEnd(s)
+		if end < 0 {
+			return nil, fmt.Errorf("invalid selector %q: unclosed [", expr)
+		}
+		inner := strings.TrimSpace(s[1:end])
+		s = s[end+1:]
+		switch {
+		case inner == "*":
+			st.wildcard = true
+		case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+			st.key, st.isKey = inner[1:len(inner)-1], true
+		default:
+			n, err := strconv.Atoi(inner)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid selector %q: bad index [%s]", expr, inner)
+			}
+			st.index = n
+		}
+		sel.steps = append(sel.steps, st)
+	}
+	if len(sel.steps) == 0 {
+		return nil, fmt.Errorf("selector %q selects the whole document", expr)
+	}
+	return sel, nil
+}
+
+// MustParseSelector is ParseSelector for selectors built into the program
+func MustParseSelector(expr string) *Selector {
+	sel, err := ParseSelector(expr)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+func (st *step) setName(name string) {
+	if name == "*" {
+		st.wildcard = true
+		return
+	}
+	st.key, st.isKey = name, true
+}
+
+// String returns the expression the selector was parsed from
+func (s *Selector) String() string {
+	return s.expr
+}
+
+// Match reports whether the value at path is selected
+func (s *Selector) Match(path Path) bool {
+	return matchSteps(s.steps, path)
+}
+
+func matchSteps(steps []step, path Path) bool {
+	if len(steps) == 0 {
+		return len(path) == 0
+	}
+	st := steps[0]
+	if st.descend {
+		for i := range path {
+			if st.matches(path[i]) && matchSteps(steps[1:], path[i+1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	return len(path) > 0 && st.matches(path[0]) && matchSteps(steps[1:], path[1:])
+}
+
+func (st step) matches(e Elem) bool {
+	if st.wildcard {
+		return true
+	}
+	if st.isKey {
+		return e.IsKey && e.Key == st.key
+	}
+	return !e.IsKey && e.Index == st.index
+}
+
+// cutName splits a member name off the front of s
+func cutName(s string) (string, string) {
+	i := strings.IndexAny(s, ".[")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// bracketEnd finds the ] closing the [ at the start of s, skipping quotes
+func bracketEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r != '_' && r != '-' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && (i == 0 || !('0' <= r && r <= '9')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package structured
+
+import "testing"
+
+func key(k string) Elem { return Elem{Key: k, IsKey: true} }
+func index(i int) Elem  { return Elem{Index: i} }
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		expr  string
+		match []Path
+		miss  []Path
+	}{
+		{"$.name", []Path{{key("name")}}, []Path{{key("other")}, {key("name"), key("x")}}},
+		{"name", []Path{{key("name")}}, []Path{{key("a"), key("name")}}},
+		{"$.services[0].description",
+			[]Path{{key("services"), index(0), key("description")}},
+			[]Path{{key("services"), index(1), key("description")}}},
+		{"$.services[*].description",
+			[]Path{{key("services"), index(3), key("description")}},
+			[]Path{{key("services"), key("x"), key("y")}}},
+		{"$.a.*", []Path{{key("a"), key("b")}, {key("a"), index(2)}}, []Path{{key("a")}, {key("a"), key("b"), key("c")}}},
+		{"$..description",
+			[]Path{{key("description")}, {key("a"), index(1), key("description")}},
+			[]Path{{key("description"), key("x")}}},
+		{"$..[0]", []Path{{key("a"), index(0)}}, []Path{{key("a"), index(1)}}},
+		{"$['odd key'].x", []Path{{key("odd key"), key("x")}}, []Path{{key("odd"), key("x")}}},
+		{`$["a.b"]`, []Path{{key("a.b")}}, []Path{{key("a"), key("b")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			sel, err := ParseSelector(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseSelector: %v", err)
+			}
+			for _, p := range tt.match {
+				if !sel.Match(p) {
+					t.Errorf("%s does not match %s", tt.expr, p)
+				}
+			}
+			for _, p := range tt.miss {
+				if sel.Match(p) {
+					t.Errorf("%s matches %s", tt.expr, p)
+				}
+			}
+		})
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, expr := range []string{"", "$", "$.", "$..", "$.a[", "$.a[-1]", "$.a[x]", "$a"} {
+		if _, err := ParseSelector(expr); err == nil {
+			t.Errorf("ParseSelector(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestPathString(t *testing.T) {
+	p := Path{key("services"), index(0), key("odd key")}
+	if got, want := p.String(), `$.services[0]["odd key"]`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,373 @@
+package structured
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loadYAML collects the selected strings of every document of a YAML
+// stream with the byte spans of their literals, so they can be replaced in
+// place like JSON strings
+func (d *Document) loadYAML() error {
+	lines := lineStarts(d.content)
+	indent := yamlIndent(d.content)
+
+	dec := yaml.NewDecoder(strings.NewReader(d.content))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid YAML: %w", err)
+		}
+		if len(doc.Content) > 0 {
+			if err := d.walkYAML(doc.Content[0], nil, 0, false, lines, indent); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkYAML collects the selected scalars below node. indent is how far a
+// block scalar at node would indent its lines; flow is set inside flow
+// collections.
+func (d *Document) walkYAML(node *yaml.Node, path Path, indent int, flow bool, lines []int, width int) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		flow = flow || node.Style&yaml.FlowStyle != 0
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			child := append(path[:len(path):len(path)], Elem{Key: key.Value, IsKey: true})
+			if err := d.walkYAML(node.Content[i+1], child, key.Column-1+width, flow, lines, width); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		flow = flow || node.Style&yaml.FlowStyle != 0
+		for i, item := range node.Content {
+			child := append(path[:len(path):len(path)], Elem{Index: i})
+			if err := d.walkYAML(item, child, item.Column-1, flow, lines, width); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		// Aliases are left alone; their anchor is selected where it's defined
+		if node.ShortTag() != "!!str" || !d.match(path) {
+			return nil
+		}
+		v := &Value{Path: path, Text: node.Value, node: node, indent: indent, flow: flow}
+		if !d.locateYAML(v, lines) {
+			return fmt.Errorf("%s: cannot locate the value in the file to replace it in place", path)
+		}
+		d.values = append(d.values, v)
+	}
+	return nil
+}
+
+// locateYAML finds the byte span of a scalar's literal from its position,
+// which yaml.v3 gives as a line and a column counted in characters
+func (d *Document) locateYAML(v *Value, lines []int) bool {
+	node := v.node
+	if node.Line < 1 || node.Line > len(lines) {
+		return false
+	}
+	start := lines[node.Line-1]
+	for col := 1; col < node.Column && start < len(d.content); col++ {
+		_, size := utf8.DecodeRuneInString(d.content[start:])
+		start += size
+	}
+	// The position includes an anchor or tag in front of the value
+	for start < len(d.content) && (d.content[start] == '&' || d.content[start] == '!') {
+		for start < len(d.content) && !isYAMLSpace(d.content[start]) {
+			start++
+		}
+		for start < len(d.content) && isYAMLSpace(d.content[start]) {
+			start++
+		}
+	}
+
+	end := -1
+	switch {
+	case node.Style&yaml.DoubleQuotedStyle != 0:
+		end = quotedEnd(d.content, start, '"')
+	case node.Style&yaml.SingleQuotedStyle != 0:
+		end = quotedEnd(d.content, start, '\'')
+	case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		end = d.blockEnd(v, start)
+	default:
+		end = plainEnd(d.content, start, node.Value, v.flow)
+	}
+	if end < 0 {
+		return false
+	}
+	v.start, v.end = start, end
+	return true
+}
+
+// quotedEnd returns the offset just past the closing quote of the quoted
+// scalar at start, or -1
+func quotedEnd(content string, start int, quote byte) int {
+	if start >= len(content) || content[start] != quote {
+		return -1
+	}
+	for i := start + 1; i < len(content); i++ {
+		switch {
+		case quote == '"' && content[i] == '\\':
+			i++
+		case content[i] == quote:
+			// '' is an escaped quote inside single quotes
+			if quote == '\'' && i+1 < len(content) && content[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// blockEnd returns the end of the last content line of the block scalar
+// whose header starts at start, and records the indentation of its lines.
+// The first content line sets the indentation; a line indented less ends
+// the scalar.
+func (d *Document) blockEnd(v *Value, start int) int {
+	content := d.content
+	if start >= len(content) || (content[start] != '|' && content[start] != '>') {
+		return -1
+	}
+	end := start + strings.IndexAny(content[start:]+" ", " \t\r\n")
+	if strings.Trim(v.Text, "\n") == "" {
+		return end // Only the header; there are no content lines to replace
+	}
+
+	indent := -1
+	header := strings.IndexByte(content[start:], '\n')
+	if header < 0 {
+		return -1
+	}
+	for pos := start + header + 1; pos < len(content); {
+		lineEnd := len(content)
+		if i := strings.IndexByte(content[pos:], '\n'); i >= 0 {
+			lineEnd = pos + i
+		}
+		line := strings.TrimRight(content[pos:lineEnd], "\r")
+		if text := strings.TrimLeft(line, " "); text != "" {
+			n := len(line) - len(text)
+			if indent < 0 {
+				indent = n
+			}
+			if n < indent {
+				break
+			}
+			end = pos + len(line)
+		}
+		pos = lineEnd + 1
+	}
+	if indent < 0 {
+		return -1
+	}
+	v.indent = indent
+	return end
+}
+
+// plainEnd returns the end of the plain scalar at start whose value is
+// value. A plain scalar may run over several lines, which fold into one.
+func plainEnd(content string, start int, value string, flow bool) int {
+	lineEnd := func(pos int) int {
+		if i := strings.IndexByte(content[pos:], '\n'); i >= 0 {
+			return pos + i
+		}
+		return len(content)
+	}
+	// trimLine returns the end of the scalar's text on the line at pos
+	trimLine := func(pos int) int {
+		end := lineEnd(pos)
+		if i := strings.Index(content[pos:end], " #"); i >= 0 {
+			end = pos + i
+		}
+		if flow {
+			if i := strings.IndexAny(content[pos:end], ",]}"); i >= 0 {
+				end = pos + i
+			}
+		}
+		for end > pos && (isYAMLSpace(content[end-1]) || content[end-1] == '\r') {
+			end--
+		}
+		return end
+	}
+
+	end := trimLine(start)
+	folded := content[start:end]
+	breaks := 0
+	for pos := lineEnd(start) + 1; folded != value && len(folded) < len(value) && pos < len(content); pos = lineEnd(pos) + 1 {
+		textStart := pos
+		for textStart < len(content) && isYAMLSpace(content[textStart]) {
+			textStart++
+		}
+		textEnd := trimLine(textStart)
+		if textEnd == textStart {
+			breaks++
+			continue
+		}
+		if breaks > 0 {
+			folded += strings.Repeat("\n", breaks)
+		} else {
+			folded += " "
+		}
+		breaks = 0
+		folded += content[textStart:textEnd]
+		end = textEnd
+	}
+	if folded != value {
+		return -1
+	}
+	return end
+}
+
+// keepChomping ends a new value with a newline where the original block
+// scalar had one: models rarely end their answers with one
+func keepChomping(v *Value, text string) string {
+	if strings.HasSuffix(v.Text, "\n") && !strings.HasSuffix(text, "\n") {
+		return text + "\n"
+	}
+	return text
+}
+
+// renderYAML writes text as the literal of v, in v's style where the text
+// allows it. Multi-line text becomes a literal block scalar.
+func (d *Document) renderYAML(v *Value, text string) string {
+	style := v.node.Style
+	multiline := strings.Contains(strings.TrimSuffix(text, "\n"), "\n")
+	block := style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0
+
+	if (block || multiline) && !v.flow && d.blockAllowed(v, text) {
+		return d.blockScalar(v, text, style&yaml.FoldedStyle != 0 && !multiline)
+	}
+	switch {
+	case strings.Contains(text, "\n"):
+	case style&yaml.SingleQuotedStyle != 0:
+		return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+	case style&yaml.DoubleQuotedStyle == 0 && plainSafe(text, v.flow):
+		return text
+	}
+	// JSON strings are valid double-quoted YAML scalars
+	return quoteJSON(text)
+}
+
+// blockAllowed reports whether text can be written as a block scalar in
+// place of v: its lines must not start with spaces, which would need an
+// indentation indicator, and nothing may follow v on its line
+func (d *Document) blockAllowed(v *Value, text string) bool {
+	if strings.TrimSpace(text) == "" || strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+		return false
+	}
+	rest := d.content[v.end:]
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[:i]
+	}
+	return strings.TrimSpace(rest) == ""
+}
+
+// blockScalar renders text as a literal block scalar, or a folded one if
+// folded is set, with the chomping indicator that keeps its final newlines
+func (d *Document) blockScalar(v *Value, text string, folded bool) string {
+	header := "|"
+	if folded {
+		header = ">"
+	}
+	body := strings.TrimRight(text, "\n")
+	switch trailing := len(text) - len(body); {
+	case trailing == 0:
+		header += "-"
+	case trailing > 1:
+		header += "+"
+		body = text[:len(text)-1]
+	}
+
+	newline := "\n"
+	if strings.Contains(d.content, "\r\n") {
+		newline = "\r\n"
+	}
+	indent := strings.Repeat(" ", max(v.indent, 1))
+	var b strings.Builder
+	b.WriteString(header)
+	for _, line := range strings.Split(body, "\n") {
+		b.WriteString(newline)
+		if line != "" {
+			b.WriteString(indent + line)
+		}
+	}
+	return b.String()
+}
+
+// plainSafe reports whether text reads back as the same string when
+// written without quotes
+func plainSafe(text string, flow bool) bool {
+	if text == "" || strings.TrimSpace(text) != text || strings.Contains(text, ": ") || strings.Contains(text, " #") {
+		return false
+	}
+	if flow && strings.ContainsAny(text, ",[]{}") {
+		return false
+	}
+	var v any
+	if err := yaml.Unmarshal([]byte(text), &v); err != nil {
+		return false
+	}
+	s, ok := v.(string)
+	return ok && s == text
+}
+
+// verifyYAML checks that the edited document parses and holds the new
+// values where the old ones were
+func (d *Document) verifyYAML(out string, texts []string) error {
+	edited := &Document{lang: d.lang, content: out, match: d.match}
+	if err := edited.loadYAML(); err != nil {
+		return fmt.Errorf("edited YAML doesn't read back: %w", err)
+	}
+	if len(edited.values) != len(texts) {
+		return fmt.Errorf("edited YAML doesn't read back: %d values selected, want %d", len(edited.values), len(texts))
+	}
+	for i, v := range edited.values {
+		if v.Text != texts[i] {
+			return fmt.Errorf("edited YAML doesn't read back: %s is %q, want %q", v.Path, v.Text, texts[i])
+		}
+	}
+	return nil
+}
+
+// lineStarts returns the byte offset at which each line starts
+func lineStarts(content string) []int {
+	starts := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func isYAMLSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// yamlIndent guesses the indentation width of a YAML file from its first
+// indented line
+func yamlIndent(content string) int {
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n := len(line) - len(trimmed); n > 0 {
+			return n
+		}
+	}
+	return 2
+}
@@ -0,0 +1,294 @@
+package textfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+// sniffLen is how many leading bytes are inspected for binary detection
+const sniffLen = 8000
+
+// utf16StrayZeros is the share of NULs, relative to the expected side, that
+// BOM-less UTF-16 may have on the other side of each code unit
+const utf16StrayZeros = 0.1
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// Info is the result of sniffing a file's content
+type Info struct {
+	Format types.FileFormat
+	Binary bool
+}
+
+// Sniff inspects raw file content and determines whether it is text and,
+// if so, which encoding it uses
+func Sniff(data []byte) Info {
+	// A byte order mark is the strongest signal we can get
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return Info{Format: types.FileFormat{Encoding: types.EncodingUTF8, HasBOM: true}}
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return Info{Format: types.FileFormat{Encoding: types.EncodingUTF16LE, HasBOM: true}}
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return Info{Format: types.FileFormat{Encoding: types.EncodingUTF16BE, HasBOM: true}}
+	}
+
+	sample := data
+	if len(sample) > sniffLen {
+		sample = sample[:sniffLen]
+	}
+
+	// NUL bytes never appear in 8-bit text, but BOM-less UTF-16 is full of them
+	if bytes.IndexByte(sample, 0) >= 0 {
+		if enc, ok := sniffUTF16(sample); ok {
+			return Info{Format: types.FileFormat{Encoding: enc}}
+		}
+		return Info{Binary: true}
+	}
+
+	if utf8.Valid(data) {
+		return Info{Format: types.FileFormat{Encoding: types.EncodingUTF8}}
+	}
+
+	// Not UTF-8: treat as Latin-1 unless it is dominated by control bytes
+	if controlRatio(sample) > 0.1 {
+		return Info{Binary: true}
+	}
+	return Info{Format: types.FileFormat{Encoding: types.EncodingLatin1}}
+}
+
+// SniffFile reads the head of a file and sniffs it
+func SniffFile(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Info{}, err
+	}
+
+	info := Sniff(buf[:n])
+
+	// A truncated sample can end mid-rune; don't mistake that for Latin-1
+	if n == sniffLen && info.Format.Encoding == types.EncodingLatin1 && validUTF8Prefix(buf[:n]) {
+		info.Format.Encoding = types.EncodingUTF8
+	}
+
+	return info, nil
+}
+
+// IsText reports whether the file at path looks like text
+func IsText(path string) bool {
+	info, err := SniffFile(path)
+	return err == nil && !info.Binary
+}
+
+// Decode converts raw file content to a UTF-8 string according to format
+func Decode(data []byte, format types.FileFormat) (string, error) {
+	switch format.Encoding {
+	case types.EncodingUTF8, "":
+		if format.HasBOM {
+			data = bytes.TrimPrefix(data, bomUTF8)
+		}
+		return string(data), nil
+	case types.EncodingUTF16LE, types.EncodingUTF16BE:
+		if format.HasBOM {
+			data = data[2:]
+		}
+		if len(data)%2 != 0 {
+			return "", fmt.Errorf("invalid %s content: odd byte length", format.Encoding)
+		}
+		order := byteOrder(format.Encoding)
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	case types.EncodingLatin1:
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	default:
+		return "", fmt.Errorf("unsupported encoding: %s", format.Encoding)
+	}
+}
+
+// Encode converts a UTF-8 string back to the encoding described by format
+func Encode(content string, format types.FileFormat) ([]byte, error) {
+	switch format.Encoding {
+	case types.EncodingUTF8, "":
+		if format.HasBOM {
+			return append(append([]byte{}, bomUTF8...), content...), nil
+		}
+		return []byte(content), nil
+	case types.EncodingUTF16LE, types.EncodingUTF16BE:
+		order := byteOrder(format.Encoding)
+		units := utf16.Encode([]rune(content))
+
+		var buf bytes.Buffer
+		if format.HasBOM {
+			binary.Write(&buf, order, uint16(0xFEFF))
+		}
+		binary.Write(&buf, order, units)
+		return buf.Bytes(), nil
+	case types.EncodingLatin1:
+		out := make([]byte, 0, len(content))
+		for i, r := range content {
+			if r > 0xFF {
+				return nil, fmt.Errorf("character %q at offset %d cannot be represented in latin-1", r, i)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", format.Encoding)
+	}
+}
+
+// sniffUTF16 guesses BOM-less UTF-16 by where the NUL bytes fall. Mostly-ASCII
+// UTF-16 text has a zero in every other byte. Characters such as U+0100 or
+// many CJK ones put a zero in the other byte too, so a few of those are
+// allowed, up to utf16StrayZeros of the dominant side.
+func sniffUTF16(sample []byte) (types.TextEncoding, bool) {
+	if len(sample) < 2 {
+		return "", false
+	}
+
+	var evenZeros, oddZeros int
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+
+	pairs := len(sample) / 2
+	switch {
+	case oddZeros > pairs/2 && float64(evenZeros) <= float64(oddZeros)*utf16StrayZeros:
+		return types.EncodingUTF16LE, true
+	case evenZeros > pairs/2 && float64(oddZeros) <= float64(evenZeros)*utf16StrayZeros:
+		return types.EncodingUTF16BE, true
+	}
+	return "", false
+}
+
+// controlRatio returns the fraction of bytes that are non-whitespace control characters
+func controlRatio(sample []byte) float64 {
+	if len(sample) == 0 {
+		return 0
+	}
+
+	controls := 0
+	for _, b := range sample {
+		if b < 0x20 && !strings.ContainsRune("\t\n\r\f\b\x1b", rune(b)) {
+			controls++
+		}
+	}
+	return float64(controls) / float64(len(sample))
+}
+
+// validUTF8Prefix reports whether data is valid UTF-8 apart from a rune cut off at the end
+func validUTF8Prefix(data []byte) bool {
+	for trim := 0; trim < utf8.UTFMax && trim < len(data); trim++ {
+		if utf8.Valid(data[:len(data)-trim]) {
+			return true
+		}
+	}
+	return false
+}
+
+func byteOrder(enc types.TextEncoding) binary.ByteOrder {
+	if enc == types.EncodingUTF16BE {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// DetectLineEnding returns the dominant line ending in content, and whether
+// the content mixes CRLF and LF endings
+func DetectLineEnding(content string) (string, bool) {
+	crlf := strings.Count(content, "\r\n")
+	lf := strings.Count(content, "\n") - crlf
+
+	switch {
+	case crlf == 0 && lf == 0:
+		return "", false
+	case crlf > lf:
+		return "\r\n", lf > 0
+	default:
+		return "\n", crlf > 0
+	}
+}
+
+// DetectFormat fills in the line ending and final newline properties of format
+func DetectFormat(content string, format *types.FileFormat) {
+	format.LineEnding, _ = DetectLineEnding(content)
+	format.FinalNewline = strings.HasSuffix(content, "\n")
+}
+
+// Restore rewrites content so its line endings and final newline match the
+// source file's format. It returns the adjusted content along with a
+// description of every change it made.
+func Restore(content string, format types.FileFormat) (string, []string) {
+	var notes []string
+
+	if format.LineEnding != "" {
+		current, mixed := DetectLineEnding(content)
+		if current != "" && (current != format.LineEnding || mixed) {
+			content = strings.ReplaceAll(content, "\r\n", "\n")
+			if format.LineEnding == "\r\n" {
+				content = strings.ReplaceAll(content, "\n", "\r\n")
+			}
+			if mixed {
+				notes = append(notes, fmt.Sprintf("normalized mixed line endings to %s", lineEndingName(format.LineEnding)))
+			} else {
+				notes = append(notes, fmt.Sprintf("converted line endings to %s", lineEndingName(format.LineEnding)))
+			}
+		}
+	}
+
+	hasFinal := strings.HasSuffix(content, "\n")
+	switch {
+	case format.FinalNewline && !hasFinal && content != "":
+		eol := format.LineEnding
+		if eol == "" {
+			eol = "\n"
+		}
+		content += eol
+		notes = append(notes, "restored final newline")
+	case !format.FinalNewline && hasFinal && format.LineEnding != "":
+		content = strings.TrimSuffix(strings.TrimSuffix(content, "\n"), "\r")
+		notes = append(notes, "removed final newline")
+	}
+
+	return content, notes
+}
+
+func lineEndingName(eol string) string {
+	if eol == "\r\n" {
+		return "CRLF"
+	}
+	return "LF"
+}
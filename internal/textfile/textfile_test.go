@@ -0,0 +1,137 @@
+package textfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func utf16Bytes(s string, order binary.ByteOrder, bom bool) []byte {
+	var buf bytes.Buffer
+	if bom {
+		binary.Write(&buf, order, uint16(0xFEFF))
+	}
+	binary.Write(&buf, order, utf16.Encode([]rune(s)))
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		want   types.TextEncoding
+		bom    bool
+		binary bool
+	}{
+		{"utf-8", []byte("hello, wörld\n"), types.EncodingUTF8, false, false},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, "id,name\n"...), types.EncodingUTF8, true, false},
+		{"utf-16le bom", utf16Bytes("hello\n", binary.LittleEndian, true), types.EncodingUTF16LE, true, false},
+		{"utf-16be bom", utf16Bytes("hello\n", binary.BigEndian, true), types.EncodingUTF16BE, true, false},
+		{"utf-16le", utf16Bytes("plain ascii text\n", binary.LittleEndian, false), types.EncodingUTF16LE, false, false},
+		{"utf-16be", utf16Bytes("plain ascii text\n", binary.BigEndian, false), types.EncodingUTF16BE, false, false},
+		// U+0100 and U+2000 have a zero low byte
+		{"utf-16le stray zeros", utf16Bytes("price: 10 €, name: Ādam, more plain text here\n", binary.LittleEndian, false), types.EncodingUTF16LE, false, false},
+		{"utf-16be stray zeros", utf16Bytes("price: 10 €, name: Ādam, more plain text here\n", binary.BigEndian, false), types.EncodingUTF16BE, false, false},
+		{"latin-1", []byte("caf\xe9\n"), types.EncodingLatin1, false, false},
+		{"binary", []byte{0x7f, 'E', 'L', 'F', 0, 0, 1, 2, 0, 3, 0, 0, 0, 9, 4, 0}, "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := Sniff(tt.data)
+			if info.Binary != tt.binary {
+				t.Fatalf("Binary = %v, want %v", info.Binary, tt.binary)
+			}
+			if tt.binary {
+				return
+			}
+			if info.Format.Encoding != tt.want || info.Format.HasBOM != tt.bom {
+				t.Errorf("got %s (bom %v), want %s (bom %v)", info.Format.Encoding, info.Format.HasBOM, tt.want, tt.bom)
+			}
+		})
+	}
+}
+
+func TestDecodeEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"utf-8", []byte("line one\nline two ✓\n")},
+		{"utf-8 bom", append([]byte{0xEF, 0xBB, 0xBF}, "a,b\r\n1,2\r\n"...)},
+		{"utf-16le bom", utf16Bytes("héllo 世界\n", binary.LittleEndian, true)},
+		{"utf-16be", utf16Bytes("hello Ā world\n", binary.BigEndian, false)},
+		{"latin-1", []byte("na\xefve caf\xe9\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := Sniff(tt.data)
+			if info.Binary {
+				t.Fatal("sniffed as binary")
+			}
+			content, err := Decode(tt.data, info.Format)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if strings.HasPrefix(content, "\ufeff") {
+				t.Error("decoded content kept the byte order mark")
+			}
+			out, err := Encode(content, info.Format)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if !bytes.Equal(out, tt.data) {
+				t.Errorf("round trip changed the bytes:\n got %q\nwant %q", out, tt.data)
+			}
+		})
+	}
+}
+
+func TestEncodeLatin1Unrepresentable(t *testing.T) {
+	if _, err := Encode("snow ☃", types.FileFormat{Encoding: types.EncodingLatin1}); err == nil {
+		t.Error("expected an error for a character outside latin-1")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		format    types.FileFormat
+		want      string
+		wantNotes int
+	}{
+		{"unchanged", "a\nb\n", types.FileFormat{LineEnding: "\n", FinalNewline: true}, "a\nb\n", 0},
+		{"to crlf", "a\nb\n", types.FileFormat{LineEnding: "\r\n", FinalNewline: true}, "a\r\nb\r\n", 1},
+		{"to lf", "a\r\nb\r\n", types.FileFormat{LineEnding: "\n", FinalNewline: true}, "a\nb\n", 1},
+		{"mixed", "a\r\nb\nc\r\n", types.FileFormat{LineEnding: "\r\n", FinalNewline: true}, "a\r\nb\r\nc\r\n", 1},
+		{"restore final newline", "a\r\nb", types.FileFormat{LineEnding: "\r\n", FinalNewline: true}, "a\r\nb\r\n", 1},
+		{"remove final newline", "a\nb\n", types.FileFormat{LineEnding: "\n"}, "a\nb", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, notes := Restore(tt.content, tt.format)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if len(notes) != tt.wantNotes {
+				t.Errorf("notes = %v, want %d", notes, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestRestoreRoundTrip(t *testing.T) {
+	original := "first\r\nsecond\r\n"
+	var format types.FileFormat
+	DetectFormat(original, &format)
+
+	// A model answers with LF endings
+	got, _ := Restore(strings.ReplaceAll(original, "\r\n", "\n"), format)
+	if got != original {
+		t.Errorf("got %q, want %q", got, original)
+	}
+}
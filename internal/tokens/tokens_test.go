@@ -0,0 +1,63 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Zachacious/presto/pkg/types"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"empty", "", 0},
+		{"short word", "hello", 1},
+		{"long word in pieces", "internationalization", 3},
+		{"operators merge in pairs", "x := 1\n", 4},
+		{"indentation runs", "\t\treturn", 2},
+		{"non-ASCII letters", "héllo", 3},
+		{"words and spaces", strings.Repeat("a ", 20), 20},
+	}
+	for _, tt := range tests {
+		if got := Count(tt.text, types.ProviderOpenAI); got != tt.want {
+			t.Errorf("%s: Count(%q) = %d, want %d", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCountProviders(t *testing.T) {
+	text := strings.Repeat("a ", 20)
+	tests := []struct {
+		provider types.AIProvider
+		want     int
+	}{
+		{types.ProviderOpenAI, 20},
+		{types.ProviderAnthropic, 22},
+		{types.ProviderLocal, 23},
+		{"", 20},
+	}
+	for _, tt := range tests {
+		if got := Count(text, tt.provider); got != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.provider, got, tt.want)
+		}
+	}
+}
+
+func TestCountAll(t *testing.T) {
+	texts := []string{"hello", "internationalization", "x := 1\n"}
+	for _, provider := range []types.AIProvider{types.ProviderOpenAI, types.ProviderAnthropic, types.ProviderLocal} {
+		want := 0
+		for _, text := range texts {
+			want += Count(text, provider)
+		}
+		if got := CountAll(provider, texts...); got != want {
+			t.Errorf("%q: CountAll = %d, want %d", provider, got, want)
+		}
+	}
+	if got := CountAll(types.ProviderOpenAI); got != 0 {
+		t.Errorf("CountAll of nothing = %d", got)
+	}
+}
@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -116,6 +117,16 @@ func (ui *UI) ProcessingStart(fileCount int, mode types.ProcessingMode, model st
 		modeText = "transform"
 	} else if mode == types.ModeGenerate {
 		modeText = "generate"
+	} else if mode == types.ModeMultiFile {
+		modeText = "multi-file"
+	} else if mode == types.ModeReview {
+		modeText = "review"
+	} else if mode == types.ModeExtract {
+		modeText = "extract"
+	} else if mode == types.ModeClassify {
+		modeText = "classify"
+	} else if mode == types.ModeRecords {
+		modeText = "records"
 	}
 
 	fmt.Printf("📁 Found %s to process\n",
@@ -149,6 +160,35 @@ func (ui *UI) FileSuccess(inputFile, outputFile string, duration time.Duration,
 	)
 }
 
+// FileNormalized lists adjustments made to match the source file's format (only if verbose)
+func (ui *UI) FileNormalized(inputFile string, notes []string) {
+	if !ui.verbose || len(notes) == 0 {
+		return
+	}
+	fmt.Printf("   %s\n", ui.colorize(ColorGray, fmt.Sprintf("🔧 %s: %s", shortenPath(inputFile), strings.Join(notes, ", "))))
+}
+
+// FileContext lists the context a request received (only if verbose)
+func (ui *UI) FileContext(inputFile string, usage []types.ContextUsage) {
+	if !ui.verbose || len(usage) == 0 {
+		return
+	}
+
+	var parts []string
+	dropped := 0
+	for _, u := range usage {
+		if u.Mode == types.ContextDropped {
+			dropped++
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s (%s, %d tokens)", u.Label, u.Mode, u.Tokens))
+	}
+	if dropped > 0 {
+		parts = append(parts, fmt.Sprintf("%d dropped", dropped))
+	}
+	fmt.Printf("   %s\n", ui.colorize(ColorGray, fmt.Sprintf("📎 %s: %s", shortenPath(inputFile), strings.Join(parts, ", "))))
+}
+
 // FileError shows failed file processing
 func (ui *UI) FileError(inputFile string, err error) {
 	ui.StopSpinner()
@@ -167,6 +207,128 @@ func (ui *UI) FileSkipped(inputFile string, reason string) {
 	)
 }
 
+// PlannedChange is one file a multi-file response will touch
+type PlannedChange struct {
+	Path    string
+	Action  string // create, replace or delete
+	Added   int    // Lines
+	Removed int
+}
+
+// ChangePlan lists the changes of a multi-file response before they are applied
+func (ui *UI) ChangePlan(changes []PlannedChange) {
+	ui.StopSpinner()
+	fmt.Printf("📝 %s\n", ui.colorize(ColorCyan, fmt.Sprintf("%d file changes proposed:", len(changes))))
+	for _, c := range changes {
+		switch c.Action {
+		case "create":
+			fmt.Printf("   ➕ %s %s\n", c.Path, ui.colorize(ColorGreen, fmt.Sprintf("(new, %d lines)", c.Added)))
+		case "delete":
+			fmt.Printf("   🗑️  %s %s\n", c.Path, ui.colorize(ColorRed, fmt.Sprintf("(delete, %d lines)", c.Removed)))
+		default:
+			fmt.Printf("   ✏️  %s %s\n", c.Path, ui.colorize(ColorYellow, fmt.Sprintf("(+%d −%d lines)", c.Added, c.Removed)))
+		}
+	}
+	fmt.Println()
+}
+
+// ReviewReport lists review findings grouped by file, followed by totals
+// per severity
+func (ui *UI) ReviewReport(findings []types.Finding) {
+	ui.StopSpinner()
+	if len(findings) == 0 {
+		fmt.Printf("✅ %s\n\n", ui.colorize(ColorGreen, "No findings"))
+		return
+	}
+
+	counts := make(map[types.Severity]int)
+	currentPath := ""
+	for _, f := range findings {
+		if f.Path != currentPath {
+			if currentPath != "" {
+				fmt.Println()
+			}
+			currentPath = f.Path
+			fmt.Printf("📄 %s\n", ui.colorize(ColorBlue, f.Path))
+		}
+
+		lines := fmt.Sprintf("%d", f.StartLine)
+		if f.EndLine > f.StartLine {
+			lines = fmt.Sprintf("%d-%d", f.StartLine, f.EndLine)
+		}
+		icon, color := "ℹ️ ", ColorGray
+		switch f.Severity {
+		case types.SeverityError:
+			icon, color = "❌", ColorRed
+		case types.SeverityWarning:
+			icon, color = "⚠️ ", ColorYellow
+		}
+		fmt.Printf("   %s %s %s %s\n", icon, ui.colorize(color, fmt.Sprintf("%-7s", f.Severity)),
+			ui.colorize(ColorGray, fmt.Sprintf("%s:%s [%s]", shortenPath(f.Path), lines, f.Category)), f.Message)
+		counts[f.Severity]++
+	}
+
+	fmt.Println()
+	fmt.Printf("🔎 %d findings: %d errors, %d warnings, %d notes\n\n",
+		len(findings), counts[types.SeverityError], counts[types.SeverityWarning], counts[types.SeverityNote])
+}
+
+// ClassifyReport shows the labels of every classified file, followed by how
+// many files carry each label
+func (ui *UI) ClassifyReport(results []*types.ProcessingResult) {
+	ui.StopSpinner()
+
+	var classified []*types.ProcessingResult
+	for _, result := range results {
+		if result.Success && result.Mode == types.ModeClassify {
+			classified = append(classified, result)
+		}
+	}
+	if len(classified) == 0 {
+		return
+	}
+	sort.SliceStable(classified, func(i, j int) bool {
+		return classified[i].InputFile < classified[j].InputFile
+	})
+
+	width := 0
+	for _, result := range classified {
+		width = max(width, len(shortenPath(result.InputFile)))
+	}
+
+	counts := make(map[string]int)
+	var order []string
+	for _, result := range classified {
+		var tags []string
+		for _, label := range result.Labels {
+			tags = append(tags, fmt.Sprintf("%s %s", ui.colorize(ColorCyan, label.Name),
+				ui.colorize(ColorGray, fmt.Sprintf("(%.2f)", label.Confidence))))
+			if counts[label.Name] == 0 {
+				order = append(order, label.Name)
+			}
+			counts[label.Name]++
+		}
+		if len(tags) == 0 {
+			tags = []string{ui.colorize(ColorGray, "-")}
+		}
+		fmt.Printf("📄 %-*s  %s\n", width, shortenPath(result.InputFile), strings.Join(tags, ", "))
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return counts[order[i]] > counts[order[j]]
+	})
+	var totals []string
+	for _, name := range order {
+		totals = append(totals, fmt.Sprintf("%s %d", name, counts[name]))
+	}
+	summary := fmt.Sprintf("%d files classified", len(classified))
+	if len(totals) > 0 {
+		summary += ": " + strings.Join(totals, ", ")
+	}
+	fmt.Println()
+	fmt.Printf("🏷️  %s\n\n", summary)
+}
+
 // Summary shows final processing summary
 func (ui *UI) Summary(results []*types.ProcessingResult) {
 	ui.StopSpinner()
@@ -188,18 +350,44 @@ func (ui *UI) Summary(results []*types.ProcessingResult) {
 			successText += " (generated)"
 		} else if stats.Transformed > 0 {
 			successText += " (transformed)"
+		} else if stats.Reviewed > 0 {
+			successText += " (reviewed)"
+		} else if stats.Extracted > 0 {
+			successText += " (extracted)"
+		} else if stats.Classified > 0 {
+			successText += " (classified)"
 		}
 		fmt.Printf("   %s\n", ui.colorize(ColorGreen, successText))
 	}
 
 	if stats.Skipped > 0 {
-		fmt.Printf("   %s\n", ui.colorize(ColorYellow, fmt.Sprintf("⏭️  %d files skipped", stats.Skipped)))
+		skippedText := fmt.Sprintf("⏭️  %d files skipped", stats.Skipped)
+		if stats.OverBudget > 0 {
+			skippedText += fmt.Sprintf(" (%d over budget)", stats.OverBudget)
+		}
+		fmt.Printf("   %s\n", ui.colorize(ColorYellow, skippedText))
 	}
 
 	if stats.Failed > 0 {
 		fmt.Printf("   %s\n", ui.colorize(ColorRed, fmt.Sprintf("❌ %d files failed", stats.Failed)))
 	}
 
+	if stats.Conflicts > 0 {
+		fmt.Printf("   %s\n", ui.colorize(ColorYellow, fmt.Sprintf("⚠️  %d files changed on disk during processing", stats.Conflicts)))
+	}
+
+	if stats.Normalized > 0 {
+		fmt.Printf("   %s\n", ui.colorize(ColorGray, fmt.Sprintf("🔧 %d files had line endings or final newline restored", stats.Normalized)))
+	}
+
+	if stats.TrimmedContext > 0 {
+		fmt.Printf("   %s\n", ui.colorize(ColorGray, fmt.Sprintf("📎 %d requests got trimmed context to fit the model window", stats.TrimmedContext)))
+	}
+
+	if stats.Redactions > 0 {
+		fmt.Printf("   %s\n", ui.colorize(ColorGray, fmt.Sprintf("🔒 %d sensitive values masked before sending", stats.Redactions)))
+	}
+
 	// Performance stats
 	if stats.TotalTokens > 0 {
 		fmt.Printf("   %s\n", ui.colorize(ColorPurple, fmt.Sprintf("🤖 %d AI tokens used", stats.TotalTokens)))
@@ -229,16 +417,56 @@ func (ui *UI) Summary(results []*types.ProcessingResult) {
 	fmt.Println()
 }
 
+// Estimate shows projected token usage and cost for a run
+func (ui *UI) Estimate(est *types.CostEstimate) {
+	ui.StopSpinner()
+
+	fmt.Printf("📊 %s\n", ui.colorize(ColorGreen, "Cost Estimate"))
+	fmt.Println(strings.Repeat("=", 50))
+
+	if ui.verbose {
+		for _, file := range est.Files {
+			line := fmt.Sprintf("%-40s %8d in %8d out", shortenPath(file.File), file.InputTokens, file.OutputTokens)
+			if est.Priced {
+				line += fmt.Sprintf("  $%.4f", file.Cost)
+			}
+			fmt.Printf("   %s\n", ui.colorize(ColorGray, line))
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("   🧠 Model: %s\n", ui.colorize(ColorPurple, est.Model))
+	fmt.Printf("   📁 Requests: %d (%d context files each)\n", len(est.Files), est.ContextFiles)
+	fmt.Printf("   📥 Input tokens:  ~%d\n", est.InputTokens)
+	fmt.Printf("   📤 Output tokens: ~%d\n", est.OutputTokens)
+
+	if est.Priced {
+		fmt.Printf("   %s\n", ui.colorize(ColorCyan, fmt.Sprintf("💰 Projected cost: $%.3f", est.Cost)))
+	} else {
+		ui.Warning(fmt.Sprintf("No price configured for %s; add it under 'pricing' in ~/.presto/config.yaml", est.Model))
+	}
+
+	fmt.Println()
+}
+
 // ProcessingStats holds summary statistics
 type ProcessingStats struct {
-	Successful    int
-	Failed        int
-	Skipped       int
-	Generated     int
-	Transformed   int
-	TotalTokens   int
-	TotalDuration time.Duration
-	EstimatedCost float64
+	Successful     int
+	Failed         int
+	Skipped        int
+	OverBudget     int
+	Generated      int
+	Transformed    int
+	Reviewed       int
+	Extracted      int
+	Classified     int
+	Normalized     int
+	Conflicts      int
+	Redactions     int
+	TrimmedContext int
+	TotalTokens    int
+	TotalDuration  time.Duration
+	EstimatedCost  float64
 }
 
 // calculateStats computes processing statistics
@@ -248,24 +476,47 @@ func (ui *UI) calculateStats(results []*types.ProcessingResult) ProcessingStats
 	for _, result := range results {
 		if result.Skipped {
 			stats.Skipped++
+			if result.OverBudget {
+				stats.OverBudget++
+			}
 		} else if result.Success {
 			stats.Successful++
-			stats.TotalTokens += result.AITokensUsed
 			stats.TotalDuration += result.Duration
 
-			if result.Mode == types.ModeGenerate {
+			switch result.Mode {
+			case types.ModeGenerate:
 				stats.Generated++
-			} else {
+			case types.ModeReview:
+				stats.Reviewed++
+			case types.ModeExtract:
+				stats.Extracted++
+			case types.ModeClassify:
+				stats.Classified++
+			default:
 				stats.Transformed++
 			}
+
+			if len(result.Normalizations) > 0 {
+				stats.Normalized++
+			}
 		} else {
 			stats.Failed++
 		}
-	}
 
-	// Rough cost estimation (adjust based on your model pricing)
-	// GPT-4: ~$0.03/1K tokens, GPT-3.5: ~$0.002/1K tokens
-	stats.EstimatedCost = float64(stats.TotalTokens) * 0.00003 // Rough GPT-4 estimate
+		if result.Conflict {
+			stats.Conflicts++
+		}
+		// Failed requests are paid for too
+		stats.TotalTokens += result.AITokensUsed
+		stats.EstimatedCost += result.Cost
+		stats.Redactions += result.Redactions
+		for _, u := range result.Context {
+			if u.Mode != types.ContextFull {
+				stats.TrimmedContext++
+				break
+			}
+		}
+	}
 
 	return stats
 }
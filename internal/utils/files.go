@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // EnsureDir creates a directory if it doesn't exist
@@ -48,3 +50,21 @@ func GetRelativePath(base, target string) string {
 func IsHiddenFile(name string) bool {
 	return len(name) > 0 && name[0] == '.'
 }
+
+// GoModulePath returns the module path declared in a go.mod file, or "" if
+// it can't be read
+func GoModulePath(goMod string) string {
+	file, err := os.Open(goMod)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if module, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module "); ok {
+			return strings.Trim(strings.TrimSpace(module), `"`)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pathVarPattern matches a {{name}} placeholder in a path template
+var pathVarPattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// PathVariables lists the placeholders a path template may use
+var PathVariables = []string{"path", "relpath", "dir", "name", "stem", "ext", "parent"}
+
+// ExpandPathTemplate fills a path template from an input file path. For
+// "internal/app/foo.go": {{path}} is the whole path, {{dir}} "internal/app",
+// {{name}} "foo.go", {{stem}} "foo", {{ext}} ".go" and {{parent}} "app".
+// {{relpath}} is the path relative to root, the directory being processed
+// ("app/foo.go" for root "internal"), or the whole path when root is empty.
+func ExpandPathTemplate(tmpl, path, root string) (string, error) {
+	ext := filepath.Ext(path)
+	name := filepath.Base(path)
+	dir := filepath.Dir(path)
+
+	relpath := path
+	if root != "" {
+		if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+			relpath = rel
+		}
+	}
+
+	values := map[string]string{
+		"path":    path,
+		"relpath": relpath,
+		"dir":     dir,
+		"name":    name,
+		"stem":    strings.TrimSuffix(name, ext),
+		"ext":     ext,
+		"parent":  filepath.Base(dir),
+	}
+
+	var unknown string
+	expanded := pathVarPattern.ReplaceAllStringFunc(tmpl, func(match string) string {
+		key := pathVarPattern.FindStringSubmatch(match)[1]
+		value, ok := values[key]
+		if !ok && unknown == "" {
+			unknown = key
+		}
+		return value
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("unknown variable {{%s}} in %q (available: %s)", unknown, tmpl, strings.Join(PathVariables, ", "))
+	}
+	return filepath.Clean(filepath.FromSlash(expanded)), nil
+}
+
+// ValidatePathTemplate checks that a path template only uses known variables
+func ValidatePathTemplate(tmpl string) error {
+	_, err := ExpandPathTemplate(tmpl, "file.txt", "")
+	return err
+}
+
+// FindUp returns the path of the first file or directory with the given name
+// in dir or its parents, or "" if there is none
+func FindUp(dir, name string) string {
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// GitRoot returns the root of the git repository containing dir, or "" when
+// dir is not inside one
+func GitRoot(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	if path := FindUp(abs, ".git"); path != "" {
+		return filepath.Dir(path)
+	}
+	return ""
+}
+
+// ProjectRoot returns the repository root containing dir, or dir itself made
+// absolute when it is not inside a git repository
+func ProjectRoot(dir string) string {
+	if root := GitRoot(dir); root != "" {
+		return root
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// SamePath reports whether two paths name the same file
+func SamePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
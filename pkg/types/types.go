@@ -2,6 +2,7 @@ package types
 
 import (
 	"errors"
+	"io/fs"
 	"time"
 )
 
@@ -28,6 +29,7 @@ const (
 	LangJSON       Language = "json"
 	LangYAML       Language = "yaml"
 	LangMarkdown   Language = "markdown"
+	LangNotebook   Language = "notebook"
 	LangText       Language = "text"
 )
 
@@ -39,12 +41,38 @@ type CommentStyle struct {
 	DocComment  string
 }
 
+// TextEncoding identifies how a text file is stored on disk
+type TextEncoding string
+
+const (
+	EncodingUTF8    TextEncoding = "utf-8"
+	EncodingUTF16LE TextEncoding = "utf-16le"
+	EncodingUTF16BE TextEncoding = "utf-16be"
+	EncodingLatin1  TextEncoding = "latin-1"
+)
+
+// FileFormat describes the on-disk representation of a text file so it can
+// be restored when the processed content is written back
+type FileFormat struct {
+	Encoding     TextEncoding
+	HasBOM       bool
+	LineEnding   string      // "\n" or "\r\n"; empty when the file has no line breaks
+	FinalNewline bool        // Content ends with a line break
+	Mode         fs.FileMode // Permission bits of the source file
+}
+
 // ProcessingMode defines how files should be processed
 type ProcessingMode string
 
 const (
 	ModeTransform ProcessingMode = "transform" // Modify existing files
 	ModeGenerate  ProcessingMode = "generate"  // Create new files
+	ModeMultiFile ProcessingMode = "multifile" // Create, replace and delete several files in one response
+	ModeAsk       ProcessingMode = "ask"       // Answer a question on stdout; never writes files
+	ModeReview    ProcessingMode = "review"    // Report findings per file; never writes files
+	ModeExtract   ProcessingMode = "extract"   // Collect a JSON object per file into one data file
+	ModeClassify  ProcessingMode = "classify"  // Tag each file with labels from a fixed set
+	ModeRecords   ProcessingMode = "records"   // Run the prompt on every CSV row, JSONL line or log entry
 )
 
 // OutputMode defines where processed content should go
@@ -59,6 +87,24 @@ const (
 	OutputModePreview   OutputMode = "preview"   // Show diff, ask for confirmation
 )
 
+// ConflictStrategy defines what happens when a file changes on disk while it is being processed
+type ConflictStrategy string
+
+const (
+	ConflictAbort   ConflictStrategy = "abort"   // Leave the file alone and report an error
+	ConflictSibling ConflictStrategy = "sibling" // Write the result next to it as .presto-conflict
+	ConflictMerge   ConflictStrategy = "merge"   // Three-way merge with the concurrent edit
+)
+
+// ExistsPolicy defines what per-file generation does when an output file already exists
+type ExistsPolicy string
+
+const (
+	ExistsSkip      ExistsPolicy = "skip"      // Leave the existing file alone
+	ExistsOverwrite ExistsPolicy = "overwrite" // Replace it with the new output
+	ExistsMerge     ExistsPolicy = "merge"     // Send it along and ask for an updated version
+)
+
 // ProcessingOptions contains all options for file processing
 type ProcessingOptions struct {
 
@@ -70,6 +116,56 @@ type ProcessingOptions struct {
 	OutputSuffix string     `json:"output_suffix"`        // For separate mode
 	SmartSuffix  bool       `json:"smart_suffix"`         // Insert before extension
 
+	// Generate mode with an output template writes one file per input
+	OutputTemplate string       `json:"output_template,omitempty"` // e.g. "{{dir}}/{{stem}}_test{{ext}}"
+	OnExists       ExistsPolicy `json:"on_exists,omitempty"`
+
+	// Generate mode with a map prompt runs it on every file or chunk first,
+	// then AIPrompt over the collected results
+	MapPrompt string `json:"map_prompt,omitempty"`
+
+	// Extract mode validates every response against SchemaFile and writes
+	// all objects to OutputPath as json, jsonl or csv
+	SchemaFile    string `json:"schema_file,omitempty"`
+	ExtractFormat string `json:"extract_format,omitempty"`
+
+	// Classify mode tags every file with Labels ("name" or "name:description")
+	// scored below MinConfidence are dropped
+	Labels        []string `json:"labels,omitempty"`
+	MinConfidence float64  `json:"min_confidence,omitempty"`
+
+	// Selectors limit a transform of JSON and YAML files to the string
+	// values they match; everything else is left byte for byte
+	Selectors []string `json:"selectors,omitempty"`
+
+	// Sections limit a transform of Markdown files to the sections whose
+	// heading line matches one of these regexes, each sent on its own
+	Sections []string `json:"sections,omitempty"`
+
+	// Cells picks the notebook cells a transform rewrites: code, markdown
+	// or all (the default)
+	Cells string `json:"cells,omitempty"`
+
+	// Symbols and LineRanges limit a transform to those parts of a file,
+	// each sent with the rest of the file as read-only context
+	Symbols    []string `json:"symbols,omitempty"`
+	LineRanges []string `json:"line_ranges,omitempty"`
+
+	// Records mode sends RecordFields (all when empty) of BatchSize records
+	// per request and writes each result to OutputField
+	RecordFormat string   `json:"record_format,omitempty"`
+	RecordFields []string `json:"record_fields,omitempty"`
+	OutputField  string   `json:"output_field,omitempty"`
+	BatchSize    int      `json:"batch_size,omitempty"`
+
+	// Tagged limits the inputs to files a classify run tagged with any of
+	// these labels, as recorded in TagsFile
+	Tagged   []string `json:"tagged,omitempty"`
+	TagsFile string   `json:"tags_file,omitempty"`
+
+	// ChangedSince limits the inputs to files changed since a git ref
+	ChangedSince string `json:"changed_since,omitempty"`
+
 	// AI Configuration
 	Model       string
 	AIPrompt    string         `json:"ai_prompt"`
@@ -79,11 +175,20 @@ type ProcessingOptions struct {
 	Mode        ProcessingMode `json:"mode"`
 
 	// File Filtering
-	Recursive       bool     `json:"recursive"`
-	FilePattern     string   `json:"file_pattern,omitempty"`
-	ExcludePattern  string   `json:"exclude_pattern,omitempty"`
-	ContextFiles    []string `json:"context_files,omitempty"`
-	ContextPatterns []string `json:"context_patterns,omitempty"`
+	Recursive        bool     `json:"recursive"`
+	FilePattern      string   `json:"file_pattern,omitempty"`
+	ExcludePattern   string   `json:"exclude_pattern,omitempty"`
+	ContextFiles     []string `json:"context_files,omitempty"`
+	ContextPatterns  []string `json:"context_patterns,omitempty"`
+	ContextBudget    int      `json:"context_budget,omitempty"`    // Max context tokens per request
+	ContextRepoMap   bool     `json:"context_repomap,omitempty"`   // Send a symbol outline of the project
+	ContextCommands  []string `json:"context_commands,omitempty"`  // Shell commands whose output is context
+	ContextTemplates []string `json:"context_templates,omitempty"` // Per-input context paths, see utils.ExpandPathTemplate
+
+	// Auto context attaches each input's local dependencies as context
+	AutoContext      bool `json:"auto_context,omitempty"`
+	AutoContextDepth int  `json:"auto_context_depth,omitempty"` // Import levels to follow
+	AutoContextFull  bool `json:"auto_context_full,omitempty"`  // Full source instead of signatures
 
 	// Processing Options
 	MaxConcurrent  int  `json:"max_concurrent"`
@@ -93,6 +198,13 @@ type ProcessingOptions struct {
 	Verbose        bool `json:"verbose"`
 	Preview        bool `json:"preview"` // Show diff before saving
 
+	OnConflict ConflictStrategy `json:"on_conflict,omitempty"` // For in-place writes
+
+	// Run budget; zero means unlimited
+	MaxFiles       int     `json:"max_files,omitempty"`
+	MaxTotalTokens int     `json:"max_total_tokens,omitempty"`
+	MaxCost        float64 `json:"max_cost,omitempty"` // USD
+
 	// system prompt
 	SystemPrompt     string `json:"system_prompt"`
 	SystemPromptFile string `json:"system_prompt_file"`
@@ -104,6 +216,15 @@ type FileInfo struct {
 	OriginalPath string
 	Language     Language
 	Size         int64
+	Format       FileFormat    // Populated when the file is read
+	Snapshot     *FileSnapshot // State of the file when it was read
+}
+
+// FileSnapshot records a file's state at read time so concurrent edits can be detected
+type FileSnapshot struct {
+	ModTime time.Time
+	Hash    string
+	Content string // Decoded content, used as the base for three-way merges
 }
 
 // ContextFile represents a file used as context for AI processing
@@ -112,17 +233,47 @@ type ContextFile struct {
 	Language Language
 	Content  string
 	Label    string
+	Pinned   bool // Named explicitly by the user; always ranked first when packing
+}
+
+// ContextMode describes how much of a context file made it into a request
+type ContextMode string
+
+const (
+	ContextFull      ContextMode = "full"
+	ContextOutline   ContextMode = "outline"   // Declarations only
+	ContextTruncated ContextMode = "truncated" // Leading part of the file
+	ContextDropped   ContextMode = "dropped"   // Did not fit
+)
+
+// ContextUsage records what one context file contributed to a request
+type ContextUsage struct {
+	Path   string
+	Label  string
+	Mode   ContextMode
+	Tokens int
+	Score  float64 // Relevance to the input file
 }
 
 // AIRequest represents a request to the AI service
 type AIRequest struct {
+	Model       string         `json:"model,omitempty"` // Overrides the configured model
 	Prompt      string         `json:"prompt"`
 	Content     string         `json:"content,omitempty"`
-	FileName    string         `json:"file_name,omitempty"` // NEW: Current file name
+	FileName    string         `json:"file_name,omitempty"`    // NEW: Current file name
+	FileContext string         `json:"file_context,omitempty"` // Rendered description of the current file
 	Language    Language       `json:"language"`
 	MaxTokens   int            `json:"max_tokens,omitempty"`
 	Temperature float64        `json:"temperature,omitempty"`
 	Mode        ProcessingMode `json:"mode"`
+
+	// PerItem marks a request answered with one result per item, as a JSON
+	// object (see records.Instructions), rather than with whole file content
+	PerItem bool `json:"per_item,omitempty"`
+
+	// ResponseSchema asks for JSON matching this JSON Schema through the
+	// provider's structured output support, where it has one
+	ResponseSchema []byte `json:"response_schema,omitempty"`
 }
 
 // AIResponse represents a response from the AI service
@@ -132,6 +283,14 @@ type AIResponse struct {
 	Model        string `json:"model"`
 	FinishReason string `json:"finish_reason"` // ADD THIS
 	Truncated    bool   `json:"truncated"`     // ADD THIS
+
+	// Token usage split the way providers bill it. InputTokens excludes
+	// CachedTokens.
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	CachedTokens int `json:"cached_tokens"`
+
+	Redactions int `json:"redactions"` // Sensitive values masked in the prompts
 }
 
 // ProcessingResult represents the result of processing a file
@@ -144,8 +303,68 @@ type ProcessingResult struct {
 	Error        error
 	BytesChanged int
 	AITokensUsed int
+	InputTokens  int
+	OutputTokens int
+	CachedTokens int
+	Cost         float64 // USD, zero when the model has no price entry
 	Mode         ProcessingMode
 	Duration     time.Duration
+	Conflict     bool // File changed on disk while it was being processed
+	OverBudget   bool // Not sent, or stopped, because a run limit was reached
+	Redactions   int  // Sensitive values masked before sending
+	Context      []ContextUsage
+
+	// Normalizations lists deliberate adjustments made to the output, such as
+	// restoring CRLF line endings or the final newline
+	Normalizations []string
+
+	Findings  []Finding      // Review mode
+	Extracted map[string]any // Extract mode: the validated object
+	Labels    []Label        // Classify mode
+}
+
+// Severity ranks a review finding; the values match SARIF levels
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // Bugs, security holes, data loss
+	SeverityWarning Severity = "warning" // Likely problems worth fixing
+	SeverityNote    Severity = "note"    // Suggestions and style
+)
+
+// Finding is one issue reported by review mode
+type Finding struct {
+	Path      string   `json:"path"`
+	StartLine int      `json:"start_line"`
+	EndLine   int      `json:"end_line"`
+	Severity  Severity `json:"severity"`
+	Category  string   `json:"category"`
+	Message   string   `json:"message"`
+}
+
+// Label is one tag assigned by classify mode
+type Label struct {
+	Name       string  `json:"label"`
+	Confidence float64 `json:"confidence"` // 0 to 1
+}
+
+// FileEstimate is the projected usage for a single request
+type FileEstimate struct {
+	File         string
+	InputTokens  int
+	OutputTokens int
+	Cost         float64
+}
+
+// CostEstimate is the projected usage and cost of a run
+type CostEstimate struct {
+	Model        string
+	Files        []FileEstimate
+	ContextFiles int
+	InputTokens  int
+	OutputTokens int
+	Cost         float64
+	Priced       bool // False when no price entry exists for the model
 }
 
 // Command represents a prefab command with predefined settings
@@ -161,18 +380,27 @@ type Command struct {
 
 // CommandOptions represents options that can be set in a command
 type CommandOptions struct {
-	OutputMode      string   `yaml:"output_mode,omitempty"`
-	OutputSuffix    string   `yaml:"output_suffix,omitempty"`
-	FilePattern     string   `yaml:"file_pattern,omitempty"`
-	ExcludePattern  string   `yaml:"exclude_pattern,omitempty"`
-	ContextPatterns []string `yaml:"context_patterns,omitempty"`
-	ContextFiles    []string `yaml:"context_files,omitempty"`
-	Recursive       bool     `yaml:"recursive,omitempty"`
-	RemoveComments  bool     `yaml:"remove_comments,omitempty"`
-	BackupOriginal  bool     `yaml:"backup_original,omitempty"`
-	Model           string   `yaml:"model,omitempty"`
-	Temperature     float64  `yaml:"temperature,omitempty"`
-	MaxTokens       int      `yaml:"max_tokens,omitempty"`
+	OutputMode       string   `yaml:"output_mode,omitempty"`
+	OutputSuffix     string   `yaml:"output_suffix,omitempty"`
+	OutputTemplate   string   `yaml:"output_template,omitempty"`
+	OnExists         string   `yaml:"on_exists,omitempty"`
+	MapPrompt        string   `yaml:"map_prompt,omitempty"`
+	FilePattern      string   `yaml:"file_pattern,omitempty"`
+	ExcludePattern   string   `yaml:"exclude_pattern,omitempty"`
+	ContextPatterns  []string `yaml:"context_patterns,omitempty"`
+	ContextFiles     []string `yaml:"context_files,omitempty"`
+	AutoContext      bool     `yaml:"auto_context,omitempty"`
+	AutoContextDepth int      `yaml:"auto_context_depth,omitempty"`
+	AutoContextFull  bool     `yaml:"auto_context_full,omitempty"`
+	ContextRepoMap   bool     `yaml:"context_repomap,omitempty"`
+	ContextCommands  []string `yaml:"context_commands,omitempty"`
+	ContextTemplates []string `yaml:"context_templates,omitempty"` // Per-input paths such as "{{dir}}/{{stem}}_test.go"
+	Recursive        bool     `yaml:"recursive,omitempty"`
+	RemoveComments   bool     `yaml:"remove_comments,omitempty"`
+	BackupOriginal   bool     `yaml:"backup_original,omitempty"`
+	Model            string   `yaml:"model,omitempty"`
+	Temperature      float64  `yaml:"temperature,omitempty"`
+	MaxTokens        int      `yaml:"max_tokens,omitempty"`
 }
 
 // Common errors
@@ -182,6 +410,8 @@ var (
 	ErrMissingPrompt     = errors.New("prompt or prompt file required")
 	ErrMissingInput      = errors.New("input path required")
 	ErrMissingOutput     = errors.New("output file required for generate mode")
+	ErrFileChanged       = errors.New("file changed on disk during processing")
+	ErrBudgetExceeded    = errors.New("budget exceeded")
 )
 
 // AIProvider represents different AI providers